@@ -0,0 +1,160 @@
+package cpu
+
+import (
+	"fmt"
+)
+
+const (
+	ROMSize = 0x8000
+	RAMSize = 0x8000
+
+	ScreenBase   = 0x4000
+	ScreenSize   = 0x2000
+	KeyboardAddr = 0x6000
+)
+
+type CPU struct {
+	ROM [ROMSize]uint16
+	RAM [RAMSize]uint16
+
+	A  uint16
+	D  uint16
+	PC uint16
+
+	Cycles uint64
+
+	labels map[string]uint16
+}
+
+func New() *CPU {
+	return &CPU{labels: map[string]uint16{}}
+}
+
+// Reset clears the registers and the cycle counter. ROM and RAM are left as they are.
+func (c *CPU) Reset() {
+	c.A, c.D, c.PC = 0, 0, 0
+	c.Cycles = 0
+}
+
+func (c *CPU) Label(name string) (uint16, bool) {
+	pc, ok := c.labels[name]
+	return pc, ok
+}
+
+func (c *CPU) Screen() []uint16 {
+	return c.RAM[ScreenBase : ScreenBase+ScreenSize]
+}
+
+func (c *CPU) SetKey(key uint16) {
+	c.RAM[KeyboardAddr] = key
+}
+
+// Step runs an instruction. PC has 15 bits as the ROM address, so it wraps around from 0x7fff to 0,
+// and a jump takes the lower 15 bits of A.
+func (c *CPU) Step() {
+	inst := c.ROM[c.PC&(ROMSize-1)]
+	c.Cycles++
+
+	// A instruction
+	if inst&0x8000 == 0 {
+		c.A = inst
+		c.PC = (c.PC + 1) & (ROMSize - 1)
+		return
+	}
+
+	// C instruction
+	y := c.A
+	if inst&0x1000 != 0 {
+		y = c.read(c.A)
+	}
+	out := alu(c.D, y, inst>>6)
+
+	addr := c.A
+	if inst&0x08 != 0 { // dest M
+		c.write(addr, out)
+	}
+	if inst&0x10 != 0 { // dest D
+		c.D = out
+	}
+	if inst&0x20 != 0 { // dest A
+		c.A = out
+	}
+
+	if jump(out, inst) {
+		c.PC = addr & (ROMSize - 1)
+	} else {
+		c.PC = (c.PC + 1) & (ROMSize - 1)
+	}
+}
+
+func (c *CPU) Run(cycles uint64) {
+	for i := uint64(0); i < cycles; i++ {
+		c.Step()
+	}
+}
+
+func (c *CPU) RunUntil(label string, maxCycles uint64) error {
+	pc, ok := c.labels[label]
+	if !ok {
+		return fmt.Errorf("unknown label: %s", label)
+	}
+	return c.RunUntilPC(pc, maxCycles)
+}
+
+func (c *CPU) RunUntilPC(pc uint16, maxCycles uint64) error {
+	for i := uint64(0); i < maxCycles; i++ {
+		if c.PC == pc {
+			return nil
+		}
+		c.Step()
+	}
+	if c.PC == pc {
+		return nil
+	}
+	return fmt.Errorf("PC did not reach %d in %d cycles", pc, maxCycles)
+}
+
+func (c *CPU) read(addr uint16) uint16 {
+	return c.RAM[addr&(RAMSize-1)]
+}
+
+func (c *CPU) write(addr uint16, v uint16) {
+	addr &= RAMSize - 1
+	if addr == KeyboardAddr { // keyboard is read only
+		return
+	}
+	c.RAM[addr] = v
+}
+
+// alu computes the Hack ALU with the control bits zx, nx, zy, ny, f, no (bit 5 to 0 of ctrl).
+func alu(x, y uint16, ctrl uint16) uint16 {
+	if ctrl&0x20 != 0 { // zx
+		x = 0
+	}
+	if ctrl&0x10 != 0 { // nx
+		x = ^x
+	}
+	if ctrl&0x08 != 0 { // zy
+		y = 0
+	}
+	if ctrl&0x04 != 0 { // ny
+		y = ^y
+	}
+	var out uint16
+	if ctrl&0x02 != 0 { // f
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if ctrl&0x01 != 0 { // no
+		out = ^out
+	}
+	return out
+}
+
+func jump(out uint16, inst uint16) bool {
+	v := int16(out)
+	return (inst&0x04 != 0 && v < 0) ||
+		(inst&0x02 != 0 && v == 0) ||
+		(inst&0x01 != 0 && v > 0)
+}
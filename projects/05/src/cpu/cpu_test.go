@@ -0,0 +1,156 @@
+package cpu
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstructions(t *testing.T) {
+	tests := []struct {
+		asm     string
+		a, d, m uint16 // the registers and RAM[a] before
+		wantA   uint16
+		wantD   uint16
+		wantM   uint16 // RAM[a] after
+	}{
+		{asm: "@1234", a: 7, d: 3, m: 1, wantA: 1234, wantD: 3, wantM: 1},
+		{asm: "D=A", a: 7, d: 3, m: 1, wantA: 7, wantD: 7, wantM: 1},
+		{asm: "D=D+A", a: 7, d: 3, m: 1, wantA: 7, wantD: 10, wantM: 1},
+		{asm: "D=D-M", a: 7, d: 3, m: 1, wantA: 7, wantD: 2, wantM: 1},
+		{asm: "M=D|M", a: 7, d: 6, m: 3, wantA: 7, wantD: 6, wantM: 7},
+		{asm: "M=!M", a: 7, d: 0, m: 0, wantA: 7, wantD: 0, wantM: 0xffff},
+		{asm: "D=-1", a: 7, d: 3, m: 1, wantA: 7, wantD: 0xffff, wantM: 1},
+		{asm: "A=A-1", a: 7, d: 3, m: 1, wantA: 6, wantD: 3, wantM: 1},
+		{asm: "AMD=D&A", a: 7, d: 6, m: 1, wantA: 6, wantD: 6, wantM: 6},
+	}
+
+	for _, test := range tests {
+		t.Run(test.asm, func(t *testing.T) {
+			c := loadAsm(t, test.asm)
+			c.A, c.D, c.RAM[test.a] = test.a, test.d, test.m
+			c.Step()
+
+			if c.A != test.wantA || c.D != test.wantD || c.RAM[test.a] != test.wantM {
+				t.Errorf("got A=%d D=%d M=%d, want A=%d D=%d M=%d", c.A, c.D, c.RAM[test.a], test.wantA, test.wantD, test.wantM)
+			}
+			if c.PC != 1 || c.Cycles != 1 {
+				t.Errorf("got PC=%d Cycles=%d, want PC=1 Cycles=1", c.PC, c.Cycles)
+			}
+		})
+	}
+}
+
+// TestMemoryTiming checks that M is read and written at the address of A before the instruction,
+// even when the instruction writes A.
+func TestMemoryTiming(t *testing.T) {
+	c := loadAsm(t, "AM=M+1\nA=D;JMP")
+	c.A, c.D = 5, 100
+	c.RAM[5] = 9
+	c.Step()
+	if c.A != 10 || c.RAM[5] != 10 || c.RAM[10] != 0 {
+		t.Errorf("AM=M+1: got A=%d RAM[5]=%d RAM[10]=%d, want A=10 RAM[5]=10 RAM[10]=0", c.A, c.RAM[5], c.RAM[10])
+	}
+
+	// the jump goes to A before the instruction
+	c.Step()
+	if c.A != 100 || c.PC != 10 {
+		t.Errorf("A=D;JMP: got A=%d PC=%d, want A=100 PC=10", c.A, c.PC)
+	}
+
+	// the keyboard is read only
+	c = loadAsm(t, "@KBD\nM=1")
+	c.SetKey(65)
+	c.Run(2)
+	if c.RAM[KeyboardAddr] != 65 {
+		t.Errorf("keyboard: got %d, want 65", c.RAM[KeyboardAddr])
+	}
+}
+
+func TestJump(t *testing.T) {
+	values := []uint16{0xffff, 0, 1}
+	tests := []struct {
+		jump string
+		want [3]bool // jumps on -1, 0 and 1
+	}{
+		{jump: "", want: [3]bool{false, false, false}},
+		{jump: "JGT", want: [3]bool{false, false, true}},
+		{jump: "JEQ", want: [3]bool{false, true, false}},
+		{jump: "JGE", want: [3]bool{false, true, true}},
+		{jump: "JLT", want: [3]bool{true, false, false}},
+		{jump: "JNE", want: [3]bool{true, false, true}},
+		{jump: "JLE", want: [3]bool{true, true, false}},
+		{jump: "JMP", want: [3]bool{true, true, true}},
+	}
+
+	for _, test := range tests {
+		for i, v := range values {
+			src := "D"
+			if test.jump != "" {
+				src += ";" + test.jump
+			}
+			c := loadAsm(t, src)
+			c.A, c.D = 100, v
+			c.Step()
+
+			want := uint16(1)
+			if test.want[i] {
+				want = 100
+			}
+			if c.PC != want {
+				t.Errorf("%s with D=%d: got PC=%d, want %d", src, int16(v), c.PC, want)
+			}
+		}
+	}
+}
+
+func TestPCWraps(t *testing.T) {
+	c := New()
+	if err := c.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// running off the end of the ROM
+	c.PC = ROMSize - 1
+	c.Step()
+	if c.PC != 0 || c.A != 0 {
+		t.Errorf("got PC=%d A=%d, want PC=0 A=0", c.PC, c.A)
+	}
+
+	// jumping to A over 15 bits: A=-1;JMP at 0 goes to 0x7fff
+	c.ROM[0] = 0xeea7
+	c.A = 0xffff
+	c.Step()
+	if c.PC != ROMSize-1 {
+		t.Errorf("got PC=%d, want %d", c.PC, ROMSize-1)
+	}
+	c.Step()
+	if c.PC != 0 {
+		t.Errorf("got PC=%d, want 0", c.PC)
+	}
+}
+
+func TestReset(t *testing.T) {
+	c := loadAsm(t, "@3\nD=A\n@7\nM=D")
+	c.Run(4)
+	if c.RAM[7] != 3 {
+		t.Fatalf("RAM[7]: got %d, want 3", c.RAM[7])
+	}
+
+	c.Reset()
+	if c.A != 0 || c.D != 0 || c.PC != 0 || c.Cycles != 0 {
+		t.Errorf("got A=%d D=%d PC=%d Cycles=%d, want all 0", c.A, c.D, c.PC, c.Cycles)
+	}
+	if c.RAM[7] != 3 || c.ROM[0] != 3 {
+		t.Errorf("RAM and ROM are not kept: RAM[7]=%d ROM[0]=%d", c.RAM[7], c.ROM[0])
+	}
+}
+
+func loadAsm(t *testing.T, src string) *CPU {
+	t.Helper()
+
+	c := New()
+	if err := c.LoadAsm("Test.asm", strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -0,0 +1,82 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nfukaaswa/nand2tetris/06/src/asm"
+)
+
+func (c *CPU) Load(codes []uint16) error {
+	if len(codes) > ROMSize {
+		return fmt.Errorf("program too large: %d instructions", len(codes))
+	}
+	c.ROM = [ROMSize]uint16{}
+	copy(c.ROM[:], codes)
+	c.labels = map[string]uint16{}
+	c.Reset()
+	return nil
+}
+
+func (c *CPU) LoadHack(srcPath string, r io.Reader) error {
+	codes, err := ReadHack(srcPath, r)
+	if err != nil {
+		return err
+	}
+	return c.Load(codes)
+}
+
+// ReadHack reads the instructions written in binary, one per line.
+func ReadHack(srcPath string, r io.Reader) ([]uint16, error) {
+	var codes []uint16
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		str := strings.TrimSpace(scanner.Text())
+		if str == "" {
+			continue
+		}
+		code, err := strconv.ParseUint(str, 2, 16)
+		if err != nil || len(str) != 16 {
+			return nil, fmt.Errorf("error %s:%d: invalid instruction: %s", srcPath, line, str)
+		}
+		codes = append(codes, uint16(code))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (c *CPU) LoadAsm(srcPath string, r io.Reader) error {
+	prog, err := asm.Assemble(srcPath, r)
+	if err != nil {
+		return err
+	}
+	if err := c.Load(prog.Codes); err != nil {
+		return err
+	}
+	c.labels = prog.Symbols.Labels()
+	return nil
+}
+
+func (c *CPU) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch ext := filepath.Ext(path); ext {
+	case ".hack":
+		return c.LoadHack(path, file)
+	case ".asm":
+		return c.LoadAsm(path, file)
+	default:
+		return fmt.Errorf("unsupported program file: %s", path)
+	}
+}
@@ -0,0 +1,199 @@
+package hdl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type builtinDef struct {
+	chipInfo
+	new func() chip
+}
+
+// builtinChip is a chip implemented in Go. fn computes the outputs from the inputs.
+type builtinChip struct {
+	in  []uint16
+	out []uint16
+	fn  func(in, out []uint16)
+}
+
+func (c *builtinChip) inputs() []uint16 {
+	return c.in
+}
+
+func (c *builtinChip) outputs() []uint16 {
+	return c.out
+}
+
+func (c *builtinChip) eval() {
+	c.fn(c.in, c.out)
+}
+
+func (c *builtinChip) tick() {}
+
+func (c *builtinChip) tock() {}
+
+func combinational(in, out []PinDef, fn func(in, out []uint16)) *builtinDef {
+	comb := make([][]bool, len(in))
+	for i := range comb {
+		comb[i] = allPins(len(out))
+	}
+	return &builtinDef{
+		chipInfo: chipInfo{inputs: in, outputs: out, comb: comb},
+		new: func() chip {
+			return &builtinChip{in: make([]uint16, len(in)), out: make([]uint16, len(out)), fn: fn}
+		},
+	}
+}
+
+// pins makes pin definitions from the notation of HDL, such as "a[16]" or "sel".
+func pins(names ...string) []PinDef {
+	var ret []PinDef
+	for _, name := range names {
+		pin := PinDef{Name: name, Width: 1}
+		if pos := strings.IndexByte(name, '['); pos != -1 {
+			pin.Name = name[:pos]
+			pin.Width, _ = strconv.Atoi(strings.TrimSuffix(name[pos+1:], "]"))
+		}
+		ret = append(ret, pin)
+	}
+	return ret
+}
+
+// builtinFor looks up the built-in chip of the "BUILTIN" chip definition, whose pins must be the same.
+func builtinFor(def *ChipDef) (*builtinDef, error) {
+	b, ok := builtins[def.Builtin]
+	if !ok {
+		return nil, fmt.Errorf("built-in chip %s does not exist", def.Builtin)
+	}
+	if !samePins(def.Inputs, b.inputs) || !samePins(def.Outputs, b.outputs) {
+		return nil, fmt.Errorf("pins of chip %s do not match the built-in chip %s", def.Name, def.Builtin)
+	}
+	return b, nil
+}
+
+func samePins(a, b []PinDef) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func allPins(n int) []bool {
+	ret := make([]bool, n)
+	for i := range ret {
+		ret[i] = true
+	}
+	return ret
+}
+
+func bit(b bool) uint16 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// builtins is the registry of the chips implemented in Go, which are used for the parts
+// without .hdl files and for the chips declared with "BUILTIN Name;".
+// The sequential chips and the devices are registered by their own files.
+var builtins = map[string]*builtinDef{
+	"Nand": combinational(pins("a", "b"), pins("out"), func(in, out []uint16) {
+		out[0] = ^(in[0] & in[1]) & 1
+	}),
+	"Not": combinational(pins("in"), pins("out"), func(in, out []uint16) {
+		out[0] = ^in[0] & 1
+	}),
+	"And": combinational(pins("a", "b"), pins("out"), func(in, out []uint16) {
+		out[0] = in[0] & in[1]
+	}),
+	"Or": combinational(pins("a", "b"), pins("out"), func(in, out []uint16) {
+		out[0] = in[0] | in[1]
+	}),
+	"Xor": combinational(pins("a", "b"), pins("out"), func(in, out []uint16) {
+		out[0] = in[0] ^ in[1]
+	}),
+	"Mux": combinational(pins("a", "b", "sel"), pins("out"), func(in, out []uint16) {
+		out[0] = in[in[2]]
+	}),
+	"DMux": combinational(pins("in", "sel"), pins("a", "b"), func(in, out []uint16) {
+		out[0], out[1] = 0, 0
+		out[in[1]] = in[0]
+	}),
+	"Not16": combinational(pins("in[16]"), pins("out[16]"), func(in, out []uint16) {
+		out[0] = ^in[0]
+	}),
+	"And16": combinational(pins("a[16]", "b[16]"), pins("out[16]"), func(in, out []uint16) {
+		out[0] = in[0] & in[1]
+	}),
+	"Or16": combinational(pins("a[16]", "b[16]"), pins("out[16]"), func(in, out []uint16) {
+		out[0] = in[0] | in[1]
+	}),
+	"Mux16": combinational(pins("a[16]", "b[16]", "sel"), pins("out[16]"), func(in, out []uint16) {
+		out[0] = in[in[2]]
+	}),
+	"Or8Way": combinational(pins("in[8]"), pins("out"), func(in, out []uint16) {
+		out[0] = bit(in[0] != 0)
+	}),
+	"Mux4Way16": combinational(pins("a[16]", "b[16]", "c[16]", "d[16]", "sel[2]"), pins("out[16]"), func(in, out []uint16) {
+		out[0] = in[in[4]]
+	}),
+	"Mux8Way16": combinational(pins("a[16]", "b[16]", "c[16]", "d[16]", "e[16]", "f[16]", "g[16]", "h[16]", "sel[3]"), pins("out[16]"), func(in, out []uint16) {
+		out[0] = in[in[8]]
+	}),
+	"DMux4Way": combinational(pins("in", "sel[2]"), pins("a", "b", "c", "d"), func(in, out []uint16) {
+		for i := range out {
+			out[i] = 0
+		}
+		out[in[1]] = in[0]
+	}),
+	"DMux8Way": combinational(pins("in", "sel[3]"), pins("a", "b", "c", "d", "e", "f", "g", "h"), func(in, out []uint16) {
+		for i := range out {
+			out[i] = 0
+		}
+		out[in[1]] = in[0]
+	}),
+	"HalfAdder": combinational(pins("a", "b"), pins("sum", "carry"), func(in, out []uint16) {
+		s := in[0] + in[1]
+		out[0], out[1] = s&1, s>>1
+	}),
+	"FullAdder": combinational(pins("a", "b", "c"), pins("sum", "carry"), func(in, out []uint16) {
+		s := in[0] + in[1] + in[2]
+		out[0], out[1] = s&1, s>>1
+	}),
+	"Add16": combinational(pins("a[16]", "b[16]"), pins("out[16]"), func(in, out []uint16) {
+		out[0] = in[0] + in[1]
+	}),
+	"Inc16": combinational(pins("in[16]"), pins("out[16]"), func(in, out []uint16) {
+		out[0] = in[0] + 1
+	}),
+	"ALU": combinational(pins("x[16]", "y[16]", "zx", "nx", "zy", "ny", "f", "no"), pins("out[16]", "zr", "ng"), func(in, out []uint16) {
+		x, y := in[0], in[1]
+		if in[2] != 0 {
+			x = 0
+		}
+		if in[3] != 0 {
+			x = ^x
+		}
+		if in[4] != 0 {
+			y = 0
+		}
+		if in[5] != 0 {
+			y = ^y
+		}
+		o := x & y
+		if in[6] != 0 {
+			o = x + y
+		}
+		if in[7] != 0 {
+			o = ^o
+		}
+		out[0], out[1], out[2] = o, bit(o == 0), o>>15
+	}),
+}
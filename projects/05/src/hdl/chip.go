@@ -0,0 +1,610 @@
+package hdl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// chip is an instance of a chip. Pin values are held in the input and output buffers
+// indexed by the pin order of the chip definition.
+//
+// The clock cycle is simulated in two phases: tick latches the inputs of the clocked chips
+// and tock updates their outputs with the latched values.
+type chip interface {
+	inputs() []uint16
+	outputs() []uint16
+	eval()
+	tick()
+	tock()
+}
+
+// chipInfo describes how a chip behaves as a part.
+type chipInfo struct {
+	inputs  []PinDef
+	outputs []PinDef
+
+	// comb[i][o] tells whether the input i affects the output o without the clock.
+	comb    [][]bool
+	clocked bool
+}
+
+type compositeChip struct {
+	def     *ChipDef
+	nodes   []uint16 // inputs, outputs and internal pins
+	parts   []*part  // in evaluation order
+	clocked []*part
+}
+
+func (c *compositeChip) inputs() []uint16 {
+	return c.nodes[:len(c.def.Inputs)]
+}
+
+func (c *compositeChip) outputs() []uint16 {
+	return c.nodes[len(c.def.Inputs) : len(c.def.Inputs)+len(c.def.Outputs)]
+}
+
+func (c *compositeChip) eval() {
+	for _, p := range c.parts {
+		p.eval(c.nodes)
+	}
+}
+
+func (c *compositeChip) tick() {
+	c.eval()
+	for _, p := range c.clocked {
+		// the inputs fed back from the later parts are updated by the whole evaluation
+		p.load(c.nodes)
+		p.chip.tick()
+	}
+}
+
+func (c *compositeChip) tock() {
+	for _, p := range c.clocked {
+		p.chip.tock()
+	}
+	c.eval()
+}
+
+// find looks for the stateful part named name in the chip and its parts.
+func (c *compositeChip) find(name string) stateful {
+	for _, p := range c.parts {
+		if p.name == name {
+			if s, ok := p.chip.(stateful); ok {
+				return s
+			}
+		}
+		if sub, ok := p.chip.(*compositeChip); ok {
+			if found := sub.find(name); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+type part struct {
+	name    string
+	line    int
+	chip    chip
+	info    *chipInfo
+	inputs  []wire // node -> part input pin
+	outputs []wire // part output pin -> node
+}
+
+// wire copies width bits between a pin of a part and a node of the chip.
+// node is -1 for the constants, whose value is held in constant.
+type wire struct {
+	pin      int
+	pinLo    int
+	node     int
+	nodeLo   int
+	width    int
+	constant uint16
+}
+
+func (p *part) eval(nodes []uint16) {
+	p.load(nodes)
+	p.chip.eval()
+
+	out := p.chip.outputs()
+	for _, w := range p.outputs {
+		nodes[w.node] = setBits(nodes[w.node], w.nodeLo, w.width, getBits(out[w.pin], w.pinLo, w.width))
+	}
+}
+
+func (p *part) load(nodes []uint16) {
+	in := p.chip.inputs()
+	for _, w := range p.inputs {
+		v := w.constant
+		if w.node >= 0 {
+			v = getBits(nodes[w.node], w.nodeLo, w.width)
+		}
+		in[w.pin] = setBits(in[w.pin], w.pinLo, w.width, v)
+	}
+}
+
+func mask(width int) uint16 {
+	return uint16(1<<uint(width) - 1)
+}
+
+func getBits(v uint16, lo, width int) uint16 {
+	return (v >> uint(lo)) & mask(width)
+}
+
+func setBits(v uint16, lo, width int, bits uint16) uint16 {
+	m := mask(width) << uint(lo)
+	return v&^m | (bits<<uint(lo))&m
+}
+
+// loader instantiates chips, looking for the .hdl file in dir first and then for the built-in chip.
+type loader struct {
+	dir     string
+	defs    map[string]*ChipDef
+	infos   map[string]*chipInfo
+	loading map[string]bool
+}
+
+func newLoader(dir string) *loader {
+	return &loader{
+		dir:     dir,
+		defs:    map[string]*ChipDef{},
+		infos:   map[string]*chipInfo{},
+		loading: map[string]bool{},
+	}
+}
+
+// def returns the definition of the chip name, or nil when it is a built-in chip.
+func (l *loader) def(name string) (*ChipDef, error) {
+	if def, ok := l.defs[name]; ok {
+		return def, nil
+	}
+
+	path := filepath.Join(l.dir, name+".hdl")
+	if _, err := os.Stat(path); err != nil {
+		if _, ok := builtins[name]; ok {
+			l.defs[name] = nil
+			return nil, nil
+		}
+		return nil, fmt.Errorf("chip %s is not found: neither %s nor a built-in chip exists", name, path)
+	}
+
+	def, err := ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if def.Name != name {
+		return nil, fmt.Errorf("error %s: chip name %s does not match the file name", path, def.Name)
+	}
+	l.defs[name] = def
+	return def, nil
+}
+
+func (l *loader) instantiate(name string) (chip, *chipInfo, error) {
+	def, err := l.def(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if def == nil {
+		b := builtins[name]
+		return b.new(), &b.chipInfo, nil
+	}
+	c, err := l.build(def)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, l.infos[name], nil
+}
+
+func (l *loader) build(def *ChipDef) (chip, error) {
+	if l.loading[def.Name] {
+		return nil, fmt.Errorf("error %s: chip %s uses itself as a part", def.Src, def.Name)
+	}
+	l.loading[def.Name] = true
+	defer delete(l.loading, def.Name)
+
+	if def.Builtin != "" {
+		b, err := builtinFor(def)
+		if err != nil {
+			return nil, fmt.Errorf("error %s: %v", def.Src, err)
+		}
+		l.infos[def.Name] = &b.chipInfo
+		return b.new(), nil
+	}
+
+	b := newBuilder(def)
+	for i := range def.Parts {
+		pd := &def.Parts[i]
+		c, info, err := l.instantiate(pd.Name)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.addPart(pd, c, info); err != nil {
+			return nil, fmt.Errorf("error %s:%d: %v", def.Src, pd.Line, err)
+		}
+	}
+	c, info, err := b.finish()
+	if err != nil {
+		return nil, fmt.Errorf("error %s: %v", def.Src, err)
+	}
+	l.infos[def.Name] = info
+	return c, nil
+}
+
+type builder struct {
+	def      *ChipDef
+	names    []string
+	indices  map[string]int // node name -> node index
+	widths   []int
+	internal []bool
+	parts    []*part
+	sources  map[int]int      // node -> index of the part which drives it
+	readers  map[int][]pinUse // node -> part input pins which read it
+}
+
+type pinUse struct {
+	part int
+	pin  int
+}
+
+func newBuilder(def *ChipDef) *builder {
+	b := &builder{
+		def:     def,
+		indices: map[string]int{},
+		sources: map[int]int{},
+		readers: map[int][]pinUse{},
+	}
+	for _, pin := range def.Inputs {
+		b.addNode(pin.Name, pin.Width, false)
+	}
+	for _, pin := range def.Outputs {
+		b.addNode(pin.Name, pin.Width, false)
+	}
+	return b
+}
+
+func (b *builder) addNode(name string, width int, internal bool) int {
+	b.indices[name] = len(b.widths)
+	b.names = append(b.names, name)
+	b.widths = append(b.widths, width)
+	b.internal = append(b.internal, internal)
+	return len(b.widths) - 1
+}
+
+func (b *builder) isInput(node int) bool {
+	return node < len(b.def.Inputs)
+}
+
+func (b *builder) isOutput(node int) bool {
+	return node >= len(b.def.Inputs) && node < len(b.def.Inputs)+len(b.def.Outputs)
+}
+
+func (b *builder) addPart(pd *PartDef, c chip, info *chipInfo) error {
+	p := &part{name: pd.Name, line: pd.Line, chip: c, info: info}
+	idx := len(b.parts)
+
+	for _, conn := range pd.Conns {
+		pinIdx, pin, isInput := findPin(info.inputs, info.outputs, conn.Pin.Name)
+		if pin == nil {
+			return fmt.Errorf("%s has no pin named %s", pd.Name, conn.Pin.Name)
+		}
+		pinLo, width, err := subBus(conn.Pin, pin.Width)
+		if err != nil {
+			return fmt.Errorf("%s: %v", pd.Name, err)
+		}
+
+		if isInput {
+			w, err := b.inputWire(conn, pinIdx, pinLo, width)
+			if err != nil {
+				return fmt.Errorf("%s(%s=%s): %v", pd.Name, conn.Pin, conn.Node, err)
+			}
+			p.inputs = append(p.inputs, w)
+			if w.node >= 0 {
+				b.readers[w.node] = append(b.readers[w.node], pinUse{part: idx, pin: pinIdx})
+			}
+			continue
+		}
+
+		w, err := b.outputWire(conn, pinIdx, pinLo, width)
+		if err != nil {
+			return fmt.Errorf("%s(%s=%s): %v", pd.Name, conn.Pin, conn.Node, err)
+		}
+		p.outputs = append(p.outputs, w)
+		b.sources[w.node] = idx
+	}
+
+	b.parts = append(b.parts, p)
+	return nil
+}
+
+func (b *builder) inputWire(conn Conn, pin, pinLo, width int) (wire, error) {
+	w := wire{pin: pin, pinLo: pinLo, width: width, node: -1}
+
+	if conn.Node.IsConst() {
+		if conn.Node.HasRange() {
+			return w, fmt.Errorf("sub bus of a constant")
+		}
+		if conn.Node.Name == "true" {
+			w.constant = mask(width)
+		}
+		return w, nil
+	}
+
+	node, ok := b.indices[conn.Node.Name]
+	if !ok {
+		// internal pins may be used before their source part appears
+		node = b.addNode(conn.Node.Name, width, true)
+	}
+	if b.isOutput(node) {
+		return w, fmt.Errorf("an output pin of the chip cannot be used as an input of a part")
+	}
+	if conn.Node.HasRange() && b.internal[node] {
+		return w, fmt.Errorf("sub bus of an internal pin cannot be used")
+	}
+	nodeLo, nodeWidth, err := subBus(conn.Node, b.widths[node])
+	if err != nil {
+		return w, err
+	}
+	if nodeWidth != width {
+		return w, fmt.Errorf("bus width mismatch: %d and %d", width, nodeWidth)
+	}
+	w.node, w.nodeLo = node, nodeLo
+	return w, nil
+}
+
+func (b *builder) outputWire(conn Conn, pin, pinLo, width int) (wire, error) {
+	w := wire{pin: pin, pinLo: pinLo, width: width, node: -1}
+
+	if conn.Node.IsConst() {
+		return w, fmt.Errorf("an output pin cannot be connected to a constant")
+	}
+
+	node, ok := b.indices[conn.Node.Name]
+	if !ok {
+		node = b.addNode(conn.Node.Name, width, true)
+	}
+	if b.isInput(node) {
+		return w, fmt.Errorf("an input pin of the chip cannot be driven by a part")
+	}
+	if conn.Node.HasRange() && b.internal[node] {
+		return w, fmt.Errorf("sub bus of an internal pin cannot be used")
+	}
+	if src, ok := b.sources[node]; ok && !conn.Node.HasRange() {
+		return w, fmt.Errorf("pin %s is already driven by %s", conn.Node.Name, b.parts[src].name)
+	}
+	nodeLo, nodeWidth, err := subBus(conn.Node, b.widths[node])
+	if err != nil {
+		return w, err
+	}
+	if nodeWidth != width {
+		return w, fmt.Errorf("bus width mismatch: %d and %d", width, nodeWidth)
+	}
+	w.node, w.nodeLo = node, nodeLo
+	return w, nil
+}
+
+func (b *builder) finish() (chip, *chipInfo, error) {
+	for node, name := range b.names {
+		if _, ok := b.sources[node]; !ok && b.internal[node] {
+			return nil, nil, fmt.Errorf("internal pin %s has no source", name)
+		}
+	}
+
+	order, err := b.sort()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &compositeChip{def: b.def, nodes: make([]uint16, len(b.widths))}
+	for _, i := range order {
+		c.parts = append(c.parts, b.parts[i])
+	}
+	for _, p := range b.parts {
+		if p.info.clocked {
+			c.clocked = append(c.clocked, p)
+		}
+	}
+
+	info := &chipInfo{
+		inputs:  b.def.Inputs,
+		outputs: b.def.Outputs,
+		comb:    make([][]bool, len(b.def.Inputs)),
+		clocked: len(c.clocked) != 0,
+	}
+	for i := range b.def.Inputs {
+		info.comb[i] = b.reachedOutputs(i)
+	}
+	return c, info, nil
+}
+
+// vertex is an output pin of a part. The parts are ordered by the output pins, because a part
+// like the CPU may feed a part back through one output and read it through an input which affects
+// another output only.
+type vertex struct {
+	part int
+	pin  int
+}
+
+// edge is a combinational dependency between the output pins through the node.
+type edge struct {
+	to   int
+	node int
+}
+
+func (b *builder) vertices() ([]vertex, [][]edge) {
+	var vs []vertex
+	first := make([]int, len(b.parts))
+	for i, p := range b.parts {
+		first[i] = len(vs)
+		for pin := range p.info.outputs {
+			vs = append(vs, vertex{part: i, pin: pin})
+		}
+	}
+
+	next := make([][]edge, len(vs))
+	for i, p := range b.parts {
+		for _, w := range p.outputs {
+			from := first[i] + w.pin
+			for _, r := range b.readers[w.node] {
+				for pin, comb := range b.parts[r.part].info.comb[r.pin] {
+					if comb {
+						next[from] = append(next[from], edge{to: first[r.part] + pin, node: w.node})
+					}
+				}
+			}
+		}
+	}
+	return vs, next
+}
+
+// sort returns the evaluation order of the parts. Every output pin is evaluated after the
+// output pins which drive the inputs affecting it without the clock, so a part may be evaluated
+// more than once. The inputs of the clocked chips may be fed back from the later parts.
+func (b *builder) sort() ([]int, error) {
+	vs, next := b.vertices()
+	deps := make([]int, len(vs))
+	for _, es := range next {
+		for _, e := range es {
+			deps[e.to]++
+		}
+	}
+
+	var order, ready []int
+	for v, d := range deps {
+		if d == 0 {
+			ready = append(ready, v)
+		}
+	}
+	done, last := 0, -1
+	for len(ready) > 0 {
+		// prefer the pins of the last part so that it is evaluated once for them
+		k := 0
+		for j, v := range ready {
+			if vs[v].part == last {
+				k = j
+				break
+			}
+		}
+		v := ready[k]
+		ready = append(ready[:k], ready[k+1:]...)
+		done++
+		if vs[v].part != last {
+			last = vs[v].part
+			order = append(order, last)
+		}
+		for _, e := range next[v] {
+			deps[e.to]--
+			if deps[e.to] == 0 {
+				ready = append(ready, e.to)
+			}
+		}
+	}
+
+	if done != len(vs) {
+		return nil, fmt.Errorf("combinational loop: %s", b.describeLoop(vs, next, deps))
+	}
+	return order, nil
+}
+
+// describeLoop finds a loop among the output pins which could not be ordered, and describes it like
+// "And (line 3) -[w]-> Not (line 4) -[x]-> And (line 3)".
+func (b *builder) describeLoop(vs []vertex, next [][]edge, deps []int) string {
+	visited := make([]bool, len(vs))
+	onStack := make([]bool, len(vs))
+	var stack []int
+	var path []edge
+
+	var visit func(v int) (int, []edge)
+	visit = func(v int) (int, []edge) {
+		visited[v], onStack[v] = true, true
+		stack = append(stack, v)
+		for _, e := range next[v] {
+			if onStack[e.to] {
+				for k, s := range stack {
+					if s == e.to {
+						return s, append(append([]edge{}, path[k:]...), e)
+					}
+				}
+			}
+			if visited[e.to] || deps[e.to] == 0 {
+				continue
+			}
+			path = append(path, e)
+			if start, loop := visit(e.to); loop != nil {
+				return start, loop
+			}
+			path = path[:len(path)-1]
+		}
+		onStack[v] = false
+		stack = stack[:len(stack)-1]
+		return 0, nil
+	}
+
+	for v := range vs {
+		if deps[v] == 0 || visited[v] {
+			continue
+		}
+		start, loop := visit(v)
+		if loop == nil {
+			continue
+		}
+		str := b.partString(vs[start].part)
+		for _, e := range loop {
+			str += fmt.Sprintf(" -[%s]-> %s", b.names[e.node], b.partString(vs[e.to].part))
+		}
+		return str
+	}
+	return "unknown"
+}
+
+func (b *builder) partString(i int) string {
+	return fmt.Sprintf("%s (line %d)", b.parts[i].name, b.parts[i].line)
+}
+
+// reachedOutputs tells which outputs of the chip the input node affects without the clock.
+func (b *builder) reachedOutputs(input int) []bool {
+	reached := make([]bool, len(b.def.Outputs))
+	seen := map[int]bool{input: true}
+	queue := []int{input}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if b.isOutput(node) {
+			reached[node-len(b.def.Inputs)] = true
+		}
+		for _, r := range b.readers[node] {
+			p := b.parts[r.part]
+			for _, w := range p.outputs {
+				if p.info.comb[r.pin][w.pin] && !seen[w.node] {
+					seen[w.node] = true
+					queue = append(queue, w.node)
+				}
+			}
+		}
+	}
+	return reached
+}
+
+func findPin(in, out []PinDef, name string) (int, *PinDef, bool) {
+	for i := range in {
+		if in[i].Name == name {
+			return i, &in[i], true
+		}
+	}
+	for i := range out {
+		if out[i].Name == name {
+			return i, &out[i], false
+		}
+	}
+	return -1, nil, false
+}
+
+func subBus(ref PinRef, width int) (lo, w int, err error) {
+	if !ref.HasRange() {
+		return 0, width, nil
+	}
+	if ref.Hi >= width {
+		return 0, 0, fmt.Errorf("sub bus %s is out of the bus width %d", ref, width)
+	}
+	return ref.Lo, ref.Hi - ref.Lo + 1, nil
+}
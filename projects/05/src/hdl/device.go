@@ -0,0 +1,120 @@
+package hdl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nfukaaswa/nand2tetris/05/src/cpu"
+	"github.com/nfukaaswa/nand2tetris/06/src/asm"
+)
+
+// romChip is the built-in ROM32K. The program is given by "ROM32K load Foo.hack" in test scripts.
+type romChip struct {
+	in  []uint16
+	out []uint16
+	rom [cpu.ROMSize]uint16
+}
+
+func (c *romChip) inputs() []uint16 {
+	return c.in
+}
+
+func (c *romChip) outputs() []uint16 {
+	return c.out
+}
+
+func (c *romChip) eval() {
+	c.out[0] = c.rom[c.in[0]]
+}
+
+func (c *romChip) tick() {}
+
+func (c *romChip) tock() {}
+
+func (c *romChip) state(index int) (*uint16, error) {
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(c.rom) {
+		return nil, fmt.Errorf("index %d is out of range", index)
+	}
+	return &c.rom[index], nil
+}
+
+// load replaces the program with the one in the .hack or .asm file.
+func (c *romChip) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var codes []uint16
+	switch filepath.Ext(path) {
+	case ".hack":
+		if codes, err = cpu.ReadHack(path, file); err != nil {
+			return err
+		}
+	case ".asm":
+		prog, err := asm.Assemble(path, file)
+		if err != nil {
+			return err
+		}
+		codes = prog.Codes
+	default:
+		return fmt.Errorf("unsupported program file: %s", path)
+	}
+	if len(codes) > len(c.rom) {
+		return fmt.Errorf("program too large: %d instructions", len(codes))
+	}
+	c.rom = [cpu.ROMSize]uint16{}
+	copy(c.rom[:], codes)
+	c.eval()
+	return nil
+}
+
+// keyboardChip is the built-in Keyboard. The key is set through its state, "Keyboard[]".
+type keyboardChip struct {
+	out []uint16
+	key uint16
+}
+
+func (c *keyboardChip) inputs() []uint16 {
+	return nil
+}
+
+func (c *keyboardChip) outputs() []uint16 {
+	return c.out
+}
+
+func (c *keyboardChip) eval() {
+	c.out[0] = c.key
+}
+
+func (c *keyboardChip) tick() {}
+
+func (c *keyboardChip) tock() {}
+
+func (c *keyboardChip) state(index int) (*uint16, error) {
+	if index > 0 {
+		return nil, fmt.Errorf("index %d is out of range", index)
+	}
+	return &c.key, nil
+}
+
+func init() {
+	builtins["ROM32K"] = &builtinDef{
+		chipInfo: chipInfo{inputs: pins("address[15]"), outputs: pins("out[16]"), comb: [][]bool{{true}}},
+		new: func() chip {
+			return &romChip{in: make([]uint16, 1), out: make([]uint16, 1)}
+		},
+	}
+	builtins["Keyboard"] = &builtinDef{
+		chipInfo: chipInfo{outputs: pins("out[16]")},
+		new: func() chip {
+			return &keyboardChip{out: make([]uint16, 1)}
+		},
+	}
+	builtins["Screen"] = sequential(pins("in[16]", "load", "address[13]"), pins("out[16]"), cpu.ScreenSize, 2, loadIn)
+}
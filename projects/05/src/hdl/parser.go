@@ -0,0 +1,408 @@
+package hdl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type ChipDef struct {
+	Name    string
+	Inputs  []PinDef
+	Outputs []PinDef
+	Parts   []PartDef
+
+	// Builtin is the name of the built-in chip which implements the chip, given by
+	// "BUILTIN Name;" instead of the parts. Clocked lists the pins of "CLOCKED a, b;".
+	Builtin string
+	Clocked []string
+
+	Src string
+}
+
+type PinDef struct {
+	Name  string
+	Width int
+}
+
+type PartDef struct {
+	Name  string
+	Conns []Conn
+	Line  int
+}
+
+// Conn is a connection in a part, "a[0..7]=x" connects the part's pin a[0..7] to the chip's pin x.
+type Conn struct {
+	Pin  PinRef
+	Node PinRef
+}
+
+// PinRef is a pin reference with an optional sub bus. Lo and Hi are -1 when the whole bus is referred.
+type PinRef struct {
+	Name string
+	Lo   int
+	Hi   int
+}
+
+func (r PinRef) HasRange() bool {
+	return r.Lo >= 0
+}
+
+func (r PinRef) IsConst() bool {
+	return r.Name == "true" || r.Name == "false"
+}
+
+func (r PinRef) String() string {
+	switch {
+	case !r.HasRange():
+		return r.Name
+	case r.Lo == r.Hi:
+		return fmt.Sprintf("%s[%d]", r.Name, r.Lo)
+	default:
+		return fmt.Sprintf("%s[%d..%d]", r.Name, r.Lo, r.Hi)
+	}
+}
+
+func (d *ChipDef) input(name string) (int, *PinDef) {
+	for i := range d.Inputs {
+		if d.Inputs[i].Name == name {
+			return i, &d.Inputs[i]
+		}
+	}
+	return -1, nil
+}
+
+func (d *ChipDef) output(name string) (int, *PinDef) {
+	for i := range d.Outputs {
+		if d.Outputs[i].Name == name {
+			return i, &d.Outputs[i]
+		}
+	}
+	return -1, nil
+}
+
+func ParseFile(path string) (*ChipDef, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(path, file)
+}
+
+func Parse(srcPath string, r io.Reader) (*ChipDef, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := tokenize(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("error %s:%v", srcPath, err)
+	}
+	p := parser{tokens: tokens}
+	def, err := p.parseChip()
+	if err != nil {
+		return nil, fmt.Errorf("error %s:%v", srcPath, err)
+	}
+	def.Src = srcPath
+	return def, nil
+}
+
+type token struct {
+	value string
+	line  int
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end == -1 {
+				end = len(src) - i
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("%d: comment not closed", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case strings.HasPrefix(src[i:], ".."):
+			tokens = append(tokens, token{value: "..", line: line})
+			i += 2
+		case strings.IndexByte("{}()[],;=:", c) != -1:
+			tokens = append(tokens, token{value: string(c), line: line})
+			i++
+		case isIdentChar(c):
+			start := i
+			for i < len(src) && isIdentChar(src[i]) {
+				i++
+			}
+			tokens = append(tokens, token{value: src[start:i], line: line})
+		default:
+			return nil, fmt.Errorf("%d: unexpected character '%c'", line, c)
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
+}
+
+type parser struct {
+	tokens []token
+	line   int
+}
+
+func (p *parser) parseChip() (*ChipDef, error) {
+	if err := p.expect("CHIP"); err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	def := ChipDef{Name: name}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	if p.check("IN") {
+		p.pop()
+		if def.Inputs, err = p.parsePinDefs(); err != nil {
+			return nil, err
+		}
+	}
+	if p.check("OUT") {
+		p.pop()
+		if def.Outputs, err = p.parsePinDefs(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.check("BUILTIN") {
+		if err := p.parseBuiltin(&def); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := p.expect("PARTS"); err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		for !p.check("}") {
+			part, err := p.parsePart()
+			if err != nil {
+				return nil, err
+			}
+			def.Parts = append(def.Parts, *part)
+		}
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+
+	if t := p.top(); t != nil {
+		return nil, fmt.Errorf("%d: unexpected '%s' after chip definition", t.line, t.value)
+	}
+	return &def, nil
+}
+
+func (p *parser) parseBuiltin(def *ChipDef) error {
+	p.pop()
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	if err := p.expect(";"); err != nil {
+		return err
+	}
+	def.Builtin = name
+
+	if !p.check("CLOCKED") {
+		return nil
+	}
+	p.pop()
+	pins, err := p.parsePinDefs()
+	if err != nil {
+		return err
+	}
+	for _, pin := range pins {
+		def.Clocked = append(def.Clocked, pin.Name)
+	}
+	return nil
+}
+
+func (p *parser) parsePinDefs() ([]PinDef, error) {
+	var pins []PinDef
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		pin := PinDef{Name: name, Width: 1}
+		if p.check("[") {
+			p.pop()
+			if pin.Width, err = p.number(); err != nil {
+				return nil, err
+			}
+			if pin.Width < 1 || pin.Width > 16 {
+				return nil, fmt.Errorf("%d: bus width of %s must be 1 to 16", p.line, name)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		}
+		pins = append(pins, pin)
+
+		t := p.pop()
+		if t == nil {
+			return nil, fmt.Errorf("%d: unexpected end of file", p.line)
+		}
+		switch t.value {
+		case ",":
+			continue
+		case ";":
+			return pins, nil
+		default:
+			return nil, fmt.Errorf("%d: ',' or ';' is expected, but got '%s'", t.line, t.value)
+		}
+	}
+}
+
+func (p *parser) parsePart() (*PartDef, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	part := PartDef{Name: name, Line: p.line}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		pin, err := p.parsePinRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		node, err := p.parsePinRef()
+		if err != nil {
+			return nil, err
+		}
+		part.Conns = append(part.Conns, Conn{Pin: pin, Node: node})
+
+		t := p.pop()
+		if t == nil {
+			return nil, fmt.Errorf("%d: unexpected end of file", p.line)
+		}
+		if t.value == "," {
+			continue
+		}
+		if t.value != ")" {
+			return nil, fmt.Errorf("%d: ',' or ')' is expected, but got '%s'", t.line, t.value)
+		}
+		break
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	return &part, nil
+}
+
+func (p *parser) parsePinRef() (PinRef, error) {
+	name, err := p.ident()
+	if err != nil {
+		return PinRef{}, err
+	}
+	ref := PinRef{Name: name, Lo: -1, Hi: -1}
+	if !p.check("[") {
+		return ref, nil
+	}
+	p.pop()
+	if ref.Lo, err = p.number(); err != nil {
+		return ref, err
+	}
+	ref.Hi = ref.Lo
+	if p.check("..") {
+		p.pop()
+		if ref.Hi, err = p.number(); err != nil {
+			return ref, err
+		}
+	}
+	if ref.Hi < ref.Lo || ref.Hi > 15 {
+		return ref, fmt.Errorf("%d: invalid sub bus: %s", p.line, ref)
+	}
+	return ref, p.expect("]")
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.pop()
+	if t == nil {
+		return "", fmt.Errorf("%d: identifier is expected, but got end of file", p.line)
+	}
+	if !isIdentChar(t.value[0]) || (t.value[0] >= '0' && t.value[0] <= '9') {
+		return "", fmt.Errorf("%d: identifier is expected, but got '%s'", t.line, t.value)
+	}
+	return t.value, nil
+}
+
+func (p *parser) number() (int, error) {
+	t := p.pop()
+	if t == nil {
+		return 0, fmt.Errorf("%d: number is expected, but got end of file", p.line)
+	}
+	n, err := strconv.Atoi(t.value)
+	if err != nil {
+		return 0, fmt.Errorf("%d: number is expected, but got '%s'", t.line, t.value)
+	}
+	return n, nil
+}
+
+func (p *parser) expect(value string) error {
+	t := p.pop()
+	if t == nil {
+		return fmt.Errorf("%d: '%s' is expected, but got end of file", p.line, value)
+	}
+	if t.value != value {
+		return fmt.Errorf("%d: '%s' is expected, but got '%s'", t.line, value, t.value)
+	}
+	return nil
+}
+
+func (p *parser) check(value string) bool {
+	t := p.top()
+	return t != nil && t.value == value
+}
+
+func (p *parser) top() *token {
+	if len(p.tokens) == 0 {
+		return nil
+	}
+	return &p.tokens[0]
+}
+
+func (p *parser) pop() *token {
+	if len(p.tokens) == 0 {
+		return nil
+	}
+	ret := &p.tokens[0]
+	p.tokens = p.tokens[1:]
+	p.line = ret.line
+	return ret
+}
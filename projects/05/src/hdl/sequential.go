@@ -0,0 +1,127 @@
+package hdl
+
+import "fmt"
+
+// stateful is implemented by the built-in chips whose state can be referred from
+// test scripts, such as "RAM16K[12]" or "DRegister[]". index is -1 for the empty index.
+type stateful interface {
+	state(index int) (*uint16, error)
+}
+
+// memoryChip is a clocked chip which holds words: DFF, registers and RAMs.
+// next decides the word to write at the clock. Like the official simulator, the word is
+// stored at the tick, and the registers show it on out at the tock. The RAMs show the word
+// at the address whenever they are evaluated.
+type memoryChip struct {
+	in   []uint16
+	out  []uint16
+	mem  []uint16
+	mask uint16
+	addr int // address input pin, -1 for the chips without address
+	next func(in []uint16, cur uint16) (v uint16, write bool)
+}
+
+func (c *memoryChip) inputs() []uint16 {
+	return c.in
+}
+
+func (c *memoryChip) outputs() []uint16 {
+	return c.out
+}
+
+func (c *memoryChip) address() int {
+	if c.addr < 0 {
+		return 0
+	}
+	return int(c.in[c.addr])
+}
+
+func (c *memoryChip) eval() {
+	if c.addr >= 0 {
+		c.out[0] = c.mem[c.address()]
+	}
+}
+
+func (c *memoryChip) tick() {
+	addr := c.address()
+	if v, write := c.next(c.in, c.mem[addr]); write {
+		c.mem[addr] = v & c.mask
+	}
+}
+
+func (c *memoryChip) tock() {
+	c.out[0] = c.mem[c.address()]
+}
+
+func (c *memoryChip) state(index int) (*uint16, error) {
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(c.mem) {
+		return nil, fmt.Errorf("index %d is out of range", index)
+	}
+	return &c.mem[index], nil
+}
+
+func sequential(in, out []PinDef, size int, addr int, next func(in []uint16, cur uint16) (uint16, bool)) *builtinDef {
+	comb := make([][]bool, len(in))
+	for i := range comb {
+		comb[i] = make([]bool, len(out))
+	}
+	if addr >= 0 {
+		comb[addr] = allPins(len(out)) // out = mem[address] without the clock
+	}
+	return &builtinDef{
+		chipInfo: chipInfo{inputs: in, outputs: out, comb: comb, clocked: true},
+		new: func() chip {
+			return &memoryChip{
+				in:   make([]uint16, len(in)),
+				out:  make([]uint16, len(out)),
+				mem:  make([]uint16, size),
+				mask: mask(out[0].Width),
+				addr: addr,
+				next: next,
+			}
+		},
+	}
+}
+
+func loadIn(in []uint16, cur uint16) (uint16, bool) {
+	return in[0], in[1] != 0
+}
+
+func ram(addrWidth int) *builtinDef {
+	return sequential(pins("in[16]", "load", fmt.Sprintf("address[%d]", addrWidth)), pins("out[16]"), 1<<uint(addrWidth), 2, loadIn)
+}
+
+func init() {
+	sequentials := map[string]*builtinDef{
+		"DFF": sequential(pins("in"), pins("out"), 1, -1, func(in []uint16, cur uint16) (uint16, bool) {
+			return in[0], true
+		}),
+		"Bit":       sequential(pins("in", "load"), pins("out"), 1, -1, loadIn),
+		"Register":  sequential(pins("in[16]", "load"), pins("out[16]"), 1, -1, loadIn),
+		"ARegister": sequential(pins("in[16]", "load"), pins("out[16]"), 1, -1, loadIn),
+		"DRegister": sequential(pins("in[16]", "load"), pins("out[16]"), 1, -1, loadIn),
+		"PC": sequential(pins("in[16]", "load", "inc", "reset"), pins("out[16]"), 1, -1, func(in []uint16, cur uint16) (uint16, bool) {
+			switch {
+			case in[3] != 0:
+				return 0, true
+			case in[1] != 0:
+				return in[0], true
+			case in[2] != 0:
+				return cur + 1, true
+			default:
+				return cur, false
+			}
+		}),
+		"RAM8":   ram(3),
+		"RAM64":  ram(6),
+		"RAM512": ram(9),
+		"RAM4K":  ram(12),
+		"RAM16K": ram(14),
+	}
+	for name, def := range sequentials {
+		builtins[name] = def
+	}
+}
@@ -0,0 +1,211 @@
+package hdl
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/nfukaaswa/nand2tetris/05/src/tst"
+)
+
+// Chip is a simulated top level chip.
+type Chip struct {
+	Def  *ChipDef
+	impl chip
+}
+
+// LoadChip loads the chip from the .hdl file. The parts are looked up in the same directory
+// as the file, and the built-in chips are used for the parts whose .hdl files do not exist.
+func LoadChip(path string) (*Chip, error) {
+	def, err := ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l := newLoader(filepath.Dir(path))
+	l.defs[def.Name] = def
+	impl, err := l.build(def)
+	if err != nil {
+		return nil, err
+	}
+	return &Chip{Def: def, impl: impl}, nil
+}
+
+func (c *Chip) Set(pin string, v uint16) error {
+	i, def := c.Def.input(pin)
+	if def == nil {
+		return fmt.Errorf("chip %s has no input pin named %s", c.Def.Name, pin)
+	}
+	c.impl.inputs()[i] = v & mask(def.Width)
+	return nil
+}
+
+func (c *Chip) Get(pin string) (uint16, error) {
+	if i, def := c.Def.input(pin); def != nil {
+		return c.impl.inputs()[i], nil
+	}
+	if i, def := c.Def.output(pin); def != nil {
+		return c.impl.outputs()[i], nil
+	}
+	return 0, fmt.Errorf("chip %s has no pin named %s", c.Def.Name, pin)
+}
+
+// State returns the word held by the built-in part named part, such as "DRegister" or "RAM16K".
+// index selects the word of memories, and -1 selects the only word of registers.
+func (c *Chip) State(part string, index int) (*uint16, error) {
+	s, err := c.find(part)
+	if err != nil {
+		return nil, err
+	}
+	return s.state(index)
+}
+
+func (c *Chip) find(part string) (stateful, error) {
+	var s stateful
+	switch impl := c.impl.(type) {
+	case *compositeChip:
+		s = impl.find(part)
+	case stateful:
+		s = impl
+	}
+	if s == nil {
+		return nil, fmt.Errorf("chip %s has no pin or built-in part named %s", c.Def.Name, part)
+	}
+	return s, nil
+}
+
+func (c *Chip) Eval() {
+	c.impl.eval()
+}
+
+// Tick latches the inputs of the clocked parts, and Tock updates their outputs.
+func (c *Chip) Tick() {
+	c.impl.tick()
+}
+
+func (c *Chip) Tock() {
+	c.impl.tock()
+}
+
+func (c *Chip) hasPin(pin string) bool {
+	_, in := c.Def.input(pin)
+	_, out := c.Def.output(pin)
+	return in != nil || out != nil
+}
+
+// Simulator runs test scripts written for the hardware simulator (load Foo.hdl).
+type Simulator struct {
+	Chip *Chip
+}
+
+func NewSimulator() *Simulator {
+	return &Simulator{}
+}
+
+func (s *Simulator) Load(path string) error {
+	c, err := LoadChip(path)
+	if err != nil {
+		return err
+	}
+	s.Chip = c
+	return nil
+}
+
+func (s *Simulator) Get(name string) (int, error) {
+	if s.Chip == nil {
+		return 0, fmt.Errorf("chip is not loaded")
+	}
+	pin, index, err := tst.SplitVar(name)
+	if err != nil {
+		return 0, err
+	}
+	if !s.Chip.hasPin(pin) {
+		p, err := s.Chip.State(pin, index)
+		if err != nil {
+			return 0, err
+		}
+		return int(*p), nil
+	}
+	v, err := s.Chip.Get(pin)
+	if err != nil {
+		return 0, err
+	}
+	if index >= 0 {
+		v = getBits(v, index, 1)
+	}
+	return int(v), nil
+}
+
+func (s *Simulator) Set(name string, value int) error {
+	if s.Chip == nil {
+		return fmt.Errorf("chip is not loaded")
+	}
+	pin, index, err := tst.SplitVar(name)
+	if err != nil {
+		return err
+	}
+	v := uint16(value)
+	if !s.Chip.hasPin(pin) {
+		p, err := s.Chip.State(pin, index)
+		if err != nil {
+			return err
+		}
+		*p = v
+		return nil
+	}
+	if index >= 0 {
+		cur, err := s.Chip.Get(pin)
+		if err != nil {
+			return err
+		}
+		v = setBits(cur, index, 1, v)
+	}
+	return s.Chip.Set(pin, v)
+}
+
+func (s *Simulator) Eval() error {
+	if s.Chip == nil {
+		return fmt.Errorf("chip is not loaded")
+	}
+	s.Chip.Eval()
+	return nil
+}
+
+// Command runs the commands for the built-in parts, such as "ROM32K load Add.hack".
+// The file is looked up relative to the directory of the chip.
+func (s *Simulator) Command(args []string) error {
+	if len(args) != 3 || args[1] != "load" {
+		return fmt.Errorf("unknown command: %s", strings.Join(args, " "))
+	}
+	if s.Chip == nil {
+		return fmt.Errorf("chip is not loaded")
+	}
+	st, err := s.Chip.find(args[0])
+	if err != nil {
+		return err
+	}
+	rom, ok := st.(interface{ load(path string) error })
+	if !ok {
+		return fmt.Errorf("%s does not support load", args[0])
+	}
+	path := args[2]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(s.Chip.Def.Src), path)
+	}
+	return rom.load(path)
+}
+
+func (s *Simulator) Tick() error {
+	if s.Chip == nil {
+		return fmt.Errorf("chip is not loaded")
+	}
+	s.Chip.Tick()
+	return nil
+}
+
+func (s *Simulator) Tock() error {
+	if s.Chip == nil {
+		return fmt.Errorf("chip is not loaded")
+	}
+	s.Chip.Tock()
+	return nil
+}
@@ -0,0 +1,72 @@
+package hdl
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nfukaaswa/nand2tetris/05/src/tst"
+)
+
+func TestSimulator(t *testing.T) {
+	patterns := []string{
+		"../../../demo/Xor.tst",
+		"../../../01/*.tst",
+		"../../../02/*.tst",
+		"../../../03/a/*.tst",
+		"../../../03/b/*.tst",
+		"../../../05/CPU.tst",
+		"../../../05/CPU-external.tst",
+		"../../../05/Computer*.tst",
+	}
+
+	for _, pattern := range patterns {
+		scripts, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, script := range scripts {
+			script := script
+			t.Run(filepath.Base(script), func(t *testing.T) {
+				err := tst.RunFile(script, tst.RunnerOptions{
+					Simulator: NewSimulator(),
+					Out:       io.Discard,
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+func TestCombinationalLoop(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Loop.hdl": "CHIP Loop {\n    IN in;\n    OUT out;\n\n    PARTS:\n" +
+			"    Not(in=b, out=a);\n    Not(in=a, out=b, out=out);\n}\n",
+		"Outer.hdl": "CHIP Outer {\n    IN in;\n    OUT out;\n\n    PARTS:\n    Loop(in=in, out=out);\n}\n",
+		"Outer.tst": "load Outer.hdl;\nset in 0;\neval;\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "error " + filepath.Join(dir, "Loop.hdl") + ": combinational loop: " +
+		"Not (line 6) -[a]-> Not (line 7) -[b]-> Not (line 6)"
+
+	if _, err := LoadChip(filepath.Join(dir, "Loop.hdl")); err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+
+	// the loop in a part is reported in its file, and not wrapped again by the script
+	err := tst.RunFile(filepath.Join(dir, "Outer.tst"), tst.RunnerOptions{
+		Simulator: NewSimulator(),
+		Out:       io.Discard,
+	})
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
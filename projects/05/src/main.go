@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/nfukaaswa/nand2tetris/05/src/hdl"
+	"github.com/nfukaaswa/nand2tetris/05/src/tst"
+	"github.com/nfukaaswa/nand2tetris/08/src/vmemu"
+)
+
+type opts struct {
+	Inputs []string `short:"i" long:"in" required:"true" description:"input .tst file or directory path"`
+}
+
+func main() {
+	var opts opts
+	if _, err := flags.Parse(&opts); err != nil {
+		return
+	}
+
+	scripts, err := collectScriptFiles(opts.Inputs)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, path := range scripts {
+		if err := runScript(path); err != nil {
+			fmt.Printf("FAIL: %s\n%v\n", path, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("ok: %s\n", path)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runScript(path string) error {
+	script, err := tst.ParseFile(path)
+	if err != nil {
+		return err
+	}
+
+	sim, err := newSimulator(script)
+	if err != nil {
+		return err
+	}
+
+	return tst.Run(path, script, tst.RunnerOptions{
+		Simulator: sim,
+		Echo:      os.Stdout,
+	})
+}
+
+func newSimulator(script *tst.Script) (tst.Simulator, error) {
+	target, _ := script.LoadTarget()
+	switch filepath.Ext(target) {
+	case ".hdl":
+		return hdl.NewSimulator(), nil
+	case ".asm", ".hack":
+		return tst.NewCPUSimulator(), nil
+	case ".vm", "":
+		return vmemu.NewSimulator(vmemu.Options{Natives: vmemu.OSNatives(nil)}), nil
+	default:
+		return nil, fmt.Errorf("unsupported load target: %q", target)
+	}
+}
+
+func collectScriptFiles(inputs []string) ([]string, error) {
+	var scripts []string
+	for _, in := range inputs {
+		info, err := os.Stat(in)
+		if err != nil {
+			return nil, fmt.Errorf("os stat error: %v", err)
+		}
+		if info.IsDir() {
+			filepath.Walk(in, func(path string, info fs.FileInfo, err error) error {
+				if strings.HasSuffix(info.Name(), ".tst") {
+					scripts = append(scripts, path)
+				}
+				return err
+			})
+		}
+		if strings.HasSuffix(info.Name(), ".tst") {
+			scripts = append(scripts, in)
+		}
+	}
+	if len(scripts) == 0 {
+		return nil, fmt.Errorf(".tst file not found in: %v", inputs)
+	}
+	return scripts, nil
+}
@@ -0,0 +1,78 @@
+package tst
+
+import (
+	"fmt"
+
+	"github.com/nfukaaswa/nand2tetris/05/src/cpu"
+)
+
+// CPUSimulator runs test scripts written for the CPU emulator (load Foo.asm / Foo.hack).
+type CPUSimulator struct {
+	CPU *cpu.CPU
+}
+
+func NewCPUSimulator() *CPUSimulator {
+	return &CPUSimulator{CPU: cpu.New()}
+}
+
+func (s *CPUSimulator) Load(path string) error {
+	return s.CPU.LoadFile(path)
+}
+
+func (s *CPUSimulator) Get(name string) (int, error) {
+	ptr, err := s.register(name)
+	if err != nil {
+		return 0, err
+	}
+	return int(int16(*ptr)), nil
+}
+
+func (s *CPUSimulator) Set(name string, value int) error {
+	ptr, err := s.register(name)
+	if err != nil {
+		return err
+	}
+	*ptr = uint16(value)
+	return nil
+}
+
+func (s *CPUSimulator) Eval() error {
+	return nil
+}
+
+// Tick executes one instruction. A whole clock cycle of the CPU emulator is done at the tick phase.
+func (s *CPUSimulator) Tick() error {
+	s.CPU.Step()
+	return nil
+}
+
+func (s *CPUSimulator) Tock() error {
+	return nil
+}
+
+func (s *CPUSimulator) register(v string) (*uint16, error) {
+	name, index, err := SplitVar(v)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "RAM":
+		if index < 0 || index >= cpu.RAMSize {
+			return nil, fmt.Errorf("RAM index out of range: %s", v)
+		}
+		return &s.CPU.RAM[index], nil
+	case "ROM":
+		if index < 0 || index >= cpu.ROMSize {
+			return nil, fmt.Errorf("ROM index out of range: %s", v)
+		}
+		return &s.CPU.ROM[index], nil
+	case "A":
+		return &s.CPU.A, nil
+	case "D":
+		return &s.CPU.D, nil
+	case "PC":
+		return &s.CPU.PC, nil
+	default:
+		return nil, fmt.Errorf("unknown variable: %s", v)
+	}
+}
@@ -0,0 +1,106 @@
+package tst
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Column is an output-list entry such as "RAM[0]%D2.6.2": the variable, the format
+// (B: binary, X: hex, D: decimal, S: string) and the left pad, length and right pad.
+type Column struct {
+	Var      string
+	Format   byte
+	PadLeft  int
+	Len      int
+	PadRight int
+}
+
+func ParseColumn(str string) (Column, error) {
+	pos := strings.IndexByte(str, '%')
+	if pos == -1 {
+		return Column{Var: str, Format: 'D', PadLeft: 1, Len: 6, PadRight: 1}, nil
+	}
+
+	col := Column{Var: str[:pos]}
+	spec := str[pos+1:]
+	if col.Var == "" || len(spec) == 0 {
+		return col, fmt.Errorf("invalid output column: %s", str)
+	}
+
+	col.Format = spec[0]
+	switch col.Format {
+	case 'B', 'X', 'D', 'S':
+	default:
+		return col, fmt.Errorf("invalid output format: %s", str)
+	}
+
+	nums := strings.Split(spec[1:], ".")
+	if len(nums) != 3 {
+		return col, fmt.Errorf("invalid output format: %s", str)
+	}
+	var vals [3]int
+	for i, n := range nums {
+		v, err := strconv.Atoi(n)
+		if err != nil || v < 0 {
+			return col, fmt.Errorf("invalid output format: %s", str)
+		}
+		vals[i] = v
+	}
+	col.PadLeft, col.Len, col.PadRight = vals[0], vals[1], vals[2]
+	return col, nil
+}
+
+func (c Column) width() int {
+	return c.PadLeft + c.Len + c.PadRight
+}
+
+// Header renders the column name centered in the column width.
+func (c Column) Header() string {
+	name := c.Var
+	w := c.width()
+	if len(name) > w {
+		name = name[:w]
+	}
+	left := (w - len(name)) / 2
+	return strings.Repeat(" ", left) + name + strings.Repeat(" ", w-left-len(name))
+}
+
+// Render renders a numeric value in the column format.
+func (c Column) Render(v int) string {
+	var s string
+	switch c.Format {
+	case 'B':
+		s = fixLen(strconv.FormatUint(uint64(uint16(v)), 2), c.Len)
+	case 'X':
+		s = fixLen(strings.ToUpper(strconv.FormatUint(uint64(uint16(v)), 16)), c.Len)
+	case 'S':
+		return c.RenderString(strconv.Itoa(v))
+	default:
+		s = strconv.Itoa(int(int16(v)))
+		if len(s) < c.Len {
+			s = strings.Repeat(" ", c.Len-len(s)) + s
+		}
+	}
+	return c.pad(s)
+}
+
+// RenderString renders a string value left aligned.
+func (c Column) RenderString(s string) string {
+	if len(s) < c.Len {
+		s += strings.Repeat(" ", c.Len-len(s))
+	}
+	return c.pad(s)
+}
+
+func (c Column) pad(s string) string {
+	return strings.Repeat(" ", c.PadLeft) + s + strings.Repeat(" ", c.PadRight)
+}
+
+// fixLen zero-fills s, or keeps only its lowest digits, to make it n characters long.
+func fixLen(s string, n int) string {
+	if len(s) > n {
+		return s[len(s)-n:]
+	}
+	return strings.Repeat("0", n-len(s)) + s
+}
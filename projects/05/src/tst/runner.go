@@ -0,0 +1,408 @@
+package tst
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Simulator is a hardware or software simulator driven by a test script.
+// Variables are given as they are written in the script, such as "RAM[12]", "PC" or "sel".
+// The errors of Load are reported as they are, so they should tell the file and the line.
+type Simulator interface {
+	Load(path string) error
+	Get(name string) (int, error)
+	Set(name string, value int) error
+	Eval() error
+	Tick() error
+	Tock() error
+}
+
+// Commander is implemented by simulators which accept their own commands,
+// such as "vmstep" or "ROM32K load Add.hack".
+type Commander interface {
+	Command(args []string) error
+}
+
+type RunnerOptions struct {
+	Simulator Simulator
+	Out       io.Writer // receives the output instead of the output-file when set
+	Echo      io.Writer // receives echo messages when set
+}
+
+// CompareError reports the first output line which differs from the compare file.
+type CompareError struct {
+	CompareFile string
+	Line        int
+	Column      string
+	Expected    string
+	Actual      string
+}
+
+func (e *CompareError) Error() string {
+	where := fmt.Sprintf("%s:%d", e.CompareFile, e.Line)
+	if e.Column != "" {
+		where += fmt.Sprintf(" (column %s)", e.Column)
+	}
+	return fmt.Sprintf("comparison failure at %s\n  expected: %s\n  actual:   %s", where, e.Expected, e.Actual)
+}
+
+func RunFile(path string, opts RunnerOptions) error {
+	script, err := ParseFile(path)
+	if err != nil {
+		return err
+	}
+	return Run(path, script, opts)
+}
+
+func Run(scriptPath string, script *Script, opts RunnerOptions) error {
+	r := &runner{
+		opts: opts,
+		sim:  opts.Simulator,
+		src:  scriptPath,
+		dir:  filepath.Dir(scriptPath),
+	}
+	defer r.close()
+
+	if err := r.run(script.Commands); err != nil {
+		return err
+	}
+	if r.cmpLine < len(r.cmp) {
+		return &CompareError{
+			CompareFile: r.cmpPath,
+			Line:        r.cmpLine + 1,
+			Expected:    r.cmp[r.cmpLine],
+			Actual:      "(end of output)",
+		}
+	}
+	return nil
+}
+
+type runner struct {
+	opts RunnerOptions
+	sim  Simulator
+	src  string
+	dir  string
+
+	out     io.Writer
+	outFile *os.File
+
+	cmpPath string
+	cmp     []string
+	cmpLine int
+
+	columns []Column
+	header  string
+
+	time     int
+	halfTick bool
+}
+
+func (r *runner) run(cmds []Command) error {
+	for _, cmd := range cmds {
+		if err := r.command(&cmd); err != nil {
+			if _, ok := err.(*CompareError); ok {
+				return err
+			}
+			if _, ok := err.(*scriptError); ok {
+				return err
+			}
+			if cmd.Type == CmdLoad {
+				// the simulators report the errors at the positions in the loaded files
+				return err
+			}
+			return &scriptError{src: r.src, line: cmd.Line, err: err}
+		}
+	}
+	return nil
+}
+
+type scriptError struct {
+	src  string
+	line int
+	err  error
+}
+
+func (e *scriptError) Error() string {
+	return fmt.Sprintf("error %s:%d: %v", e.src, e.line, e.err)
+}
+
+func (e *scriptError) Unwrap() error {
+	return e.err
+}
+
+func (r *runner) command(cmd *Command) error {
+	switch cmd.Type {
+	case CmdLoad:
+		path := r.dir
+		if len(cmd.Args) != 0 {
+			path = r.path(cmd.Args[0])
+		}
+		return r.sim.Load(path)
+
+	case CmdOutputFile:
+		return r.openOutput(cmd.Args[0])
+
+	case CmdCompareTo:
+		return r.loadCompare(cmd.Args[0])
+
+	case CmdOutputList:
+		r.columns = cmd.Columns
+		var names []string
+		for _, c := range r.columns {
+			names = append(names, c.Header())
+		}
+		r.header = "|" + strings.Join(names, "|") + "|"
+		return r.writeLine(r.header)
+
+	case CmdSet:
+		v, err := ParseValue(cmd.Args[1])
+		if err != nil {
+			return err
+		}
+		return r.sim.Set(cmd.Args[0], v)
+
+	case CmdEval:
+		return r.sim.Eval()
+
+	case CmdOutput:
+		return r.output()
+
+	case CmdTick:
+		return r.tick()
+
+	case CmdTock:
+		return r.tock()
+
+	case CmdTickTock:
+		if err := r.tick(); err != nil {
+			return err
+		}
+		return r.tock()
+
+	case CmdRepeat:
+		for i := 0; cmd.Count < 0 || i < cmd.Count; i++ {
+			if err := r.run(cmd.Body); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case CmdWhile:
+		for {
+			ok, err := r.eval(cmd.Condition)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			if err := r.run(cmd.Body); err != nil {
+				return err
+			}
+		}
+
+	case CmdEcho:
+		if r.opts.Echo != nil {
+			fmt.Fprintln(r.opts.Echo, cmd.Args[0])
+		}
+		return nil
+
+	case CmdClearEcho, CmdBreakpoint, CmdClearBreak:
+		// nothing to do without GUI
+		return nil
+
+	case CmdCustom:
+		if c, ok := r.sim.(Commander); ok {
+			return c.Command(cmd.Args)
+		}
+		return fmt.Errorf("unknown command: %s", strings.Join(cmd.Args, " "))
+
+	default:
+		return fmt.Errorf("unknown command: %s", cmd.Type)
+	}
+}
+
+func (r *runner) tick() error {
+	if err := r.sim.Tick(); err != nil {
+		return err
+	}
+	r.halfTick = true
+	return nil
+}
+
+func (r *runner) tock() error {
+	if err := r.sim.Tock(); err != nil {
+		return err
+	}
+	r.time++
+	r.halfTick = false
+	return nil
+}
+
+func (r *runner) timeString() string {
+	s := strconv.Itoa(r.time)
+	if r.halfTick {
+		s += "+"
+	}
+	return s
+}
+
+func (r *runner) output() error {
+	var vals []string
+	for _, c := range r.columns {
+		if c.Var == "time" {
+			vals = append(vals, c.RenderString(r.timeString()))
+			continue
+		}
+		v, err := r.sim.Get(c.Var)
+		if err != nil {
+			return err
+		}
+		vals = append(vals, c.Render(v))
+	}
+	return r.writeLine("|" + strings.Join(vals, "|") + "|")
+}
+
+func (r *runner) eval(cond *Condition) (bool, error) {
+	x, err := r.sim.Get(cond.Var)
+	if err != nil {
+		return false, err
+	}
+	y, err := ParseValue(cond.Value)
+	if err != nil {
+		return false, err
+	}
+	switch cond.Op {
+	case "=":
+		return x == y, nil
+	case "<>":
+		return x != y, nil
+	case "<":
+		return x < y, nil
+	case ">":
+		return x > y, nil
+	case "<=":
+		return x <= y, nil
+	case ">=":
+		return x >= y, nil
+	default:
+		return false, fmt.Errorf("unknown operator: %s", cond.Op)
+	}
+}
+
+func (r *runner) writeLine(line string) error {
+	if r.out != nil {
+		if _, err := io.WriteString(r.out, line+"\n"); err != nil {
+			return err
+		}
+	}
+
+	if r.cmp == nil {
+		return nil
+	}
+	if r.cmpLine >= len(r.cmp) {
+		return &CompareError{
+			CompareFile: r.cmpPath,
+			Line:        r.cmpLine + 1,
+			Expected:    "(end of file)",
+			Actual:      line,
+		}
+	}
+	expected := r.cmp[r.cmpLine]
+	r.cmpLine++
+	if !matchLine(expected, line) {
+		return &CompareError{
+			CompareFile: r.cmpPath,
+			Line:        r.cmpLine,
+			Column:      r.mismatchColumn(expected, line),
+			Expected:    expected,
+			Actual:      line,
+		}
+	}
+	return nil
+}
+
+// matchLine compares an output line with a compare file line, where '*' matches any character.
+func matchLine(expected, actual string) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := 0; i < len(expected); i++ {
+		if expected[i] != '*' && expected[i] != actual[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *runner) mismatchColumn(expected, actual string) string {
+	es := strings.Split(expected, "|")
+	as := strings.Split(actual, "|")
+	for i := 1; i < len(es) && i < len(as) && i <= len(r.columns); i++ {
+		if !matchLine(es[i], as[i]) {
+			return r.columns[i-1].Var
+		}
+	}
+	return ""
+}
+
+func (r *runner) openOutput(name string) error {
+	if r.opts.Out != nil {
+		r.out = r.opts.Out
+		return nil
+	}
+	f, err := os.OpenFile(r.path(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	r.close()
+	r.outFile = f
+	r.out = bufio.NewWriter(f)
+	return nil
+}
+
+func (r *runner) loadCompare(name string) error {
+	r.cmpPath = r.path(name)
+	f, err := os.Open(r.cmpPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r.cmp = []string{}
+	r.cmpLine = 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r.cmp = append(r.cmp, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for len(r.cmp) > 0 && strings.TrimSpace(r.cmp[len(r.cmp)-1]) == "" {
+		r.cmp = r.cmp[:len(r.cmp)-1]
+	}
+	return nil
+}
+
+func (r *runner) close() {
+	if r.outFile == nil {
+		return
+	}
+	if w, ok := r.out.(*bufio.Writer); ok {
+		w.Flush()
+	}
+	r.outFile.Close()
+	r.outFile = nil
+}
+
+func (r *runner) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(r.dir, name)
+}
@@ -0,0 +1,346 @@
+package tst
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Script struct {
+	Commands []Command
+}
+
+type Command struct {
+	Type      CommandType
+	Args      []string
+	Columns   []Column
+	Count     int
+	Condition *Condition
+	Body      []Command
+	Line      int
+}
+
+type Condition struct {
+	Var   string
+	Op    string
+	Value string
+}
+
+type CommandType string
+
+const (
+	CmdLoad       CommandType = "load"
+	CmdOutputFile CommandType = "output-file"
+	CmdCompareTo  CommandType = "compare-to"
+	CmdOutputList CommandType = "output-list"
+	CmdSet        CommandType = "set"
+	CmdEval       CommandType = "eval"
+	CmdOutput     CommandType = "output"
+	CmdTick       CommandType = "tick"
+	CmdTock       CommandType = "tock"
+	CmdTickTock   CommandType = "ticktock"
+	CmdRepeat     CommandType = "repeat"
+	CmdWhile      CommandType = "while"
+	CmdEcho       CommandType = "echo"
+	CmdClearEcho  CommandType = "clear-echo"
+	CmdBreakpoint CommandType = "breakpoint"
+	CmdClearBreak CommandType = "clear-breakpoints"
+
+	// CmdCustom is a simulator specific command such as "vmstep" or "ROM32K load Add.hack".
+	CmdCustom CommandType = "custom"
+)
+
+func ParseFile(path string) (*Script, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(path, file)
+}
+
+func Parse(srcPath string, r io.Reader) (*Script, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := tokenize(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("error %s:%v", srcPath, err)
+	}
+	p := parser{tokens: tokens}
+	cmds, err := p.parseCommands(false)
+	if err != nil {
+		return nil, fmt.Errorf("error %s:%v", srcPath, err)
+	}
+	return &Script{Commands: cmds}, nil
+}
+
+// LoadTarget returns the file name of the first load command, which decides the simulator to run the script.
+func (s *Script) LoadTarget() (string, bool) {
+	for _, cmd := range s.Commands {
+		if cmd.Type == CmdLoad {
+			if len(cmd.Args) == 0 {
+				return "", true
+			}
+			return cmd.Args[0], true
+		}
+	}
+	return "", false
+}
+
+type token struct {
+	value  string
+	quoted bool
+	line   int
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end == -1 {
+				end = len(src) - i
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("%d: comment not closed", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == ',' || c == ';' || c == '{' || c == '}':
+			tokens = append(tokens, token{value: string(c), line: line})
+			i++
+		case c == '"':
+			end := strings.IndexByte(src[i+1:], '"')
+			if end == -1 {
+				return nil, fmt.Errorf("%d: string not closed", line)
+			}
+			tokens = append(tokens, token{value: src[i+1 : i+1+end], quoted: true, line: line})
+			i += end + 2
+		default:
+			start := i
+			for i < len(src) && !strings.ContainsRune(" \t\r\n,;{}\"", rune(src[i])) && !strings.HasPrefix(src[i:], "//") {
+				i++
+			}
+			tokens = append(tokens, token{value: src[start:i], line: line})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+}
+
+func (p *parser) parseCommands(inBlock bool) ([]Command, error) {
+	var cmds []Command
+	for {
+		t := p.top()
+		if t == nil {
+			if inBlock {
+				return nil, fmt.Errorf("unexpected end of script: '}' is expected")
+			}
+			return cmds, nil
+		}
+		if !t.quoted && t.value == "}" {
+			if !inBlock {
+				return nil, fmt.Errorf("%d: unexpected '}'", t.line)
+			}
+			p.pop()
+			return cmds, nil
+		}
+		if !t.quoted && (t.value == "," || t.value == ";") {
+			p.pop()
+			continue
+		}
+
+		cmd, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, *cmd)
+	}
+}
+
+func (p *parser) parseCommand() (*Command, error) {
+	first := p.pop()
+	cmd := Command{Type: CommandType(first.value), Line: first.line}
+
+	var args []string
+	for t := p.top(); t != nil; t = p.top() {
+		if !t.quoted && (t.value == "," || t.value == ";" || t.value == "{" || t.value == "}") {
+			break
+		}
+		args = append(args, p.pop().value)
+	}
+
+	switch cmd.Type {
+	case CmdLoad, CmdOutputFile, CmdCompareTo, CmdEcho:
+		if len(args) > 1 || (len(args) == 0 && cmd.Type != CmdLoad) {
+			return nil, fmt.Errorf("%d: %s command takes 1 argument", cmd.Line, cmd.Type)
+		}
+		cmd.Args = args
+
+	case CmdOutputList:
+		for _, arg := range args {
+			col, err := ParseColumn(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", cmd.Line, err)
+			}
+			cmd.Columns = append(cmd.Columns, col)
+		}
+
+	case CmdSet:
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%d: set command takes 2 arguments", cmd.Line)
+		}
+		cmd.Args = args
+
+	case CmdEval, CmdOutput, CmdTick, CmdTock, CmdTickTock, CmdClearEcho, CmdClearBreak:
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%d: %s command takes no arguments", cmd.Line, cmd.Type)
+		}
+
+	case CmdBreakpoint:
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%d: breakpoint command takes 2 arguments", cmd.Line)
+		}
+		cmd.Args = args
+
+	case CmdRepeat:
+		switch len(args) {
+		case 0:
+			cmd.Count = -1 // forever
+		case 1:
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%d: invalid repeat count: %s", cmd.Line, args[0])
+			}
+			cmd.Count = n
+		default:
+			return nil, fmt.Errorf("%d: repeat command takes 0 or 1 argument", cmd.Line)
+		}
+		body, err := p.parseBlock(&cmd)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Body = body
+
+	case CmdWhile:
+		cond, err := parseCondition(args)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", cmd.Line, err)
+		}
+		cmd.Condition = cond
+		body, err := p.parseBlock(&cmd)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Body = body
+
+	default:
+		cmd.Type = CmdCustom
+		cmd.Args = append([]string{first.value}, args...)
+	}
+
+	return &cmd, nil
+}
+
+func (p *parser) parseBlock(cmd *Command) ([]Command, error) {
+	t := p.pop()
+	if t == nil || t.quoted || t.value != "{" {
+		return nil, fmt.Errorf("%d: '{' is expected after %s", cmd.Line, cmd.Type)
+	}
+	return p.parseCommands(true)
+}
+
+func parseCondition(args []string) (*Condition, error) {
+	// the condition may be written with or without spaces: "a<>0" or "a <> 0"
+	str := strings.Join(args, "")
+	for _, op := range []string{"<>", "<=", ">=", "=", "<", ">"} {
+		pos := strings.Index(str, op)
+		if pos <= 0 {
+			continue
+		}
+		return &Condition{Var: str[:pos], Op: op, Value: str[pos+len(op):]}, nil
+	}
+	return nil, fmt.Errorf("invalid while condition: %s", strings.Join(args, " "))
+}
+
+func (p *parser) top() *token {
+	if len(p.tokens) == 0 {
+		return nil
+	}
+	return &p.tokens[0]
+}
+
+func (p *parser) pop() *token {
+	if len(p.tokens) == 0 {
+		return nil
+	}
+	ret := &p.tokens[0]
+	p.tokens = p.tokens[1:]
+	return ret
+}
+
+// ParseValue parses a script value: decimal (-1), or %B binary, %X hex and %D decimal notations.
+func ParseValue(str string) (int, error) {
+	base := 10
+	if len(str) >= 2 && str[0] == '%' {
+		switch str[1] {
+		case 'B':
+			base = 2
+		case 'X':
+			base = 16
+		case 'D':
+			base = 10
+		default:
+			return 0, fmt.Errorf("invalid value: %s", str)
+		}
+		str = str[2:]
+	}
+	v, err := strconv.ParseInt(str, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value: %s", str)
+	}
+	if base != 10 {
+		v = int64(int16(uint16(v)))
+	}
+	return int(v), nil
+}
+
+// SplitVar splits a variable name like "RAM[12]" into its name and index.
+// The index is -1 when the variable has no index or an empty one ("PC[]").
+func SplitVar(v string) (name string, index int, err error) {
+	pos := strings.IndexByte(v, '[')
+	if pos == -1 {
+		return v, -1, nil
+	}
+	if !strings.HasSuffix(v, "]") {
+		return "", 0, fmt.Errorf("invalid variable: %s", v)
+	}
+	name = v[:pos]
+	idx := v[pos+1 : len(v)-1]
+	if idx == "" {
+		return name, -1, nil
+	}
+	index, err = strconv.Atoi(idx)
+	if err != nil || index < 0 {
+		return "", 0, fmt.Errorf("invalid variable index: %s", v)
+	}
+	return name, index, nil
+}
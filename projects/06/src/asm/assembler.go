@@ -0,0 +1,85 @@
+package asm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// lineBreak separates the codes in the .hack file. The last code has no line break, as hack_asm
+// writes them.
+const lineBreak = "\n"
+
+type Program struct {
+	Codes   []uint16
+	Symbols *SymbolTable
+}
+
+func Assemble(srcPath string, r io.Reader) (*Program, error) {
+	var cmds []Command
+	parser := NewParser(srcPath, r)
+	for {
+		cmd, err := parser.NextCommand()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	symbols := NewSymbolTable()
+
+	// 1st pass: resolve labels
+	var addr uint16
+	for _, cmd := range cmds {
+		if cmd.Type != CmdLabel {
+			addr++
+			continue
+		}
+		if _, ok := symbols.Get(cmd.Label.Label); ok {
+			return nil, fmt.Errorf("error %s:%d: symbol \"%s\" is already defined", srcPath, cmd.Line, cmd.Label.Label)
+		}
+		symbols.DefineLabel(cmd.Label.Label, addr)
+	}
+	if int(addr) > maxAddress+1 {
+		return nil, fmt.Errorf("error %s: program too large: %d instructions", srcPath, addr)
+	}
+
+	// 2nd pass: generate codes
+	codes := make([]uint16, 0, addr)
+	for _, cmd := range cmds {
+		switch cmd.Type {
+		case CmdAddress:
+			v := cmd.Address.Value
+			if sym := cmd.Address.Symbol; sym != "" {
+				var ok bool
+				if v, ok = symbols.Get(sym); !ok {
+					v = symbols.DefineVar(sym)
+				}
+			}
+			codes = append(codes, addressCode(v))
+		case CmdCompute:
+			codes = append(codes, computeCode(cmd.Compute))
+		}
+	}
+
+	return &Program{Codes: codes, Symbols: symbols}, nil
+}
+
+func (p *Program) WriteHack(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i, code := range p.Codes {
+		if i > 0 {
+			if _, err := bw.WriteString(lineBreak); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(bw, "%016b", code); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
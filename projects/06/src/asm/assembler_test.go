@@ -0,0 +1,82 @@
+package asm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAssemble assembles the programs of project 6, and compares the codes with the ones of
+// hack_asm in testdata. The programs without symbols must be assembled into the same codes.
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		srcs []string
+		hack string
+	}{
+		{srcs: []string{"../../add/Add.asm"}, hack: "testdata/Add.hack"},
+		{srcs: []string{"../../max/Max.asm", "../../max/MaxL.asm"}, hack: "testdata/Max.hack"},
+		{srcs: []string{"../../rect/Rect.asm", "../../rect/RectL.asm"}, hack: "testdata/Rect.hack"},
+		{srcs: []string{"../../pong/Pong.asm", "../../pong/PongL.asm"}, hack: "testdata/Pong.hack"},
+	}
+
+	for _, test := range tests {
+		want, err := os.ReadFile(test.hack)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, src := range test.srcs {
+			t.Run(filepath.Base(src), func(t *testing.T) {
+				file, err := os.Open(src)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer file.Close()
+
+				prog, err := Assemble(src, file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var buf bytes.Buffer
+				if err := prog.WriteHack(&buf); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(buf.Bytes(), want) {
+					t.Errorf("output differs from %s", test.hack)
+				}
+			})
+		}
+	}
+}
+
+func TestAssembleSymbols(t *testing.T) {
+	src := `@i
+M=1
+(LOOP)
+@j
+D=M
+@LOOP
+D;JGT
+@i
+@SCREEN
+0;JMP`
+	prog, err := Assemble("Test.asm", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{16, 0xefc8, 17, 0xfc10, 2, 0xe301, 16, 0x4000, 0xea87}
+	if len(prog.Codes) != len(want) {
+		t.Fatalf("got %d codes, want %d", len(prog.Codes), len(want))
+	}
+	for i := range want {
+		if prog.Codes[i] != want[i] {
+			t.Errorf("code %d: got %016b, want %016b", i, prog.Codes[i], want[i])
+		}
+	}
+
+	_, err = Assemble("Test.asm", strings.NewReader("(L)\n@L\n(L)\n0;JMP"))
+	if want := `error Test.asm:3: symbol "L" is already defined`; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,61 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type Command struct {
+	Type    CommandType
+	Address *AddressArgs
+	Compute *ComputeArgs
+	Label   *LabelArgs
+	Line    int
+}
+
+type AddressArgs struct {
+	Symbol string
+	Value  uint16
+}
+
+type ComputeArgs struct {
+	Dest string
+	Comp string
+	Jump string
+}
+
+type LabelArgs struct {
+	Label string
+}
+
+func (c *Command) String() string {
+	switch c.Type {
+	case CmdAddress:
+		if c.Address.Symbol != "" {
+			return "@" + c.Address.Symbol
+		}
+		return "@" + strconv.FormatUint(uint64(c.Address.Value), 10)
+	case CmdCompute:
+		str := c.Compute.Comp
+		if c.Compute.Dest != "" {
+			str = c.Compute.Dest + "=" + str
+		}
+		if c.Compute.Jump != "" {
+			str = str + ";" + c.Compute.Jump
+		}
+		return str
+	case CmdLabel:
+		return fmt.Sprintf("(%s)", c.Label.Label)
+	default:
+		return ""
+	}
+}
+
+type CommandType string
+
+const (
+	CmdNone    CommandType = ""
+	CmdAddress CommandType = "A"
+	CmdCompute CommandType = "C"
+	CmdLabel   CommandType = "L"
+)
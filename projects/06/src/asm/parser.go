@@ -0,0 +1,173 @@
+package asm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Parser struct {
+	scanner *bufio.Scanner
+	src     string
+	line    int
+}
+
+func NewParser(srcPath string, r io.Reader) *Parser {
+	return &Parser{
+		scanner: bufio.NewScanner(r),
+		src:     srcPath,
+		line:    0,
+	}
+}
+
+func (p *Parser) NextCommand() (cmd Command, err error) {
+	code, line, err := p.nextLine()
+	if errors.Is(err, io.EOF) {
+		return cmd, err
+	}
+	if err != nil {
+		return cmd, fmt.Errorf("error %s:%d: %v", p.src, line, err)
+	}
+	cmd, err = p.mapCommand(code)
+	if err != nil {
+		return cmd, fmt.Errorf("error %s:%d: %v", p.src, line, err)
+	}
+	cmd.Line = line
+	return cmd, err
+}
+
+func (p *Parser) nextLine() (code string, line int, err error) {
+	for {
+		p.line++
+		if !p.scanner.Scan() {
+			if err := p.scanner.Err(); err != nil {
+				return "", p.line, err
+			}
+			return "", p.line, io.EOF
+		}
+
+		line := p.scanner.Text()
+		comment := strings.Index(line, "//")
+		if comment != -1 {
+			line = line[0:comment]
+		}
+
+		code = strings.Join(strings.Fields(line), "")
+		if code == "" {
+			continue
+		}
+		break
+	}
+
+	return code, p.line, nil
+}
+
+func (p *Parser) mapCommand(code string) (cmd Command, err error) {
+	switch {
+	case strings.HasPrefix(code, "@"):
+		return p.mapAddressCommand(code[1:])
+	case strings.HasPrefix(code, "("):
+		return p.mapLabelCommand(code[1:])
+	default:
+		return p.mapComputeCommand(code)
+	}
+}
+
+func (p *Parser) mapAddressCommand(value string) (cmd Command, err error) {
+	if value == "" {
+		return cmd, fmt.Errorf("address command takes a value or a symbol")
+	}
+
+	if value[0] >= '0' && value[0] <= '9' {
+		v, err := strconv.ParseUint(value, 10, 16)
+		if err != nil || v > maxAddress {
+			return cmd, fmt.Errorf("invalid address: %s", value)
+		}
+		return Command{
+			Type: CmdAddress,
+			Address: &AddressArgs{
+				Value: uint16(v),
+			},
+		}, nil
+	}
+
+	// validation
+	if err := p.validateSymbol(value); err != nil {
+		return cmd, err
+	}
+
+	return Command{
+		Type: CmdAddress,
+		Address: &AddressArgs{
+			Symbol: value,
+		},
+	}, nil
+}
+
+func (p *Parser) mapLabelCommand(code string) (cmd Command, err error) {
+	if !strings.HasSuffix(code, ")") {
+		return cmd, fmt.Errorf("label command is not closed")
+	}
+	label := strings.TrimSuffix(code, ")")
+
+	// validation
+	if err := p.validateSymbol(label); err != nil {
+		return cmd, err
+	}
+
+	return Command{
+		Type: CmdLabel,
+		Label: &LabelArgs{
+			Label: label,
+		},
+	}, nil
+}
+
+func (p *Parser) mapComputeCommand(code string) (cmd Command, err error) {
+	args := ComputeArgs{}
+
+	if pos := strings.Index(code, ";"); pos != -1 {
+		args.Jump = code[pos+1:]
+		code = code[:pos]
+	}
+	if pos := strings.Index(code, "="); pos != -1 {
+		args.Dest = code[:pos]
+		code = code[pos+1:]
+	}
+	args.Comp = code
+
+	// validations
+	if _, ok := compTable[args.Comp]; !ok {
+		return cmd, fmt.Errorf("unknown comp mnemonic: %s", args.Comp)
+	}
+	if _, ok := destTable[args.Dest]; !ok {
+		return cmd, fmt.Errorf("unknown dest mnemonic: %s", args.Dest)
+	}
+	if _, ok := jumpTable[args.Jump]; !ok {
+		return cmd, fmt.Errorf("unknown jump mnemonic: %s", args.Jump)
+	}
+
+	return Command{
+		Type:    CmdCompute,
+		Compute: &args,
+	}, nil
+}
+
+func (p *Parser) validateSymbol(sym string) error {
+	if sym == "" {
+		return fmt.Errorf("symbol is empty")
+	}
+	for i, c := range sym {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '.' || c == '$' || c == ':' {
+			continue
+		}
+		if i != 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		return fmt.Errorf("symbol \"%s\": invalid char '%c' at %d", sym, c, i)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package asm
+
+import "strconv"
+
+const varBase = 16
+
+var predefinedSymbols = map[string]uint16{
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"SCREEN": 0x4000,
+	"KBD":    0x6000,
+}
+
+func init() {
+	for i := uint16(0); i < 16; i++ {
+		predefinedSymbols["R"+strconv.Itoa(int(i))] = i
+	}
+}
+
+type SymbolTable struct {
+	table   map[string]uint16
+	labels  map[string]uint16
+	nextVar uint16
+}
+
+func NewSymbolTable() *SymbolTable {
+	t := &SymbolTable{
+		table:   map[string]uint16{},
+		labels:  map[string]uint16{},
+		nextVar: varBase,
+	}
+	for sym, addr := range predefinedSymbols {
+		t.table[sym] = addr
+	}
+	return t
+}
+
+func (t *SymbolTable) Define(name string, addr uint16) {
+	t.table[name] = addr
+}
+
+func (t *SymbolTable) DefineLabel(name string, addr uint16) {
+	t.labels[name] = addr
+	t.Define(name, addr)
+}
+
+func (t *SymbolTable) DefineVar(name string) uint16 {
+	addr := t.nextVar
+	t.nextVar++
+	t.Define(name, addr)
+	return addr
+}
+
+func (t *SymbolTable) Get(name string) (uint16, bool) {
+	addr, ok := t.table[name]
+	return addr, ok
+}
+
+func (t *SymbolTable) Label(name string) (uint16, bool) {
+	addr, ok := t.labels[name]
+	return addr, ok
+}
+
+func (t *SymbolTable) Labels() map[string]uint16 {
+	ret := make(map[string]uint16, len(t.labels))
+	for k, v := range t.labels {
+		ret[k] = v
+	}
+	return ret
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/nfukaaswa/nand2tetris/06/src/asm"
+)
+
+type opts struct {
+	Input  string `short:"i" long:"in" required:"true" description:"input .asm file path"`
+	Output string `short:"o" long:"out" required:"true" description:"output .hack file path"`
+}
+
+func main() {
+	var opts opts
+	if _, err := flags.Parse(&opts); err != nil {
+		return
+	}
+
+	var err error
+
+	src, err := os.Open(opts.Input)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer src.Close()
+
+	prog, err := asm.Assemble(opts.Input, src)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	out, err := os.OpenFile(opts.Output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer func() {
+		out.Close()
+		if err != nil {
+			os.Remove(opts.Output)
+		}
+	}()
+
+	if err = prog.WriteHack(out); err != nil {
+		fmt.Println(err)
+		return
+	}
+}
@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nfukaaswa/nand2tetris/05/src/tst"
+)
+
+func TestTranslator(t *testing.T) {
+	dirs := []string{
+		"../../StackArithmetic/SimpleAdd",
+		"../../StackArithmetic/StackTest",
+		"../../MemoryAccess/BasicTest",
+		"../../MemoryAccess/PointerTest",
+		"../../MemoryAccess/StaticTest",
+	}
+
+	for _, dir := range dirs {
+		dir := dir
+		name := filepath.Base(dir)
+		t.Run(name, func(t *testing.T) {
+			tmp := t.TempDir()
+
+			translateDir(t, dir, filepath.Join(tmp, name+".asm"))
+			copyFile(t, filepath.Join(dir, name+".tst"), filepath.Join(tmp, name+".tst"))
+			copyFile(t, filepath.Join(dir, name+".cmp"), filepath.Join(tmp, name+".cmp"))
+
+			err := tst.RunFile(filepath.Join(tmp, name+".tst"), tst.RunnerOptions{
+				Simulator: tst.NewCPUSimulator(),
+				Out:       io.Discard,
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func translateDir(t *testing.T, dir string, out string) {
+	t.Helper()
+
+	w, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	trans, err := NewTranslator(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcs, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range srcs {
+		file, err := os.Open(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ft := trans.File(strings.TrimSuffix(filepath.Base(src), ".vm"))
+		parser := NewParser(src, file)
+		for {
+			cmd, err := parser.NextCommand()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ft.Command(cmd); err != nil {
+				t.Fatal(err)
+			}
+		}
+		file.Close()
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+
+	b, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -11,13 +12,23 @@ import (
 
 	"github.com/jessevdk/go-flags"
 	"github.com/nfukaaswa/nand2tetris/08/src/vm"
+	"github.com/nfukaaswa/nand2tetris/08/src/vm/ir"
 )
 
 type opts struct {
-	Inputs      []string `short:"i" long:"in" required:"true" description:"input file or directory path"`
-	Output      string   `short:"o" long:"out" required:"true" description:"output file or path"`
-	Debug       bool     `short:"d" long:"debug"  description:"enable debug mode"`
-	NoBootstrap bool     `long:"no-bootstrap"  description:"disable bootstrap code"`
+	Inputs            []string `short:"i" long:"in" required:"true" description:"input file or directory path"`
+	Output            string   `short:"o" long:"out" required:"true" description:"output file or path"`
+	Debug             bool     `short:"d" long:"debug"  description:"enable debug mode"`
+	NoBootstrap       bool     `long:"no-bootstrap"  description:"disable bootstrap code"`
+	Optimize          bool     `short:"O" long:"optimize" description:"optimize the assembly code"`
+	SharedRoutines    bool     `long:"shared-routines" description:"share the code of call, return and comparisons"`
+	EliminateDeadCode bool     `long:"eliminate-dead-code" description:"drop the functions never called from Sys.init"`
+	NoValidate        bool     `long:"no-validate" description:"skip the checks of labels and functions before translating"`
+	Passes            []string `long:"pass" choice:"fold" choice:"unreachable" description:"run the pass over the VM code before translating, in the order given"`
+	WriteVM           string   `long:"write-vm" description:"write the VM code after the passes to the directory"`
+	StackReport       bool     `long:"stack-report" description:"report the stack use of the functions"`
+	StackThreshold    int      `long:"stack-threshold" default:"1792" description:"warn when the stack may use more words than this"`
+	SourceMap         bool     `long:"source-map" description:"write the map from ROM addresses to VM commands to <out>.map"`
 }
 
 func main() {
@@ -34,6 +45,32 @@ func main() {
 		return
 	}
 
+	var files []vm.SourceFile
+	for _, src := range srcs {
+		file, err := parseSourceFile(src)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		files = append(files, file)
+	}
+	if !opts.NoValidate {
+		if err := vm.Validate(files, !opts.NoBootstrap); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if len(opts.Passes) > 0 {
+		if files, err = runPasses(files, opts); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if err := analyzeStack(files, opts); err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	out, err := os.OpenFile(opts.Output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		fmt.Println(err)
@@ -46,9 +83,31 @@ func main() {
 		}
 	}()
 
+	var sourceMap io.Writer
+	if opts.SourceMap {
+		mapPath := opts.Output + ".map"
+		var mapFile *os.File
+		mapFile, err = os.OpenFile(mapPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer func() {
+			mapFile.Close()
+			if err != nil {
+				os.Remove(mapPath)
+			}
+		}()
+		sourceMap = mapFile
+	}
+
 	trans, err := vm.NewTranslator(vm.TranslatorOptions{
-		Out:         out,
-		NoBootstrap: opts.NoBootstrap,
+		Out:               out,
+		NoBootstrap:       opts.NoBootstrap,
+		Optimize:          opts.Optimize,
+		SharedRoutines:    opts.SharedRoutines,
+		EliminateDeadCode: opts.EliminateDeadCode,
+		SourceMap:         sourceMap,
 	})
 	if err != nil {
 		fmt.Println(err)
@@ -56,22 +115,83 @@ func main() {
 	}
 	trans.Debug = opts.Debug
 
-	for _, src := range srcs {
-		if err = translateSourceFile(src, trans); err != nil {
+	for _, file := range files {
+		if err = translateSourceFile(file, trans); err != nil {
 			fmt.Println(err)
 			return
 		}
 	}
+	if err = trans.Flush(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if opts.EliminateDeadCode {
+		reportRemoved(trans.Removed())
+	}
+}
+
+func runPasses(files []vm.SourceFile, opts opts) ([]vm.SourceFile, error) {
+	pm := ir.NewPassManager()
+	for _, name := range opts.Passes {
+		p, err := ir.PassByName(name)
+		if err != nil {
+			return nil, err
+		}
+		pm.Add(p)
+	}
+	prog := ir.Build(files)
+	pm.Run(prog)
+
+	if opts.WriteVM != "" {
+		for _, file := range prog.Files {
+			var buf bytes.Buffer
+			if err := file.Write(&buf); err != nil {
+				return nil, err
+			}
+			path := filepath.Join(opts.WriteVM, filepath.Base(file.Path))
+			if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				return nil, err
+			}
+			fmt.Println("out: " + path)
+		}
+	}
+	return prog.SourceFiles(), nil
+}
+
+func analyzeStack(files []vm.SourceFile, opts opts) error {
+	report := vm.AnalyzeStack(files, !opts.NoBootstrap)
+	if opts.StackReport {
+		if err := report.Write(os.Stdout); err != nil {
+			return err
+		}
+	}
+	if report.Total > opts.StackThreshold {
+		bound := "up to"
+		if report.Unbounded {
+			bound = "at least"
+		}
+		fmt.Printf("warning: the stack may use %s %d words from %s, over the threshold %d\n", bound, report.Total, report.Entry, opts.StackThreshold)
+	}
+	return nil
 }
 
-func translateSourceFile(src string, trans *vm.Translator) error {
+func reportRemoved(removed []vm.RemovedFunction) {
+	commands := 0
+	for _, r := range removed {
+		fmt.Printf("removed: %s (%s.vm, %d commands)\n", r.Name, r.File, r.Commands)
+		commands += r.Commands
+	}
+	fmt.Printf("removed %d functions, %d commands\n", len(removed), commands)
+}
+
+func parseSourceFile(src string) (vm.SourceFile, error) {
 	file, err := os.Open(src)
 	if err != nil {
-		return err
+		return vm.SourceFile{}, err
 	}
 	defer file.Close()
 
-	t := trans.File(strings.TrimSuffix(filepath.Base(src), ".vm"))
+	parsed := vm.SourceFile{Path: src}
 	parser := vm.NewParser(src, file)
 	for {
 		cmd, err := parser.NextCommand()
@@ -79,8 +199,16 @@ func translateSourceFile(src string, trans *vm.Translator) error {
 			break
 		}
 		if err != nil {
-			return err
+			return parsed, err
 		}
+		parsed.Commands = append(parsed.Commands, cmd)
+	}
+	return parsed, nil
+}
+
+func translateSourceFile(src vm.SourceFile, trans *vm.Translator) error {
+	t := trans.File(strings.TrimSuffix(filepath.Base(src.Path), ".vm"))
+	for _, cmd := range src.Commands {
 		if err := t.Command(cmd); err != nil {
 			return err
 		}
@@ -10,6 +10,9 @@ type Command struct {
 	Memory     *MemoryArgs
 	Label      *LabelArgs
 	Function   *FunctionArgs
+
+	// Line is the line of the command in the source, which is set by Parser.
+	Line int
 }
 
 type ArithmeticArgs struct {
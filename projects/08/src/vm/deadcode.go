@@ -0,0 +1,88 @@
+package vm
+
+import "sort"
+
+// RemovedFunction is a function dropped by the dead function elimination.
+type RemovedFunction struct {
+	Name     string
+	File     string
+	Commands int
+}
+
+// fileCommand is a command held until Flush, with the file it is read from.
+type fileCommand struct {
+	cmd  Command
+	file *FileTranslator
+}
+
+// Removed returns the functions dropped by Flush, sorted by the name.
+func (t *Translator) Removed() []RemovedFunction {
+	return t.removed
+}
+
+// flushCommands translates the held commands of the functions reachable by call commands from the
+// entry. The entry is Sys.init, or the first function without the bootstrap code. The commands
+// outside of the functions are always kept, and the functions they call are reachable.
+func (t *Translator) flushCommands() error {
+	commands := t.commands
+	t.commands = nil
+
+	// the function of each command, and the functions called from each function
+	funcs := make([]string, len(commands))
+	calls := map[string][]string{}
+	var entry string
+	if !t.noBootstrap {
+		entry = "Sys.init"
+	}
+	files := map[string]string{}
+	for i, c := range commands {
+		if i > 0 && c.file == commands[i-1].file {
+			funcs[i] = funcs[i-1]
+		}
+		switch c.cmd.Type {
+		case CmdFunction:
+			funcs[i] = c.cmd.Function.Name
+			files[funcs[i]] = c.file.fileName
+			if entry == "" {
+				entry = funcs[i]
+			}
+		case CmdCall:
+			calls[funcs[i]] = append(calls[funcs[i]], c.cmd.Function.Name)
+		}
+	}
+
+	reachable := map[string]bool{"": true}
+	queue := append([]string{entry}, calls[""]...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if reachable[name] {
+			continue
+		}
+		reachable[name] = true
+		queue = append(queue, calls[name]...)
+	}
+
+	removed := map[string]*RemovedFunction{}
+	for i, c := range commands {
+		if !reachable[funcs[i]] {
+			r, ok := removed[funcs[i]]
+			if !ok {
+				r = &RemovedFunction{Name: funcs[i], File: files[funcs[i]]}
+				removed[funcs[i]] = r
+			}
+			r.Commands++
+			continue
+		}
+		if err := t.command(c.cmd, c.file); err != nil {
+			return err
+		}
+	}
+
+	t.removed = nil
+	for _, r := range removed {
+		t.removed = append(t.removed, *r)
+	}
+	sort.Slice(t.removed, func(i, j int) bool { return t.removed[i].Name < t.removed[j].Name })
+	return nil
+}
@@ -0,0 +1,66 @@
+package vm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEliminateDeadCode(t *testing.T) {
+	sys := vmSource{"Sys", `
+function Sys.init 0
+call Main.main 0
+label END
+goto END
+`}
+	main := vmSource{"Main", `
+function Main.main 0
+push constant 1
+call Math.abs 1
+return
+function Main.unused 0
+call Math.multiply 2
+return
+`}
+	math := vmSource{"Math", `
+function Math.abs 0
+push argument 0
+call Math.neg 1
+return
+function Math.neg 0
+push argument 0
+neg
+return
+function Math.multiply 0
+push constant 0
+return
+`}
+
+	out, trans := translateSources(t, TranslatorOptions{EliminateDeadCode: true}, sys, main, math)
+
+	for _, label := range []string{"(Sys.init)", "(Main.main)", "(Math.abs)", "(Math.neg)"} {
+		if !strings.Contains(out, label+"\n") {
+			t.Errorf("%s is removed", label)
+		}
+	}
+	for _, label := range []string{"(Main.unused)", "(Math.multiply)"} {
+		if strings.Contains(out, label+"\n") {
+			t.Errorf("%s is not removed", label)
+		}
+	}
+
+	want := []RemovedFunction{
+		{Name: "Main.unused", File: "Main", Commands: 3},
+		{Name: "Math.multiply", File: "Math", Commands: 3},
+	}
+	if got := trans.Removed(); !reflect.DeepEqual(got, want) {
+		t.Errorf("removed:\ngot:  %+v\nwant: %+v", got, want)
+	}
+
+	// without the bootstrap code, the entry is the first function
+	_, trans = translateSources(t, TranslatorOptions{NoBootstrap: true, EliminateDeadCode: true}, math)
+	want = []RemovedFunction{{Name: "Math.multiply", File: "Math", Commands: 3}}
+	if got := trans.Removed(); !reflect.DeepEqual(got, want) {
+		t.Errorf("removed without bootstrap:\ngot:  %+v\nwant: %+v", got, want)
+	}
+}
@@ -0,0 +1,138 @@
+package ir
+
+import (
+	"github.com/nfukaaswa/nand2tetris/08/src/vm"
+)
+
+// ConstantFolding evaluates the arithmetic on the constants in each block, such as push constant 2,
+// push constant 3, add into push constant 5. The negative results are pushed by push constant ^v
+// and not, since push constant takes 0 to 32767 only. An if-goto on a constant becomes a goto, or
+// is dropped with the constant when it is false.
+type ConstantFolding struct{}
+
+func (ConstantFolding) Name() string {
+	return "fold"
+}
+
+func (ConstantFolding) Run(f *Function) bool {
+	changed := false
+	for _, b := range f.Blocks {
+		if cmds, ok := foldConstants(b.Commands); ok {
+			b.Commands = cmds
+			changed = true
+		}
+	}
+	return changed
+}
+
+// constant is a value on the stack pushed by the commands from start.
+type constant struct {
+	value uint16
+	start int
+}
+
+func foldConstants(cmds []vm.Command) ([]vm.Command, bool) {
+	var out []vm.Command
+	var consts []constant // the constants at the top of the stack, pushed by the tail of out
+	changed := false
+
+	for _, cmd := range cmds {
+		n := len(consts)
+		switch {
+		case cmd.Type == vm.CmdPush && cmd.Memory.Segment == vm.SegConstant:
+			consts = append(consts, constant{value: uint16(cmd.Memory.Index), start: len(out)})
+			out = append(out, cmd)
+			continue
+
+		case cmd.Type == vm.CmdArithmetic && isUnary(cmd.Arithmetic.Operation) && n >= 1:
+			x := consts[n-1]
+			v := unaryOp(cmd.Arithmetic.Operation, x.value)
+			// keep the commands unless the constant is shorter, as push constant 0, not is already
+			if code := constantCode(v, out[x.start].Line); len(code) < len(out)-x.start+1 {
+				out = append(out[:x.start], code...)
+				changed = true
+			} else {
+				out = append(out, cmd)
+			}
+			consts[n-1].value = v
+			continue
+
+		case cmd.Type == vm.CmdArithmetic && !isUnary(cmd.Arithmetic.Operation) && n >= 2:
+			x, y := consts[n-2], consts[n-1]
+			v := binaryOp(cmd.Arithmetic.Operation, x.value, y.value)
+			out = append(out[:x.start], constantCode(v, out[x.start].Line)...)
+			consts = append(consts[:n-2], constant{value: v, start: x.start})
+			changed = true
+			continue
+
+		case cmd.Type == vm.CmdIfGoto && n >= 1:
+			x := consts[n-1]
+			out = out[:x.start]
+			if x.value != 0 {
+				out = append(out, vm.Command{Type: vm.CmdGoto, Label: cmd.Label, Line: cmd.Line})
+			}
+			consts = consts[:n-1]
+			changed = true
+			continue
+		}
+		out = append(out, cmd)
+		consts = nil
+	}
+	return out, changed
+}
+
+// constantCode returns the commands pushing the value.
+func constantCode(v uint16, line int) []vm.Command {
+	push := func(v uint16) vm.Command {
+		return vm.Command{
+			Type:   vm.CmdPush,
+			Memory: &vm.MemoryArgs{Segment: vm.SegConstant, Index: uint64(v)},
+			Line:   line,
+		}
+	}
+	if v <= 0x7fff {
+		return []vm.Command{push(v)}
+	}
+	return []vm.Command{
+		push(^v),
+		{Type: vm.CmdArithmetic, Arithmetic: &vm.ArithmeticArgs{Operation: vm.OpNot}, Line: line},
+	}
+}
+
+func isUnary(op vm.ArithmeticOperation) bool {
+	return op == vm.OpNeg || op == vm.OpNot
+}
+
+func unaryOp(op vm.ArithmeticOperation, x uint16) uint16 {
+	if op == vm.OpNeg {
+		return -x
+	}
+	return ^x
+}
+
+// binaryOp computes the operation as the VM emulator does, comparing the values as signed.
+func binaryOp(op vm.ArithmeticOperation, x, y uint16) uint16 {
+	switch op {
+	case vm.OpAdd:
+		return x + y
+	case vm.OpSub:
+		return x - y
+	case vm.OpAnd:
+		return x & y
+	case vm.OpOr:
+		return x | y
+	case vm.OpEq:
+		return boolean(x == y)
+	case vm.OpGt:
+		return boolean(int16(x) > int16(y))
+	default: // vm.OpLt
+		return boolean(int16(x) < int16(y))
+	}
+}
+
+func boolean(b bool) uint16 {
+	if b {
+		return 0xffff
+	}
+	return 0
+}
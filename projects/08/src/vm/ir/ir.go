@@ -0,0 +1,118 @@
+// Package ir holds the VM programs in memory as functions of basic blocks, for the passes which
+// transform them before the translation.
+package ir
+
+import (
+	"github.com/nfukaaswa/nand2tetris/08/src/vm"
+)
+
+// Program is the functions of the VM files, in the order of the files.
+type Program struct {
+	Files []*File
+}
+
+// File is the functions of a VM file. The code before the first function, which runs first without
+// the bootstrap code, is held by a Function with no Name.
+type File struct {
+	Path      string
+	Functions []*Function
+}
+
+// Function is a function of basic blocks. The first block is the entry, and each block falls through
+// to the next one unless it ends with goto or return.
+type Function struct {
+	Name   string
+	Locals uint64
+	Line   int
+	Blocks []*Block
+}
+
+// Block is a basic block, which is entered only at its label, and left only at its last command.
+// The label is not in Commands, and the jumps and the return are only at the end of Commands.
+type Block struct {
+	Label     string // "" for the block entered only by falling through
+	LabelLine int
+	Commands  []vm.Command
+}
+
+// Build splits the commands of the files into the functions and their blocks.
+func Build(files []vm.SourceFile) *Program {
+	prog := &Program{}
+	for _, src := range files {
+		file := &File{Path: src.Path}
+		var f *Function
+		var b *Block
+		for _, cmd := range src.Commands {
+			switch cmd.Type {
+			case vm.CmdFunction:
+				f = &Function{Name: cmd.Function.Name, Locals: cmd.Function.Num, Line: cmd.Line}
+				file.Functions = append(file.Functions, f)
+				b = nil
+				continue
+			case vm.CmdLabel:
+				b = &Block{Label: cmd.Label.Label, LabelLine: cmd.Line}
+			default:
+				if b == nil {
+					b = &Block{}
+				}
+			}
+			if f == nil {
+				f = &Function{Line: cmd.Line}
+				file.Functions = append(file.Functions, f)
+			}
+			if len(f.Blocks) == 0 || f.Blocks[len(f.Blocks)-1] != b {
+				f.Blocks = append(f.Blocks, b)
+			}
+			if cmd.Type == vm.CmdLabel {
+				continue
+			}
+			b.Commands = append(b.Commands, cmd)
+			if cmd.Type == vm.CmdGoto || cmd.Type == vm.CmdIfGoto || cmd.Type == vm.CmdReturn {
+				b = nil
+			}
+		}
+		prog.Files = append(prog.Files, file)
+	}
+	return prog
+}
+
+// Terminator returns the last command of the block if it is a jump or a return.
+func (b *Block) Terminator() *vm.Command {
+	if len(b.Commands) == 0 {
+		return nil
+	}
+	cmd := &b.Commands[len(b.Commands)-1]
+	switch cmd.Type {
+	case vm.CmdGoto, vm.CmdIfGoto, vm.CmdReturn:
+		return cmd
+	}
+	return nil
+}
+
+// Block returns the block of the label, or nil.
+func (f *Function) Block(label string) *Block {
+	for _, b := range f.Blocks {
+		if b.Label != "" && b.Label == label {
+			return b
+		}
+	}
+	return nil
+}
+
+// Successors returns the blocks which the i-th block may go to next.
+func (f *Function) Successors(i int) []*Block {
+	var succs []*Block
+	fallThrough := true
+	if cmd := f.Blocks[i].Terminator(); cmd != nil {
+		if cmd.Type != vm.CmdReturn {
+			if target := f.Block(cmd.Label.Label); target != nil {
+				succs = append(succs, target)
+			}
+		}
+		fallThrough = cmd.Type == vm.CmdIfGoto
+	}
+	if fallThrough && i+1 < len(f.Blocks) {
+		succs = append(succs, f.Blocks[i+1])
+	}
+	return succs
+}
@@ -0,0 +1,107 @@
+package ir
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nfukaaswa/nand2tetris/08/src/vm"
+)
+
+func TestBuild(t *testing.T) {
+	prog := buildProgram(t, `push constant 1
+function Foo.f 2
+push argument 0
+if-goto A
+goto B
+label A
+label B
+push constant 2
+return
+push constant 3
+function Foo.g 0
+return`)
+
+	fs := prog.Files[0].Functions
+	if len(fs) != 3 || fs[0].Name != "" || fs[1].Name != "Foo.f" || fs[1].Locals != 2 || fs[2].Name != "Foo.g" {
+		t.Fatalf("unexpected functions: %+v", fs)
+	}
+
+	var blocks []string
+	for _, b := range fs[1].Blocks {
+		var cmds []string
+		for _, cmd := range b.Commands {
+			cmds = append(cmds, cmd.String())
+		}
+		blocks = append(blocks, b.Label+": "+strings.Join(cmds, ", "))
+	}
+	want := []string{
+		": push argument 0, if-goto A",
+		": goto B",
+		"A: ",
+		"B: push constant 2, return",
+		": push constant 3",
+	}
+	if strings.Join(blocks, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got blocks:\n%s\nwant:\n%s", strings.Join(blocks, "\n"), strings.Join(want, "\n"))
+	}
+
+	succs := func(i int) string {
+		var labels []string
+		for _, b := range fs[1].Successors(i) {
+			labels = append(labels, b.Label)
+		}
+		return strings.Join(labels, " ")
+	}
+	for i, want := range []string{"A ", "B", "B", "", ""} {
+		if got := succs(i); got != want {
+			t.Errorf("successors of block %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	src := `push constant 1
+function Foo.f 2
+label A
+push argument 0
+if-goto A
+goto B
+label B
+return`
+	prog := buildProgram(t, src)
+
+	var buf strings.Builder
+	if err := prog.Files[0].Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != src {
+		t.Errorf("got:\n%s\nwant:\n%s", got, src)
+	}
+
+	// the lines of the source are kept
+	for i, cmd := range prog.SourceFiles()[0].Commands {
+		if cmd.Line != i+1 {
+			t.Errorf("line of '%s': got %d, want %d", cmd.String(), cmd.Line, i+1)
+		}
+	}
+}
+
+func buildProgram(t *testing.T, src string) *Program {
+	t.Helper()
+
+	file := vm.SourceFile{Path: "Foo.vm"}
+	p := vm.NewParser(file.Path, strings.NewReader(src))
+	for {
+		cmd, err := p.NextCommand()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Commands = append(file.Commands, cmd)
+	}
+	return Build([]vm.SourceFile{file})
+}
@@ -0,0 +1,77 @@
+package ir
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Pass transforms the blocks of a function, and reports whether it changed anything. A pass must
+// not change the function forever, since PassManager runs the passes until none of them changes.
+type Pass interface {
+	Name() string
+	Run(f *Function) bool
+}
+
+// passes are the passes selected by the names.
+var passes = map[string]Pass{
+	"fold":        ConstantFolding{},
+	"unreachable": UnreachableCode{},
+}
+
+// PassNames returns the names of the passes which PassByName knows, sorted.
+func PassNames() []string {
+	var names []string
+	for name := range passes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PassByName returns the pass of the name.
+func PassByName(name string) (Pass, error) {
+	p, ok := passes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pass: %s", name)
+	}
+	return p, nil
+}
+
+// PassManager runs the passes in order over each function, until none of them changes it.
+type PassManager struct {
+	passes []Pass
+
+	// Changes is the number of the runs of each pass which changed a function.
+	Changes map[string]int
+}
+
+func NewPassManager(passes ...Pass) *PassManager {
+	return &PassManager{passes: passes, Changes: map[string]int{}}
+}
+
+// Add appends the pass to be run after the others.
+func (pm *PassManager) Add(p Pass) {
+	pm.passes = append(pm.passes, p)
+}
+
+// Run runs the passes over all the functions of the program.
+func (pm *PassManager) Run(prog *Program) {
+	for _, file := range prog.Files {
+		for _, f := range file.Functions {
+			pm.RunFunction(f)
+		}
+	}
+}
+
+// RunFunction runs the passes over the function.
+func (pm *PassManager) RunFunction(f *Function) {
+	for changed := true; changed; {
+		changed = false
+		for _, p := range pm.passes {
+			if p.Run(f) {
+				pm.Changes[p.Name()]++
+				changed = true
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package ir
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nfukaaswa/nand2tetris/08/src/vm"
+	"github.com/nfukaaswa/nand2tetris/08/src/vmemu"
+)
+
+func TestPasses(t *testing.T) {
+	tests := []struct {
+		name   string
+		passes []Pass
+		src    string
+		want   string
+	}{
+		{
+			name:   "add",
+			passes: []Pass{ConstantFolding{}},
+			src:    "push constant 2\npush constant 3\nadd\npop local 0",
+			want:   "push constant 5\npop local 0",
+		},
+		{
+			name:   "nested",
+			passes: []Pass{ConstantFolding{}},
+			src:    "push local 0\npush constant 2\npush constant 5\nsub\npush constant 4\nor\nadd",
+			want:   "push local 0\npush constant 2\nnot\nadd",
+		},
+		{
+			name:   "true is kept",
+			passes: []Pass{ConstantFolding{}},
+			src:    "push constant 0\nnot\npop local 0",
+			want:   "push constant 0\nnot\npop local 0",
+		},
+		{
+			name:   "neg",
+			passes: []Pass{ConstantFolding{}},
+			src:    "push constant 0\nneg\npush constant 5\nneg\nneg",
+			want:   "push constant 0\npush constant 5",
+		},
+		{
+			name:   "compare as signed",
+			passes: []Pass{ConstantFolding{}},
+			src:    "push constant 1\nneg\npush constant 1\nlt\npush constant 7\npush constant 7\neq\npush constant 1\npush constant 2\ngt",
+			want:   "push constant 0\nnot\npush constant 0\nnot\npush constant 0",
+		},
+		{
+			name:   "not across labels",
+			passes: []Pass{ConstantFolding{}},
+			src:    "push constant 1\nlabel L\npush constant 2\nadd",
+			want:   "push constant 1\nlabel L\npush constant 2\nadd",
+		},
+		{
+			name:   "if-goto on constants",
+			passes: []Pass{ConstantFolding{}},
+			src:    "label A\npush constant 0\nnot\nif-goto A\nlabel B\npush constant 0\nif-goto B\npush constant 1",
+			want:   "label A\ngoto A\nlabel B\npush constant 1",
+		},
+		{
+			name:   "after goto and return",
+			passes: []Pass{UnreachableCode{}},
+			src:    "label A\npush local 0\nif-goto B\ngoto A\npush constant 1\nlabel B\nreturn\npush constant 2\nlabel C\ngoto C",
+			want:   "label A\npush local 0\nif-goto B\ngoto A\nlabel B\nreturn",
+		},
+		{
+			name:   "while true",
+			passes: []Pass{ConstantFolding{}, UnreachableCode{}},
+			src:    "label WHILE_EXP0\npush constant 0\nnot\nnot\nif-goto WHILE_END0\ncall Foo.g 0\npop temp 0\ngoto WHILE_EXP0\nlabel WHILE_END0\npush constant 0\nreturn",
+			want:   "label WHILE_EXP0\ncall Foo.g 0\npop temp 0\ngoto WHILE_EXP0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prog := buildProgram(t, "function Foo.f 1\n"+test.src)
+			NewPassManager(test.passes...).Run(prog)
+
+			var buf strings.Builder
+			if err := prog.Files[0].Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			want := "function Foo.f 1\n" + test.want + "\n"
+			if buf.String() != want {
+				t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestPassManager(t *testing.T) {
+	pm := NewPassManager()
+	for _, name := range PassNames() {
+		p, err := PassByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm.Add(p)
+	}
+	if _, err := PassByName("inline"); err == nil {
+		t.Error("unknown pass is not reported")
+	}
+
+	// the programs store the results in the static segment, and halt by the native Sys.halt
+	src := `function Sys.init 0
+push constant 2
+push constant 3
+add
+pop static 0
+push constant 100
+push constant 1000
+sub
+pop static 1
+push constant 3
+neg
+push constant 2
+gt
+pop static 2
+push constant 0
+if-goto SKIP
+push constant 5
+pop static 3
+label SKIP
+push constant 7
+call Sys.double 1
+pop static 4
+call Sys.halt 0
+label END
+goto END
+push constant 9
+pop static 5
+function Sys.double 0
+push argument 0
+push argument 0
+add
+return`
+	prog := buildProgram(t, src)
+	pm.Run(prog)
+	if pm.Changes["fold"] == 0 || pm.Changes["unreachable"] == 0 {
+		t.Errorf("passes did not change the program: %v", pm.Changes)
+	}
+
+	var buf strings.Builder
+	if err := prog.Files[0].Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	before := runProgram(t, src)
+	after := runProgram(t, buf.String())
+	for i := 16; i < 24; i++ {
+		if before.RAM[i] != after.RAM[i] {
+			t.Errorf("RAM[%d]: got %d, want %d", i, after.RAM[i], before.RAM[i])
+		}
+	}
+	if after.Steps >= before.Steps {
+		t.Errorf("steps: got %d, want less than %d", after.Steps, before.Steps)
+	}
+}
+
+func runProgram(t *testing.T, src string) *vmemu.Machine {
+	t.Helper()
+
+	m := vmemu.New(vmemu.Options{Natives: vmemu.OSNatives(nil)})
+	if err := m.Load("Sys", vm.NewParser("Sys.vm", strings.NewReader(src))); err != nil {
+		t.Fatal(err)
+	}
+	m.Reset()
+	if err := m.Run(10000); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Halted {
+		t.Fatal("program does not halt")
+	}
+	return m
+}
@@ -0,0 +1,60 @@
+package ir
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nfukaaswa/nand2tetris/08/src/vm"
+)
+
+// Commands returns the commands of the function, with the function command and the labels.
+func (f *Function) Commands() []vm.Command {
+	var cmds []vm.Command
+	if f.Name != "" {
+		cmds = append(cmds, vm.Command{
+			Type:     vm.CmdFunction,
+			Function: &vm.FunctionArgs{Name: f.Name, Num: f.Locals},
+			Line:     f.Line,
+		})
+	}
+	for _, b := range f.Blocks {
+		if b.Label != "" {
+			cmds = append(cmds, vm.Command{
+				Type:  vm.CmdLabel,
+				Label: &vm.LabelArgs{Label: b.Label},
+				Line:  b.LabelLine,
+			})
+		}
+		cmds = append(cmds, b.Commands...)
+	}
+	return cmds
+}
+
+// Commands returns the commands of the functions of the file.
+func (f *File) Commands() []vm.Command {
+	var cmds []vm.Command
+	for _, fn := range f.Functions {
+		cmds = append(cmds, fn.Commands()...)
+	}
+	return cmds
+}
+
+// SourceFiles returns the commands of the files, to be validated and translated as the parsed ones.
+// The commands keep the lines of the source.
+func (p *Program) SourceFiles() []vm.SourceFile {
+	files := make([]vm.SourceFile, len(p.Files))
+	for i, f := range p.Files {
+		files[i] = vm.SourceFile{Path: f.Path, Commands: f.Commands()}
+	}
+	return files
+}
+
+// Write writes the file as the VM code, which Parser reads back.
+func (f *File) Write(w io.Writer) error {
+	for _, cmd := range f.Commands() {
+		if _, err := fmt.Fprintln(w, cmd.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package ir
+
+// UnreachableCode removes the blocks which are never reached from the entry of the function, such
+// as the code after goto and return without a label, and the loops only entered from such code.
+type UnreachableCode struct{}
+
+func (UnreachableCode) Name() string {
+	return "unreachable"
+}
+
+func (UnreachableCode) Run(f *Function) bool {
+	if len(f.Blocks) == 0 {
+		return false
+	}
+	index := map[*Block]int{}
+	for i, b := range f.Blocks {
+		index[b] = i
+	}
+
+	reached := make([]bool, len(f.Blocks))
+	reached[0] = true
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, succ := range f.Successors(i) {
+			if j := index[succ]; !reached[j] {
+				reached[j] = true
+				work = append(work, j)
+			}
+		}
+	}
+
+	blocks := f.Blocks[:0]
+	for i, b := range f.Blocks {
+		if reached[i] {
+			blocks = append(blocks, b)
+		}
+	}
+	changed := len(blocks) < len(f.Blocks)
+	f.Blocks = blocks
+	return changed
+}
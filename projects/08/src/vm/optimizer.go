@@ -0,0 +1,234 @@
+package vm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Optimize rewrites the assembly with peephole rules, keeping the behavior of the program except for
+// the memory above the stack and the registers R13-R15 between the commands.
+//
+// A value pushed and popped at once is passed in D without touching the stack, and the reloads of
+// @SP whose address is already in A are removed. The labels are the barriers of the rules, since
+// the code may be jumped into at them. The comments of the debug mode are kept.
+func Optimize(asm []string) []string {
+	for {
+		out, changed := rewrite(asm)
+		out, removed := removeReloads(out)
+		if !changed && !removed {
+			return out
+		}
+		asm = out
+	}
+}
+
+var (
+	pushTail = []string{"@SP", "M=M+1", "A=M-1", "M=D"} // *sp=d; sp++
+	popHead  = []string{"@SP", "M=M-1", "A=M", "D=M"}   // sp--; d=*sp
+)
+
+// maxStepIndex is the largest index of a segment whose address is computed by incrementing A in the
+// fused pop, which is shorter than computing it through R13.
+const maxStepIndex = 8
+
+// peepholeRule returns the number of the code lines it replaces with repl, or 0 if it does not match.
+type peepholeRule func(code []string) (n int, repl []string)
+
+var peepholeRules = []peepholeRule{
+	// push x; pop: the value is already in D, and A is set to sp as after the pop.
+	func(code []string) (int, []string) {
+		if hasPrefix(code, concat(pushTail, popHead)) {
+			return len(pushTail) + len(popHead), []string{"@SP", "A=M"}
+		}
+		return 0, nil
+	},
+
+	// push x; pop seg i: the value in D is stored to seg+i, stepping A from the base address.
+	func(code []string) (int, []string) {
+		if !hasPrefix(code, pushTail) || len(code) < len(pushTail)+13 {
+			return 0, nil
+		}
+		pop := code[len(pushTail) : len(pushTail)+13]
+		switch pop[0] {
+		case "@ARG", "@LCL", "@THIS", "@THAT":
+		default:
+			return 0, nil
+		}
+		if !strings.HasPrefix(pop[2], "@") {
+			return 0, nil
+		}
+		index, err := strconv.Atoi(pop[2][1:])
+		if err != nil || index > maxStepIndex {
+			return 0, nil
+		}
+		if !hasPrefix(pop, []string{pop[0], "D=M", pop[2], "D=D+A", "@R13", "M=D", "@SP", "M=M-1", "A=M", "D=M", "@R13", "A=M", "M=D"}) {
+			return 0, nil
+		}
+		repl := []string{pop[0], "A=M"}
+		for i := 0; i < index; i++ {
+			repl = append(repl, "A=A+1")
+		}
+		return len(pushTail) + 13, append(repl, "M=D")
+	},
+
+	// @SP; A=M; A=A-1
+	func(code []string) (int, []string) {
+		if hasPrefix(code, []string{"@SP", "A=M", "A=A-1"}) {
+			return 3, []string{"@SP", "A=M-1"}
+		}
+		return 0, nil
+	},
+
+	// @SP; A=M; @x: A is overwritten.
+	func(code []string) (int, []string) {
+		if hasPrefix(code, []string{"@SP", "A=M"}) && len(code) > 2 && strings.HasPrefix(code[2], "@") {
+			return 2, nil
+		}
+		return 0, nil
+	},
+}
+
+// rewrite applies the rules once from the top. The comments in a replaced window are moved before
+// the replacement.
+func rewrite(asm []string) ([]string, bool) {
+	var out []string
+	changed := false
+	for i := 0; i < len(asm); {
+		if isComment(asm[i]) {
+			out = append(out, asm[i])
+			i++
+			continue
+		}
+
+		// the code lines from i, and the line index after each of them
+		var code []string
+		var ends []int
+		for j := i; j < len(asm) && len(code) < 32; j++ {
+			if !isComment(asm[j]) {
+				code = append(code, asm[j])
+				ends = append(ends, j+1)
+			}
+		}
+
+		matched := false
+		for _, rule := range peepholeRules {
+			n, repl := rule(code)
+			if n == 0 {
+				continue
+			}
+			end := ends[n-1]
+			for _, line := range asm[i:end] {
+				if isComment(line) {
+					out = append(out, line)
+				}
+			}
+			out = append(out, repl...)
+			i = end
+			matched, changed = true, true
+			break
+		}
+		if !matched {
+			out = append(out, asm[i])
+			i++
+		}
+	}
+	return out, changed
+}
+
+// what A holds, relative to the stack pointer
+const (
+	addrUnknown = iota
+	addrSP      // A = SP
+	addrTop     // A = *SP-1
+	addrFree    // A = *SP
+)
+
+// removeReloads removes "@SP; A=M-1" and "@SP; A=M" which set A to the address it already holds.
+func removeReloads(asm []string) ([]string, bool) {
+	var out []string
+	removed := false
+	addr := addrUnknown
+	for i := 0; i < len(asm); i++ {
+		line := asm[i]
+		switch {
+		case isComment(line):
+
+		case strings.HasPrefix(line, "("):
+			addr = addrUnknown
+
+		case line == "@SP":
+			if next := nextCode(asm, i+1); next > 0 {
+				if asm[next] == "A=M-1" && addr == addrTop || asm[next] == "A=M" && addr == addrFree {
+					out = append(out, asm[i+1:next]...)
+					i = next
+					removed = true
+					continue
+				}
+			}
+			addr = addrSP
+
+		case strings.HasPrefix(line, "@"):
+			addr = addrUnknown
+
+		default:
+			dest := ""
+			comp := line
+			if eq := strings.Index(line, "="); eq >= 0 {
+				dest, comp = line[:eq], line[eq+1:]
+			}
+			if semi := strings.Index(comp, ";"); semi >= 0 {
+				comp = comp[:semi]
+			}
+			if strings.Contains(dest, "A") {
+				addr = nextAddr(addr, dest, comp)
+			}
+		}
+		out = append(out, line)
+	}
+	return out, removed
+}
+
+// nextAddr returns what A holds after A is assigned comp.
+func nextAddr(addr int, dest, comp string) int {
+	if strings.Contains(dest, "M") {
+		return addrUnknown
+	}
+	switch {
+	case addr == addrSP && comp == "M-1":
+		return addrTop
+	case addr == addrSP && comp == "M":
+		return addrFree
+	case addr == addrFree && comp == "A-1":
+		return addrTop
+	case addr == addrTop && comp == "A+1":
+		return addrFree
+	default:
+		return addrUnknown
+	}
+}
+
+// nextCode returns the index of the code line from i, or -1 if there is none.
+func nextCode(asm []string, i int) int {
+	for ; i < len(asm); i++ {
+		if !isComment(asm[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isComment(line string) bool {
+	return strings.HasPrefix(line, "//")
+}
+
+func hasPrefix(code, prefix []string) bool {
+	if len(code) < len(prefix) {
+		return false
+	}
+	for i, s := range prefix {
+		if code[i] != s {
+			return false
+		}
+	}
+	return true
+}
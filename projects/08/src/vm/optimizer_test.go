@@ -0,0 +1,64 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "push and pop",
+			src:  "push local 0\npop local 1",
+			want: []string{"@LCL", "D=M", "@0", "A=D+A", "D=M", "@LCL", "A=M", "A=A+1", "M=D"},
+		},
+		{
+			name: "push and pop static",
+			src:  "push constant 7\npop static 2",
+			want: []string{"@7", "D=A", "@Foo.2", "M=D"},
+		},
+		{
+			name: "push and add",
+			src:  "push constant 1\nadd",
+			want: []string{"@1", "D=A", "@SP", "A=M-1", "M=M+D"},
+		},
+		{
+			name: "push and if-goto",
+			src:  "push argument 0\nif-goto LOOP",
+			want: []string{"@ARG", "D=M", "@0", "A=D+A", "D=M", "@$LOOP", "D;JNE"},
+		},
+		{
+			name: "reload of @SP",
+			src:  "add\nnot",
+			want: []string{"@SP", "M=M-1", "A=M", "D=M", "A=A-1", "M=M+D", "M=!M"},
+		},
+		{
+			name: "label is a barrier",
+			src:  "push constant 1\nlabel L\nnot",
+			want: []string{"@1", "D=A", "@SP", "M=M+1", "A=M-1", "M=D", "($L)", "@SP", "A=M-1", "M=!M"},
+		},
+		{
+			name: "large index",
+			src:  "push constant 1\npop that 20",
+			want: []string{
+				"@1", "D=A", "@SP", "M=M+1", "A=M-1", "M=D",
+				"@THAT", "D=M", "@20", "D=D+A", "@R13", "M=D", "@SP", "M=M-1", "A=M", "D=M", "@R13", "A=M", "M=D",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, _ := translateSources(t, TranslatorOptions{NoBootstrap: true, Optimize: true}, vmSource{"Foo", test.src})
+
+			got := strings.Fields(out)
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, " "), strings.Join(test.want, " "))
+			}
+		})
+	}
+}
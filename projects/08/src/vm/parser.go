@@ -35,6 +35,7 @@ func (p *Parser) NextCommand() (cmd Command, err error) {
 	if err != nil {
 		return cmd, fmt.Errorf("error %s:%d: %v", p.src, line, err)
 	}
+	cmd.Line = line
 	return cmd, err
 }
 
@@ -0,0 +1,71 @@
+package vm
+
+import "sort"
+
+// The shared routines are jumped to from the commands with the arguments in the registers, and
+// jump back to the return address. The names start with "$$", which the VM labels do not.
+const (
+	routinePrefix = "$$"
+
+	// $$call takes the function in R13, the number of the arguments in R14, and the return address
+	// in R15.
+	routineCall = routinePrefix + "call"
+
+	// $$return is the return command itself, and does not come back.
+	routineReturn = routinePrefix + "return"
+)
+
+func (t *Translator) useRoutine(name string) {
+	if t.routines == nil {
+		t.routines = map[string]bool{}
+	}
+	t.routines[name] = true
+}
+
+// sharedRoutines returns the code of the used routines in the order of their names. They are placed
+// after a loop, which stops a program running off the end of its code, as it does on the empty ROM.
+func (t *Translator) sharedRoutines() []string {
+	var names []string
+	for name := range t.routines {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	const end = routinePrefix + "end"
+	asm := concat(t.mark(SourceMapEntry{Function: end}), []string{"(" + end + ")", "@" + end, "0;JMP"})
+	for _, name := range names {
+		asm = concat(asm, t.mark(SourceMapEntry{Function: name}), []string{"(" + name + ")"})
+		switch name {
+		case routineCall:
+			asm = append(asm, t.callRoutine()...)
+		case routineReturn:
+			asm = append(asm, t.returnFrame()...)
+		default: // $$eq, $$gt and $$lt take the return address in D
+			op := ArithmeticOperation(name[len(routinePrefix):])
+			asm = concat(asm,
+				[]string{"@R15", "M=D"}, // R15 = return-address
+				t.compare(op, name+".END"),
+				[]string{"@R15", "A=M", "0;JMP"}, // goto R15
+			)
+		}
+	}
+	return asm
+}
+
+func (t *Translator) callRoutine() []string {
+	return concat(
+		[]string{"@R15", "D=M", "@SP", "M=M+1", "A=M-1", "M=D"},     // push return-address
+		t.push(&MemoryArgs{Segment: SegLocal, Label: "SP"}, nil),    // push LCL
+		t.push(&MemoryArgs{Segment: SegArgument, Label: "SP"}, nil), // push ARG
+		t.push(&MemoryArgs{Segment: SegThis, Label: "SP"}, nil),     // push THIS
+		t.push(&MemoryArgs{Segment: SegThat, Label: "SP"}, nil),     // push THAT
+		[]string{
+			"@R14", "D=M", "@5", "D=D+A", "@SP", "D=M-D", t.reservedSegPos(SegArgument), "M=D", // ARG = SP-n-5
+			"@SP", "D=M", t.reservedSegPos(SegLocal), "M=D", // LCL = SP
+			"@R13", "A=M", "0;JMP", // goto f
+		},
+	)
+}
@@ -0,0 +1,120 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SourceMapEntry maps the ROM addresses from Address up to the next entry to the VM command at Line
+// of File in Function. The code which is not translated from a command, such as the bootstrap code
+// and the shared routines, has no File, and its name as Function.
+type SourceMapEntry struct {
+	Address  int
+	File     string
+	Line     int
+	Function string
+}
+
+// SourceMap is the entries sorted by the address. It is written as a line per entry, with the
+// address, the file ("-" for none), the line and the function separated by tabs.
+type SourceMap []SourceMapEntry
+
+// Lookup returns the entry of the code at address.
+func (m SourceMap) Lookup(address int) (SourceMapEntry, bool) {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Address > address })
+	if i == 0 {
+		return SourceMapEntry{}, false
+	}
+	return m[i-1], true
+}
+
+func (m SourceMap) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range m {
+		file := e.File
+		if file == "" {
+			file = "-"
+		}
+		fmt.Fprintf(bw, "%d\t%s\t%d\t%s\n", e.Address, file, e.Line, e.Function)
+	}
+	return bw.Flush()
+}
+
+// ReadSourceMap reads the map written by SourceMap.Write. path is only used for the errors.
+func ReadSourceMap(path string, r io.Reader) (SourceMap, error) {
+	var m SourceMap
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("error %s:%d: invalid entry", path, line)
+		}
+		address, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("error %s:%d: invalid address: %v", path, line, err)
+		}
+		vmLine, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("error %s:%d: invalid line: %v", path, line, err)
+		}
+		e := SourceMapEntry{Address: address, File: fields[1], Line: vmLine, Function: fields[3]}
+		if e.File == "-" {
+			e.File = ""
+		}
+		if len(m) > 0 && m[len(m)-1].Address > address {
+			return nil, fmt.Errorf("error %s:%d: address not sorted", path, line)
+		}
+		m = append(m, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+const markPrefix = "//@"
+
+// mark returns the comment marking the code after it as e, if the source map is written.
+func (t *Translator) mark(e SourceMapEntry) []string {
+	if t.sourceMap == nil {
+		return nil
+	}
+	t.marks = append(t.marks, e)
+	return []string{markPrefix + strconv.Itoa(len(t.marks)-1)}
+}
+
+// resolveMarks removes the marks from asm, adding their entries with the addresses of the code.
+// An entry without code is replaced by the next one at the same address.
+func (t *Translator) resolveMarks(asm []string) []string {
+	out := asm[:0:0]
+	for _, line := range asm {
+		switch {
+		case strings.HasPrefix(line, markPrefix):
+			i, _ := strconv.Atoi(line[len(markPrefix):])
+			e := t.marks[i]
+			e.Address = t.address
+			if n := len(t.entries); n > 0 && t.entries[n-1].Address == e.Address {
+				t.entries = t.entries[:n-1]
+			}
+			t.entries = append(t.entries, e)
+			continue
+		case isComment(line), strings.HasPrefix(line, "("):
+		default:
+			t.address++
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+func (t *Translator) writeSourceMap() error {
+	if t.sourceMap == nil {
+		return nil
+	}
+	t.marks = nil
+	return t.entries.Write(t.sourceMap)
+}
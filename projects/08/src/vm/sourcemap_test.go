@@ -0,0 +1,85 @@
+package vm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	sys := vmSource{"Sys", `function Sys.init 0
+call Main.main 0
+label END
+goto END
+`}
+	main := vmSource{"Main", `function Main.main 1
+push constant 1
+pop local 0
+push local 0
+push constant 2
+eq
+return
+`}
+
+	variants := []struct {
+		name string
+		opts TranslatorOptions
+	}{
+		{"default", TranslatorOptions{}},
+		{"optimized", TranslatorOptions{Optimize: true}},
+		{"shared-optimized", TranslatorOptions{SharedRoutines: true, Optimize: true}},
+	}
+	for _, variant := range variants {
+		opts, name := variant.opts, variant.name
+		var sourceMap bytes.Buffer
+		opts.SourceMap = &sourceMap
+		out, _ := translateSources(t, opts, sys, main)
+		if strings.Contains(out, markPrefix) {
+			t.Fatalf("%s: the marks are left:\n%s", name, out)
+		}
+
+		m, err := ReadSourceMap("test.map", &sourceMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the address of each label is mapped to the first command with code after it
+		labels := map[string]SourceMapEntry{
+			"(Sys.init)":     {File: "Sys.vm", Line: 2, Function: "Sys.init"},
+			"(Sys.init$END)": {File: "Sys.vm", Line: 4, Function: "Sys.init"},
+			"(Main.main)":    {File: "Main.vm", Line: 1, Function: "Main.main"},
+		}
+		address := 0
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			if want, ok := labels[line]; ok {
+				want.Address = address
+				if got, _ := m.Lookup(address); got != want {
+					t.Errorf("%s: %s: got %+v, want %+v", name, line, got, want)
+				}
+			}
+			if !strings.HasPrefix(line, "(") && !strings.HasPrefix(line, "//") {
+				address++
+			}
+		}
+
+		if got, _ := m.Lookup(0); got.Function != "$$bootstrap" {
+			t.Errorf("%s: address 0: got %+v", name, got)
+		}
+		if _, ok := m.Lookup(-1); ok {
+			t.Errorf("%s: address -1 is found", name)
+		}
+
+		var buf bytes.Buffer
+		if err := m.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		m2, err := ReadSourceMap("test.map", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Errorf("%s: round trip:\ngot:  %+v\nwant: %+v", name, m2, m)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// StackBase and StackEnd are the range of the RAM for the stack. The heap starts at StackEnd.
+const (
+	StackBase = 256
+	StackEnd  = 2048
+)
+
+// frameSize is the number of the words pushed by a call command besides the arguments.
+const frameSize = 5
+
+// FunctionStack is the stack use of a function. Depth is the maximum depth of its working stack
+// on the frame, and Total is the worst case of the words used from its locals through the calls,
+// which is a lower bound when Unbounded.
+type FunctionStack struct {
+	Name   string
+	Path   string
+	Line   int
+	Locals int
+	Depth  int
+	Total  int
+
+	// Recursive marks a function in a cycle of the calls, and Unbounded marks a function which
+	// reaches a recursive one.
+	Recursive bool
+	Unbounded bool
+}
+
+// StackReport is the result of AnalyzeStack.
+type StackReport struct {
+	Functions []FunctionStack // sorted by the name
+
+	// Entry is the function the program starts from, and Total is the worst case of the words used
+	// from StackBase, including the frame of the bootstrap code.
+	Entry     string
+	Total     int
+	Unbounded bool
+
+	// Problems holds the labels reached with different depths and the stack underflows.
+	Problems ValidationErrors
+}
+
+// callSite is a call command, with the depth of the stack before it, including the arguments.
+type callSite struct {
+	callee string
+	depth  int
+}
+
+type stackFunction struct {
+	FunctionStack
+	calls []callSite
+	done  bool
+}
+
+// AnalyzeStack computes the depths of the stack along all the paths of each function, and the
+// worst case through the call graph from the entry, which is Sys.init, or the first function
+// without the bootstrap code. The code outside of the functions is not analyzed.
+func AnalyzeStack(files []SourceFile, bootstrap bool) *StackReport {
+	r := &StackReport{}
+	funcs := map[string]*stackFunction{}
+	var names []string
+
+	for _, file := range files {
+		for start := 0; start < len(file.Commands); start++ {
+			cmd := file.Commands[start]
+			if cmd.Type != CmdFunction {
+				continue
+			}
+			end := start + 1
+			for end < len(file.Commands) && file.Commands[end].Type != CmdFunction {
+				end++
+			}
+			f := r.analyzeFunction(file.Path, file.Commands[start:end])
+			if _, ok := funcs[f.Name]; !ok {
+				funcs[f.Name] = f
+				names = append(names, f.Name)
+			}
+			start = end - 1
+		}
+	}
+	if bootstrap {
+		r.Entry = "Sys.init"
+	} else if len(names) > 0 {
+		r.Entry = names[0]
+	}
+
+	markRecursion(funcs, names)
+	for _, name := range names {
+		stackTotal(funcs, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		r.Functions = append(r.Functions, funcs[name].FunctionStack)
+	}
+	if f, ok := funcs[r.Entry]; ok {
+		r.Total, r.Unbounded = f.Total, f.Unbounded
+		if bootstrap {
+			r.Total += frameSize
+		}
+	}
+	order := map[string]int{}
+	for i, file := range files {
+		order[file.Path] = i
+	}
+	sort.SliceStable(r.Problems, func(i, j int) bool {
+		if r.Problems[i].Path != r.Problems[j].Path {
+			return order[r.Problems[i].Path] < order[r.Problems[j].Path]
+		}
+		return r.Problems[i].Line < r.Problems[j].Line
+	})
+	return r
+}
+
+// analyzeFunction follows the paths of the commands of a function, from the function command.
+func (r *StackReport) analyzeFunction(path string, cmds []Command) *stackFunction {
+	f := &stackFunction{FunctionStack: FunctionStack{
+		Name:   cmds[0].Function.Name,
+		Path:   path,
+		Line:   cmds[0].Line,
+		Locals: int(cmds[0].Function.Num),
+	}}
+	problem := func(cmd Command, format string, a ...interface{}) {
+		r.Problems = append(r.Problems, &ValidationError{Path: path, Line: cmd.Line, Msg: fmt.Sprintf(format, a...)})
+	}
+
+	labels := map[string]int{}
+	for i, cmd := range cmds {
+		if cmd.Type == CmdLabel {
+			labels[cmd.Label.Label] = i
+		}
+	}
+
+	type state struct{ i, depth int }
+	depths := make([]int, len(cmds))
+	for i := range depths {
+		depths[i] = -1
+	}
+	reported := map[int]bool{}
+	underflow := false
+	work := []state{{1, 0}}
+	for len(work) > 0 {
+		s := work[len(work)-1]
+		work = work[:len(work)-1]
+		if s.i >= len(cmds) {
+			continue // runs off the end of the function
+		}
+		if d := depths[s.i]; d >= 0 {
+			if d != s.depth && !reported[s.i] {
+				problem(cmds[s.i], "inconsistent stack depth at '%s': %d and %d", cmds[s.i].String(), d, s.depth)
+				reported[s.i] = true
+			}
+			continue
+		}
+		depths[s.i] = s.depth
+
+		cmd := cmds[s.i]
+		next := []int{s.i + 1}
+		depth := s.depth
+		switch cmd.Type {
+		case CmdPush:
+			depth++
+		case CmdPop:
+			depth--
+		case CmdArithmetic:
+			if op := cmd.Arithmetic.Operation; op != OpNeg && op != OpNot {
+				depth--
+			}
+		case CmdGoto, CmdIfGoto:
+			target, ok := labels[cmd.Label.Label]
+			if cmd.Type == CmdGoto {
+				next = nil
+			} else {
+				depth--
+			}
+			if ok {
+				next = append(next, target)
+			}
+		case CmdCall:
+			f.calls = append(f.calls, callSite{callee: cmd.Function.Name, depth: depth})
+			depth += 1 - int(cmd.Function.Num)
+		case CmdReturn:
+			depth--
+			next = nil
+		}
+
+		if depth < 0 {
+			if !underflow {
+				problem(cmd, "stack underflow at '%s' in function '%s'", cmd.String(), f.Name)
+				underflow = true
+			}
+			depth = 0
+		}
+		if depth > f.Depth {
+			f.Depth = depth
+		}
+		for _, i := range next {
+			work = append(work, state{i, depth})
+		}
+	}
+	return f
+}
+
+// markRecursion marks the functions in the cycles of the calls, finding the strongly connected
+// components by Tarjan's algorithm.
+func markRecursion(funcs map[string]*stackFunction, names []string) {
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+
+	var visit func(name string)
+	visit = func(name string) {
+		index[name] = len(index)
+		low[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+
+		for _, call := range funcs[name].calls {
+			if _, ok := funcs[call.callee]; !ok {
+				continue
+			}
+			if call.callee == name {
+				funcs[name].Recursive = true
+			}
+			if _, ok := index[call.callee]; !ok {
+				visit(call.callee)
+				if low[call.callee] < low[name] {
+					low[name] = low[call.callee]
+				}
+			} else if onStack[call.callee] && index[call.callee] < low[name] {
+				low[name] = index[call.callee]
+			}
+		}
+
+		if low[name] == index[name] {
+			i := len(stack) - 1
+			for stack[i] != name {
+				i--
+			}
+			component := stack[i:]
+			stack = stack[:i]
+			for _, n := range component {
+				onStack[n] = false
+				if len(component) > 1 {
+					funcs[n].Recursive = true
+				}
+			}
+		}
+	}
+	for _, name := range names {
+		if _, ok := index[name]; !ok {
+			visit(name)
+		}
+	}
+}
+
+// stackTotal computes the total of the function. The calls back into the functions being computed
+// add nothing, which makes the totals lower bounds. The calls to the undefined functions count
+// their frames only.
+func stackTotal(funcs map[string]*stackFunction, name string) {
+	f := funcs[name]
+	if f.done {
+		return
+	}
+	f.done = true
+
+	total := f.Depth
+	f.Unbounded = f.Recursive
+	for _, call := range f.calls {
+		use := call.depth + frameSize
+		if callee, ok := funcs[call.callee]; ok {
+			stackTotal(funcs, call.callee)
+			use += callee.Total
+			f.Unbounded = f.Unbounded || callee.Unbounded
+		}
+		if use > total {
+			total = use
+		}
+	}
+	f.Total = f.Locals + total
+}
+
+// Write writes the table of the functions, the problems, and the worst case of the program.
+func (r *StackReport) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "function\tlocals\tdepth\ttotal")
+	for _, f := range r.Functions {
+		total := fmt.Sprint(f.Total)
+		if f.Unbounded {
+			total = ">=" + total
+		}
+		name := f.Name
+		if f.Recursive {
+			name += " (recursive)"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", name, f.Locals, f.Depth, total)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, p := range r.Problems {
+		if _, err := fmt.Fprintf(w, "warning %s:%d: %s\n", p.Path, p.Line, p.Msg); err != nil {
+			return err
+		}
+	}
+	if r.Entry != "" {
+		bound := "at most"
+		if r.Unbounded {
+			bound = "at least"
+		}
+		if _, err := fmt.Fprintf(w, "stack: %s uses %s %d words of %d\n", r.Entry, bound, r.Total, StackEnd-StackBase); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package vm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeStack(t *testing.T) {
+	sys := vmSource{"Sys", `function Sys.init 0
+push constant 1
+push constant 2
+call Main.add 2
+pop temp 0
+call Main.fact 0
+pop temp 0
+label END
+goto END
+`}
+	main := vmSource{"Main", `function Main.add 1
+push argument 0
+push argument 1
+add
+pop local 0
+push local 0
+push local 0
+push local 0
+add
+add
+return
+function Main.fact 0
+push argument 0
+if-goto REC
+push constant 1
+return
+label REC
+push argument 0
+push argument 0
+push constant 1
+sub
+call Main.fact 1
+call Main.add 2
+return
+`}
+	bad := vmSource{"Bad", `function Bad.f 0
+push constant 0
+if-goto L
+push constant 1
+label L
+return
+function Bad.g 0
+pop temp 0
+push constant 0
+return
+`}
+
+	r := AnalyzeStack(parseSources(t, sys, main, bad), true)
+
+	// Main.add: locals 1, depth 3
+	// Main.fact: depth 3, and the calls at depth 3 (fact) and 2 (add: 2+5+4)
+	// Sys.init: the call of add at depth 2 (2+5+4), and of fact at depth 0 (0+5+fact)
+	want := []FunctionStack{
+		{Name: "Bad.f", Path: "Bad.vm", Line: 1, Depth: 1, Total: 1},
+		{Name: "Bad.g", Path: "Bad.vm", Line: 7, Depth: 1, Total: 1},
+		{Name: "Main.add", Path: "Main.vm", Line: 1, Locals: 1, Depth: 3, Total: 4},
+		{Name: "Main.fact", Path: "Main.vm", Line: 12, Depth: 3, Total: 11, Recursive: true, Unbounded: true},
+		{Name: "Sys.init", Path: "Sys.vm", Line: 1, Depth: 2, Total: 16, Unbounded: true},
+	}
+	if !reflect.DeepEqual(r.Functions, want) {
+		t.Errorf("functions:\ngot:  %+v\nwant: %+v", r.Functions, want)
+	}
+	if r.Entry != "Sys.init" || r.Total != 21 || !r.Unbounded {
+		t.Errorf("entry: got %s %d %v, want Sys.init 21 true", r.Entry, r.Total, r.Unbounded)
+	}
+
+	var out bytes.Buffer
+	if err := r.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	wantOut := `function               locals  depth  total
+Bad.f                  0       1      1
+Bad.g                  0       1      1
+Main.add               1       3      4
+Main.fact (recursive)  0       3      >=11
+Sys.init               0       2      >=16
+warning Bad.vm:5: inconsistent stack depth at 'label L': 0 and 1
+warning Bad.vm:6: stack underflow at 'return' in function 'Bad.f'
+warning Bad.vm:8: stack underflow at 'pop temp 0' in function 'Bad.g'
+stack: Sys.init uses at least 21 words of 1792
+`
+	if out.String() != wantOut {
+		t.Errorf("report:\ngot:\n%s\nwant:\n%s", out.String(), wantOut)
+	}
+}
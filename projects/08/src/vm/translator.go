@@ -12,17 +12,59 @@ type Translator struct {
 	out        io.Writer
 	labelIndex int64
 	Debug      bool
+
+	// optimize buffers the code in asm, which is optimized and written by Flush.
+	optimize bool
+	asm      []string
+
+	// shared replaces call, return and the comparisons with jumps to the shared routines, and
+	// routines holds the ones used by the code.
+	shared   bool
+	routines map[string]bool
+
+	// eliminate holds the commands until Flush, which drops the functions never called.
+	eliminate   bool
+	noBootstrap bool
+	commands    []fileCommand
+	removed     []RemovedFunction
+
+	// sourceMap receives the map written by Flush. The code is marked with the comments indexing
+	// marks, which are resolved to the ROM addresses and removed on writing.
+	sourceMap io.Writer
+	marks     []SourceMapEntry
+	entries   SourceMap
+	address   int
 }
 
 type TranslatorOptions struct {
 	Out         io.Writer
 	NoBootstrap bool
+	Optimize    bool
+
+	// SharedRoutines emits call, return, eq, gt and lt once as routines, which the commands jump to.
+	// It shrinks the code at the cost of a few instructions per command.
+	SharedRoutines bool
+
+	// EliminateDeadCode drops the functions which are not reachable from the entry by call commands.
+	// The dropped ones are reported by Removed.
+	EliminateDeadCode bool
+
+	// SourceMap receives the map from the ROM addresses to the VM commands, if it is not nil.
+	SourceMap io.Writer
 }
 
 func NewTranslator(opts TranslatorOptions) (*Translator, error) {
-	t := &Translator{out: opts.Out}
+	t := &Translator{
+		out:         opts.Out,
+		optimize:    opts.Optimize,
+		shared:      opts.SharedRoutines,
+		eliminate:   opts.EliminateDeadCode,
+		noBootstrap: opts.NoBootstrap,
+		sourceMap:   opts.SourceMap,
+	}
 	if !opts.NoBootstrap {
-		if err := t.writeAsm(t.bootstrap()...); err != nil {
+		asm := append(t.mark(SourceMapEntry{Function: "$$bootstrap"}), t.bootstrap()...)
+		if err := t.writeAsm(asm...); err != nil {
 			return nil, err
 		}
 	}
@@ -64,12 +106,51 @@ func (t *Translator) command(cmd Command, file *FileTranslator) error {
 	if t.Debug {
 		asm = append([]string{"// " + cmd.String()}, asm...)
 	}
+	if file != nil {
+		asm = append(t.mark(SourceMapEntry{File: file.fileName + ".vm", Line: cmd.Line, Function: file.curFuncName}), asm...)
+	}
 
 	return t.writeAsm(asm...)
 }
 
+// Flush writes the held commands without the dead functions, the shared routines used by the code,
+// the buffered code with the optimization, and the source map. It must be called after the last
+// command.
+func (t *Translator) Flush() error {
+	if t.eliminate {
+		if err := t.flushCommands(); err != nil {
+			return err
+		}
+	}
+
+	asm := t.sharedRoutines()
+	t.routines = nil
+	if t.optimize {
+		asm = Optimize(append(t.asm, asm...))
+		t.asm = nil
+	}
+	if err := t.write(asm); err != nil {
+		return err
+	}
+	return t.writeSourceMap()
+}
+
 func (t *Translator) writeAsm(ops ...string) error {
-	_, err := io.Copy(t.out, bytes.NewBufferString(strings.Join(ops, "\n")+"\n"))
+	if t.optimize {
+		t.asm = append(t.asm, ops...)
+		return nil
+	}
+	return t.write(ops)
+}
+
+func (t *Translator) write(asm []string) error {
+	if t.sourceMap != nil {
+		asm = t.resolveMarks(asm)
+	}
+	if len(asm) == 0 {
+		return nil
+	}
+	_, err := io.Copy(t.out, bytes.NewBufferString(strings.Join(asm, "\n")+"\n"))
 	return err
 }
 
@@ -126,8 +207,21 @@ func (t *Translator) arith2Args(op ArithmeticOperation) []string {
 }
 
 func (t *Translator) arithCmp(op ArithmeticOperation, file *FileTranslator) []string {
-	label := t.uniqueLabel("CMP")
+	if t.shared {
+		name := routinePrefix + string(op)
+		t.useRoutine(name)
+		retAddr := t.uniqueLabel("RET")
+		return []string{
+			"@" + retAddr, "D=A", // d=return-address
+			"@" + name, "0;JMP", // goto $$op
+			"(" + retAddr + ")", // (return-address)
+		}
+	}
+	return t.compare(op, t.uniqueLabel("CMP"))
+}
 
+// compare replaces x and y on the stack with cmp(x, y), using label as the jump target.
+func (t *Translator) compare(op ArithmeticOperation, label string) []string {
 	var cmd string
 	switch op {
 	case OpEq:
@@ -276,6 +370,14 @@ func (t *Translator) function(args *FunctionArgs, file *FileTranslator) []string
 }
 
 func (t *Translator) ret(file *FileTranslator) []string {
+	if t.shared {
+		t.useRoutine(routineReturn)
+		return []string{"@" + routineReturn, "0;JMP"} // goto $$return
+	}
+	return t.returnFrame()
+}
+
+func (t *Translator) returnFrame() []string {
 	const framePos = "@14"
 	const retPos = "@15"
 
@@ -310,6 +412,17 @@ func (t *Translator) popFrame(framePos string, seg MemorySegment) []string {
 func (t *Translator) call(args *FunctionArgs, file *FileTranslator) []string {
 	retAddr := t.uniqueLabel("RET")
 
+	if t.shared {
+		t.useRoutine(routineCall)
+		return []string{
+			"@" + args.Name, "D=A", "@R13", "M=D", // R13 = f
+			"@" + toStr(args.Num), "D=A", "@R14", "M=D", // R14 = n
+			"@" + retAddr, "D=A", "@R15", "M=D", // R15 = return-address
+			"@" + routineCall, "0;JMP", // goto $$call
+			"(" + retAddr + ")", // (return-address)
+		}
+	}
+
 	return concat(
 		t.push(&MemoryArgs{Segment: SegConstant, Label: retAddr}, file), // push return-address
 		t.push(&MemoryArgs{Segment: SegLocal, Label: "SP"}, file),       // push LCL
@@ -342,6 +455,10 @@ func (t *FileTranslator) Command(cmd Command) error {
 	if t == nil {
 		return nil
 	}
+	if t.translator.eliminate {
+		t.translator.commands = append(t.translator.commands, fileCommand{cmd: cmd, file: t})
+		return nil
+	}
 	return t.translator.command(cmd, t)
 }
 
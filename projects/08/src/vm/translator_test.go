@@ -0,0 +1,157 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nfukaaswa/nand2tetris/05/src/tst"
+)
+
+func TestTranslator(t *testing.T) {
+	dirs := []string{
+		"../../ProgramFlow/BasicLoop",
+		"../../ProgramFlow/FibonacciSeries",
+		"../../FunctionCalls/SimpleFunction",
+		"../../FunctionCalls/NestedCall",
+		"../../FunctionCalls/FibonacciElement",
+		"../../FunctionCalls/StaticsTest",
+		"../../../07/StackArithmetic/SimpleAdd",
+		"../../../07/StackArithmetic/StackTest",
+		"../../../07/MemoryAccess/BasicTest",
+		"../../../07/MemoryAccess/PointerTest",
+		"../../../07/MemoryAccess/StaticTest",
+	}
+
+	variants := []struct {
+		name string
+		opts TranslatorOptions
+	}{
+		{"", TranslatorOptions{}},
+		{"/optimized", TranslatorOptions{Optimize: true}},
+		{"/shared", TranslatorOptions{SharedRoutines: true}},
+		{"/shared-optimized", TranslatorOptions{SharedRoutines: true, Optimize: true}},
+		{"/eliminated", TranslatorOptions{EliminateDeadCode: true}},
+	}
+	for _, variant := range variants {
+		for _, dir := range dirs {
+			testTranslateDir(t, dir, variant.name, variant.opts)
+		}
+	}
+}
+
+func testTranslateDir(t *testing.T, dir string, variant string, opts TranslatorOptions) {
+	name := filepath.Base(dir)
+	t.Run(name+variant, func(t *testing.T) {
+		tmp := t.TempDir()
+
+		// programs with Sys.vm are run from the bootstrap code
+		_, err := os.Stat(filepath.Join(dir, "Sys.vm"))
+		opts.NoBootstrap = err != nil
+
+		translateDir(t, dir, filepath.Join(tmp, name+".asm"), opts)
+		copyFile(t, filepath.Join(dir, name+".tst"), filepath.Join(tmp, name+".tst"))
+		copyFile(t, filepath.Join(dir, name+".cmp"), filepath.Join(tmp, name+".cmp"))
+
+		err = tst.RunFile(filepath.Join(tmp, name+".tst"), tst.RunnerOptions{
+			Simulator: tst.NewCPUSimulator(),
+			Out:       io.Discard,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// translateDir translates the .vm files in dir to out, checking them with Validate first.
+func translateDir(t *testing.T, dir string, out string, opts TranslatorOptions) {
+	t.Helper()
+
+	srcs, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []vmSource
+	for _, src := range srcs {
+		b, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, vmSource{strings.TrimSuffix(filepath.Base(src), ".vm"), string(b)})
+	}
+	if err := Validate(parseSources(t, sources...), !opts.NoBootstrap); err != nil {
+		t.Fatal(err)
+	}
+
+	asm, _ := translateSources(t, opts, sources...)
+	if err := os.WriteFile(out, []byte(asm), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+
+	b, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type vmSource struct {
+	file string
+	src  string
+}
+
+func parseSources(t *testing.T, sources ...vmSource) []SourceFile {
+	t.Helper()
+
+	var files []SourceFile
+	for _, source := range sources {
+		file := SourceFile{Path: source.file + ".vm"}
+		parser := NewParser(file.Path, strings.NewReader(source.src))
+		for {
+			cmd, err := parser.NextCommand()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Commands = append(file.Commands, cmd)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// translateSources translates the sources in the order, and returns the code and the translator.
+func translateSources(t *testing.T, opts TranslatorOptions, sources ...vmSource) (string, *Translator) {
+	t.Helper()
+
+	var out bytes.Buffer
+	opts.Out = &out
+	trans, err := NewTranslator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range parseSources(t, sources...) {
+		ft := trans.File(strings.TrimSuffix(file.Path, ".vm"))
+		for _, cmd := range file.Commands {
+			if err := ft.Command(cmd); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := trans.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), trans
+}
@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SourceFile is the commands parsed from a VM file.
+type SourceFile struct {
+	Path     string
+	Commands []Command
+}
+
+// ValidationError is a problem of a command found by Validate. The problems of the whole program
+// have no Path.
+type ValidationError struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return "error: " + e.Msg
+	}
+	return fmt.Sprintf("error %s:%d: %s", e.Path, e.Line, e.Msg)
+}
+
+// ValidationErrors is the errors sorted by the position, with the ones of the whole program last.
+type ValidationErrors []*ValidationError
+
+func (es ValidationErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate checks the commands of the whole program before the translation. It reports the labels
+// undefined or defined twice in the scope of a function, the calls to undefined functions, the
+// functions defined twice, and the code outside of the functions. Without the bootstrap code, the
+// code before the first function of the first file is allowed, since the program starts there.
+// With the bootstrap code, Sys.init must be defined.
+func Validate(files []SourceFile, bootstrap bool) error {
+	var errs ValidationErrors
+	report := func(path string, line int, format string, a ...interface{}) {
+		errs = append(errs, &ValidationError{Path: path, Line: line, Msg: fmt.Sprintf(format, a...)})
+	}
+
+	type definition struct {
+		path string
+		line int
+	}
+	type reference struct {
+		definition
+		scope string
+		name  string
+	}
+	functions := map[string]definition{}
+	labels := map[string]definition{} // by the scoped label
+	var calls, jumps []reference
+
+	for i, file := range files {
+		scope := ""
+		for _, cmd := range file.Commands {
+			pos := definition{path: file.Path, line: cmd.Line}
+			switch cmd.Type {
+			case CmdFunction:
+				scope = cmd.Function.Name
+				if prev, ok := functions[scope]; ok {
+					report(file.Path, cmd.Line, "duplicate function '%s', previously defined at %s:%d", scope, prev.path, prev.line)
+					continue
+				}
+				functions[scope] = pos
+				continue
+			case CmdCall:
+				calls = append(calls, reference{definition: pos, scope: scope, name: cmd.Function.Name})
+			case CmdLabel:
+				key := scope + "$" + cmd.Label.Label
+				if prev, ok := labels[key]; ok {
+					report(file.Path, cmd.Line, "duplicate label '%s', previously defined at %s:%d", cmd.Label.Label, prev.path, prev.line)
+				} else {
+					labels[key] = pos
+				}
+			case CmdGoto, CmdIfGoto:
+				jumps = append(jumps, reference{definition: pos, scope: scope, name: cmd.Label.Label})
+			}
+
+			if scope == "" && (bootstrap || i > 0) {
+				report(file.Path, cmd.Line, "'%s' outside of a function", cmd.String())
+			}
+		}
+	}
+
+	for _, call := range calls {
+		if _, ok := functions[call.name]; !ok {
+			report(call.path, call.line, "call to undefined function '%s'", call.name)
+		}
+	}
+	for _, jump := range jumps {
+		if _, ok := labels[jump.scope+"$"+jump.name]; !ok {
+			if jump.scope == "" {
+				report(jump.path, jump.line, "undefined label '%s'", jump.name)
+			} else {
+				report(jump.path, jump.line, "undefined label '%s' in function '%s'", jump.name, jump.scope)
+			}
+		}
+	}
+	if _, ok := functions["Sys.init"]; bootstrap && !ok {
+		report("", 0, "function 'Sys.init' is not defined, which the bootstrap code calls")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	order := map[string]int{"": len(files)}
+	for i, file := range files {
+		order[file.Path] = i
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Path != errs[j].Path {
+			return order[errs[i].Path] < order[errs[j].Path]
+		}
+		return errs[i].Line < errs[j].Line
+	})
+	return errs
+}
@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		sources   []vmSource
+		bootstrap bool
+		want      []string
+	}{
+		{
+			name: "valid",
+			sources: []vmSource{
+				{"Sys", "function Sys.init 0\ncall Main.main 0\nlabel END\ngoto END\n"},
+				{"Main", "function Main.main 0\nlabel END\npush constant 0\nif-goto END\nreturn\n"},
+			},
+			bootstrap: true,
+		},
+		{
+			name: "labels",
+			sources: []vmSource{
+				{"Main", "function Main.main 0\nlabel L\nlabel L\ngoto M\nreturn\nfunction Main.f 0\nif-goto L\nlabel M\nreturn\n"},
+			},
+			want: []string{
+				"error Main.vm:3: duplicate label 'L', previously defined at Main.vm:2",
+				"error Main.vm:4: undefined label 'M' in function 'Main.main'",
+				"error Main.vm:7: undefined label 'L' in function 'Main.f'",
+			},
+		},
+		{
+			name: "functions",
+			sources: []vmSource{
+				{"Main", "function Main.main 0\ncall Foo.bar 2\nreturn\n"},
+				{"Foo", "function Main.main 0\nreturn\n"},
+			},
+			bootstrap: true,
+			want: []string{
+				"error Main.vm:2: call to undefined function 'Foo.bar'",
+				"error Foo.vm:1: duplicate function 'Main.main', previously defined at Main.vm:1",
+				"error: function 'Sys.init' is not defined, which the bootstrap code calls",
+			},
+		},
+		{
+			name: "code outside of functions",
+			sources: []vmSource{
+				{"Main", "push constant 1\nlabel L\ngoto L\nfunction Main.main 0\nreturn\n"},
+				{"Foo", "pop temp 0\n"},
+			},
+			want: []string{
+				"error Foo.vm:1: 'pop temp 0' outside of a function",
+			},
+		},
+		{
+			name: "code outside of functions with bootstrap",
+			sources: []vmSource{
+				{"Sys", "push constant 1\nfunction Sys.init 0\nreturn\n"},
+			},
+			bootstrap: true,
+			want: []string{
+				"error Sys.vm:1: 'push constant 1' outside of a function",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(parseSources(t, test.sources...), test.bootstrap)
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Errorf("unexpected errors:\n%v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no errors, want:\n%s", strings.Join(test.want, "\n"))
+			}
+			if err.Error() != strings.Join(test.want, "\n") {
+				t.Errorf("got:\n%v\nwant:\n%s", err, strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,484 @@
+package vmemu
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nfukaaswa/nand2tetris/08/src/vm"
+)
+
+const (
+	RAMSize      = 0x8000
+	ScreenBase   = 0x4000
+	ScreenSize   = 0x2000
+	KeyboardAddr = 0x6000
+
+	SP   = 0
+	LCL  = 1
+	ARG  = 2
+	THIS = 3
+	THAT = 4
+
+	tempBase   = 5
+	staticBase = 16
+	staticEnd  = 256
+	stackBase  = 256
+)
+
+// Native is a function implemented in Go, which is called instead of the VM function of the same name.
+// args are the arguments pushed by the caller, and the returned value is pushed back.
+type Native func(m *Machine, args []uint16) (uint16, error)
+
+type Options struct {
+	// Natives are looked up by the function names before the loaded functions.
+	Natives map[string]Native
+}
+
+// Machine interprets VM commands directly. The RAM layout follows the standard mapping of the
+// VM on the Hack platform, so the programs behave the same as the translated ones.
+type Machine struct {
+	RAM    [RAMSize]uint16
+	PC     int // index of the next command
+	Steps  uint64
+	Halted bool
+
+	natives   map[string]Native
+	code      []instr
+	functions map[string]int
+	statics   map[string]int // file name -> base address of its static segment
+	nextStat  int
+	depth     int // number of the frames called in the machine
+}
+
+type instr struct {
+	cmd      vm.Command
+	file     string
+	function string
+	static   int // base address of the static segment of the file
+	target   int // command index of the label for goto and if-goto
+}
+
+func New(opts Options) *Machine {
+	return &Machine{
+		natives:   opts.Natives,
+		functions: map[string]int{},
+		statics:   map[string]int{},
+		nextStat:  staticBase,
+	}
+}
+
+// Load reads all the commands of the file. fileName is the file name without .vm,
+// which names the static segment.
+func (m *Machine) Load(fileName string, p *vm.Parser) error {
+	start := len(m.code)
+	labels := map[string]int{}
+	function := ""
+	maxStatic := -1
+
+	for {
+		cmd, err := p.NextCommand()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch cmd.Type {
+		case vm.CmdFunction:
+			function = cmd.Function.Name
+			if _, ok := m.functions[function]; ok {
+				return fmt.Errorf("error %s.vm: function %s is already defined", fileName, function)
+			}
+			m.functions[function] = len(m.code)
+		case vm.CmdLabel:
+			label := function + "$" + cmd.Label.Label
+			if _, ok := labels[label]; ok {
+				return fmt.Errorf("error %s.vm: label %s is already defined in %s", fileName, cmd.Label.Label, function)
+			}
+			labels[label] = len(m.code)
+		case vm.CmdPush, vm.CmdPop:
+			if cmd.Memory.Segment == vm.SegStatic && int(cmd.Memory.Index) > maxStatic {
+				maxStatic = int(cmd.Memory.Index)
+			}
+		}
+		m.code = append(m.code, instr{cmd: cmd, file: fileName, function: function})
+	}
+
+	base, ok := m.statics[fileName]
+	if !ok {
+		base = m.nextStat
+		m.statics[fileName] = base
+	}
+	if end := base + maxStatic + 1; end > m.nextStat {
+		if end > staticEnd {
+			return fmt.Errorf("error %s.vm: too many static variables", fileName)
+		}
+		m.nextStat = end
+	}
+
+	for i := start; i < len(m.code); i++ {
+		in := &m.code[i]
+		in.static = base
+		if in.cmd.Type != vm.CmdGoto && in.cmd.Type != vm.CmdIfGoto {
+			continue
+		}
+		target, ok := labels[in.function+"$"+in.cmd.Label.Label]
+		if !ok {
+			return fmt.Errorf("error %s.vm: label %s is not defined in %s", fileName, in.cmd.Label.Label, in.function)
+		}
+		in.target = target
+	}
+	return nil
+}
+
+// LoadFiles loads the .vm files and the .vm files in the directories, and resets the machine.
+func (m *Machine) LoadFiles(inputs []string) error {
+	srcs, err := collectSourceFiles(inputs)
+	if err != nil {
+		return err
+	}
+	for _, src := range srcs {
+		if err := m.loadFile(src); err != nil {
+			return err
+		}
+	}
+	m.Reset()
+	return nil
+}
+
+func (m *Machine) loadFile(src string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return m.Load(strings.TrimSuffix(filepath.Base(src), ".vm"), vm.NewParser(src, file))
+}
+
+// Reset starts the program over like the VM emulator: the stack starts at 256, and the program
+// starts from Sys.init when it exists, or from the first command otherwise.
+// Sys.init is entered with a frame like the bootstrap code "call Sys.init 0", so LCL and ARG
+// point into the stack, and the machine halts when Sys.init returns.
+// The rest of the RAM is kept, so the segments can be set up before running.
+func (m *Machine) Reset() {
+	m.PC = 0
+	m.RAM[SP] = stackBase
+	m.Steps = 0
+	m.Halted = len(m.code) == 0
+	m.depth = 0
+	if _, ok := m.functions["Sys.init"]; ok {
+		// the frame always fits in the empty stack
+		_ = m.call("Sys.init", 0)
+		m.depth = 0
+	}
+}
+
+// Function returns the name of the function which is running.
+func (m *Machine) Function() string {
+	if m.PC >= len(m.code) {
+		return ""
+	}
+	return m.code[m.PC].function
+}
+
+// Command returns the command to run next.
+func (m *Machine) Command() (vm.Command, bool) {
+	if m.PC >= len(m.code) {
+		return vm.Command{}, false
+	}
+	return m.code[m.PC].cmd, true
+}
+
+func (m *Machine) SetKey(key uint16) {
+	m.RAM[KeyboardAddr] = key
+}
+
+// Run runs the commands until the machine halts or maxSteps commands are run.
+func (m *Machine) Run(maxSteps uint64) error {
+	for i := uint64(0); i < maxSteps && !m.Halted; i++ {
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step runs a command. Labels are skipped without taking a step, as the VM emulator does.
+// The machine halts when it runs out of the commands, when the outermost function returns,
+// or when a native function such as Sys.halt halts it.
+func (m *Machine) Step() error {
+	if m.Halted {
+		return nil
+	}
+	for m.PC < len(m.code) && m.code[m.PC].cmd.Type == vm.CmdLabel {
+		m.PC++
+	}
+	if m.PC >= len(m.code) {
+		m.Halted = true
+		return nil
+	}
+
+	in := &m.code[m.PC]
+	m.PC++
+	m.Steps++
+	if err := m.exec(in); err != nil {
+		return fmt.Errorf("error %s.vm: %s: %s: %v", in.file, in.function, in.cmd.String(), err)
+	}
+	return nil
+}
+
+func (m *Machine) exec(in *instr) error {
+	cmd := &in.cmd
+	switch cmd.Type {
+	case vm.CmdArithmetic:
+		return m.arithmetic(cmd.Arithmetic.Operation)
+	case vm.CmdPush:
+		v, err := m.read(in, cmd.Memory)
+		if err != nil {
+			return err
+		}
+		return m.push(v)
+	case vm.CmdPop:
+		addr, err := m.address(in, cmd.Memory)
+		if err != nil {
+			return err
+		}
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		m.RAM[addr] = v
+		return nil
+	case vm.CmdLabel:
+		return nil
+	case vm.CmdGoto:
+		m.PC = in.target
+		return nil
+	case vm.CmdIfGoto:
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if v != 0 {
+			m.PC = in.target
+		}
+		return nil
+	case vm.CmdFunction:
+		for i := uint64(0); i < cmd.Function.Num; i++ {
+			if err := m.push(0); err != nil {
+				return err
+			}
+		}
+		return nil
+	case vm.CmdCall:
+		return m.call(cmd.Function.Name, int(cmd.Function.Num))
+	case vm.CmdReturn:
+		return m.ret()
+	default:
+		return fmt.Errorf("unknown command type: %v", cmd.Type)
+	}
+}
+
+func (m *Machine) arithmetic(op vm.ArithmeticOperation) error {
+	switch op {
+	case vm.OpNeg, vm.OpNot:
+		sp := int(m.RAM[SP])
+		if sp <= stackBase || sp > ScreenBase {
+			return fmt.Errorf("stack underflow")
+		}
+		if op == vm.OpNeg {
+			m.RAM[sp-1] = -m.RAM[sp-1]
+		} else {
+			m.RAM[sp-1] = ^m.RAM[sp-1]
+		}
+		return nil
+	}
+
+	y, err := m.pop()
+	if err != nil {
+		return err
+	}
+	x, err := m.pop()
+	if err != nil {
+		return err
+	}
+	var v uint16
+	switch op {
+	case vm.OpAdd:
+		v = x + y
+	case vm.OpSub:
+		v = x - y
+	case vm.OpAnd:
+		v = x & y
+	case vm.OpOr:
+		v = x | y
+	case vm.OpEq:
+		v = boolean(x == y)
+	case vm.OpGt:
+		v = boolean(int16(x) > int16(y))
+	case vm.OpLt:
+		v = boolean(int16(x) < int16(y))
+	default:
+		return fmt.Errorf("unknown arithmetic operation: %v", op)
+	}
+	return m.push(v)
+}
+
+func boolean(b bool) uint16 {
+	if b {
+		return 0xffff
+	}
+	return 0
+}
+
+func (m *Machine) read(in *instr, args *vm.MemoryArgs) (uint16, error) {
+	if args.Segment == vm.SegConstant {
+		if args.Index > 0x7fff {
+			return 0, fmt.Errorf("constant %d is too large", args.Index)
+		}
+		return uint16(args.Index), nil
+	}
+	addr, err := m.address(in, args)
+	if err != nil {
+		return 0, err
+	}
+	return m.RAM[addr], nil
+}
+
+// address returns the RAM address of the segment entry.
+func (m *Machine) address(in *instr, args *vm.MemoryArgs) (int, error) {
+	var addr int
+	switch args.Segment {
+	case vm.SegLocal:
+		addr = int(m.RAM[LCL]) + int(args.Index)
+	case vm.SegArgument:
+		addr = int(m.RAM[ARG]) + int(args.Index)
+	case vm.SegThis:
+		addr = int(m.RAM[THIS]) + int(args.Index)
+	case vm.SegThat:
+		addr = int(m.RAM[THAT]) + int(args.Index)
+	case vm.SegPointer:
+		addr = THIS + int(args.Index)
+	case vm.SegTemp:
+		addr = tempBase + int(args.Index)
+	case vm.SegStatic:
+		addr = in.static + int(args.Index)
+	default:
+		return 0, fmt.Errorf("unknown memory segment: %v", args.Segment)
+	}
+	if addr >= RAMSize {
+		return 0, fmt.Errorf("address %d is out of the RAM", addr)
+	}
+	return addr, nil
+}
+
+func (m *Machine) push(v uint16) error {
+	sp := m.RAM[SP]
+	if sp >= ScreenBase {
+		return fmt.Errorf("stack overflow")
+	}
+	m.RAM[sp] = v
+	m.RAM[SP] = sp + 1
+	return nil
+}
+
+func (m *Machine) pop() (uint16, error) {
+	sp := m.RAM[SP]
+	if sp <= stackBase || sp > ScreenBase {
+		return 0, fmt.Errorf("stack underflow")
+	}
+	m.RAM[SP] = sp - 1
+	return m.RAM[sp-1], nil
+}
+
+func (m *Machine) call(name string, n int) error {
+	sp := int(m.RAM[SP])
+	if sp-n < stackBase || sp > ScreenBase {
+		return fmt.Errorf("stack underflow")
+	}
+
+	if native, ok := m.natives[name]; ok {
+		args := make([]uint16, n)
+		copy(args, m.RAM[sp-n:sp])
+		v, err := native(m, args)
+		if err != nil {
+			return err
+		}
+		m.RAM[SP] = uint16(sp - n)
+		return m.push(v)
+	}
+
+	entry, ok := m.functions[name]
+	if !ok {
+		return fmt.Errorf("function %s is not defined", name)
+	}
+	for _, v := range []uint16{uint16(m.PC), m.RAM[LCL], m.RAM[ARG], m.RAM[THIS], m.RAM[THAT]} {
+		if err := m.push(v); err != nil {
+			return err
+		}
+	}
+	m.RAM[ARG] = uint16(sp - n)
+	m.RAM[LCL] = m.RAM[SP]
+	m.PC = entry
+	m.depth++
+	return nil
+}
+
+func (m *Machine) ret() error {
+	frame, arg := int(m.RAM[LCL]), int(m.RAM[ARG])
+	if frame < 5 || frame > RAMSize || arg >= RAMSize {
+		return fmt.Errorf("invalid frame: LCL=%d, ARG=%d", frame, arg)
+	}
+	retAddr := int(m.RAM[frame-5])
+	v, err := m.pop()
+	if err != nil {
+		return err
+	}
+	m.RAM[arg] = v
+	m.RAM[SP] = uint16(arg + 1)
+	m.RAM[THAT] = m.RAM[frame-1]
+	m.RAM[THIS] = m.RAM[frame-2]
+	m.RAM[ARG] = m.RAM[frame-3]
+	m.RAM[LCL] = m.RAM[frame-4]
+
+	// the outermost function was not called in the machine, and has nowhere to return
+	if m.depth == 0 {
+		m.Halted = true
+		return nil
+	}
+	m.depth--
+	m.PC = retAddr
+	return nil
+}
+
+func collectSourceFiles(inputs []string) ([]string, error) {
+	var srcs []string
+	for _, in := range inputs {
+		info, err := os.Stat(in)
+		if err != nil {
+			return nil, fmt.Errorf("os stat error: %v", err)
+		}
+		if info.IsDir() {
+			paths, err := filepath.Glob(filepath.Join(in, "*.vm"))
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(paths)
+			srcs = append(srcs, paths...)
+			continue
+		}
+		if strings.HasSuffix(info.Name(), ".vm") {
+			srcs = append(srcs, in)
+		}
+	}
+	if len(srcs) == 0 {
+		return nil, fmt.Errorf(".vm file not found in: %v", inputs)
+	}
+	return srcs, nil
+}
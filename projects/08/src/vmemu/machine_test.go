@@ -0,0 +1,222 @@
+package vmemu
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nfukaaswa/nand2tetris/05/src/tst"
+	"github.com/nfukaaswa/nand2tetris/08/src/vm"
+	"github.com/nfukaaswa/nand2tetris/11/src/compiler"
+)
+
+func TestVMEScripts(t *testing.T) {
+	patterns := []string{
+		"../../../07/*/*/*VME.tst",
+		"../../*/*/*VME.tst",
+	}
+	for _, pattern := range patterns {
+		scripts, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, script := range scripts {
+			script := script
+			t.Run(filepath.Base(script), func(t *testing.T) {
+				err := tst.RunFile(script, tst.RunnerOptions{
+					Simulator: NewSimulator(Options{}),
+					Out:       io.Discard,
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+// The OS tests of project 12 are written for the VM emulator with the built-in OS,
+// and need the natives to finish within the steps. Their Main.jack files are copied to testdata,
+// since the ones of project 12 are not committed.
+func TestOSNatives(t *testing.T) {
+	for _, name := range []string{"ArrayTest", "MathTest", "MemoryTest"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			dir := compileDir(t, filepath.Join("testdata", name))
+			copyFile(t, filepath.Join("testdata", name, name+".tst"), filepath.Join(dir, name+".tst"))
+			copyFile(t, filepath.Join("testdata", name, name+".cmp"), filepath.Join(dir, name+".cmp"))
+
+			err := tst.RunFile(filepath.Join(dir, name+".tst"), tst.RunnerOptions{
+				Simulator: NewSimulator(Options{Natives: OSNatives(nil)}),
+				Out:       io.Discard,
+			})
+			if err != nil {
+				t.Error(err)
+			}
+
+			// the results are written to RAM[8000..]
+			vmOS := runUntilHalt(t, dir, Options{})
+			native := runUntilHalt(t, dir, Options{Natives: OSNatives(nil)})
+			if !equalWords(vmOS.RAM[8000:8016], native.RAM[8000:8016]) {
+				t.Errorf("results differ: %v by the OS, %v by the natives", vmOS.RAM[8000:8016], native.RAM[8000:8016])
+			}
+		})
+	}
+}
+
+func TestOSNativesOutput(t *testing.T) {
+	dir := compileDir(t, "testdata/StringTest")
+
+	vmOS := runUntilHalt(t, dir, Options{})
+
+	var out bytes.Buffer
+	native := runUntilHalt(t, dir, Options{Natives: OSNatives(&out)})
+
+	if !equalWords(vmOS.RAM[ScreenBase:ScreenBase+ScreenSize], native.RAM[ScreenBase:ScreenBase+ScreenSize]) {
+		t.Error("screen drawn by the natives differs from the one drawn by the OS")
+	}
+	for _, line := range []string{"new,appendChar: abcde", "setInt: -32767", "eraseLastChar: ab-d"} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("output does not contain %q:\n%s", line, out.String())
+		}
+	}
+	if native.Steps*10 > vmOS.Steps {
+		t.Errorf("natives are not fast enough: %d steps, while %d steps without them", native.Steps, vmOS.Steps)
+	}
+}
+
+// TestSysInit checks that Sys.init is entered with a frame like the bootstrap code, so its
+// locals are on the stack, and the machine halts when it returns.
+func TestSysInit(t *testing.T) {
+	src := `function Sys.init 2
+push constant 5
+pop local 0
+push constant 7
+pop local 1
+push local 0
+push local 1
+call Sys.add 2
+pop static 0
+push constant 0
+return
+function Sys.add 0
+push argument 0
+push argument 1
+add
+return`
+	m := New(Options{})
+	if err := m.Load("Sys", vm.NewParser("Sys.vm", strings.NewReader(src))); err != nil {
+		t.Fatal(err)
+	}
+	m.Reset()
+	if m.RAM[SP] != 261 || m.RAM[LCL] != 261 || m.RAM[ARG] != 256 {
+		t.Errorf("got SP=%d LCL=%d ARG=%d, want SP=261 LCL=261 ARG=256", m.RAM[SP], m.RAM[LCL], m.RAM[ARG])
+	}
+	if err := m.Run(100); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Halted {
+		t.Fatal("program does not halt")
+	}
+	if m.RAM[16] != 12 || m.RAM[261] != 5 || m.RAM[262] != 7 {
+		t.Errorf("got RAM[16]=%d RAM[261]=%d RAM[262]=%d, want 12, 5 and 7", m.RAM[16], m.RAM[261], m.RAM[262])
+	}
+	if m.RAM[SP] != 257 {
+		t.Errorf("SP after the return: got %d, want 257", m.RAM[SP])
+	}
+}
+
+// runUntilHalt runs the program until it calls Sys.halt, which is an infinite loop in the OS.
+func runUntilHalt(t *testing.T, dir string, opts Options) *Machine {
+	t.Helper()
+
+	m := New(opts)
+	if err := m.LoadFiles([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	for !m.Halted && m.Function() != "Sys.halt" {
+		if m.Steps > 100000000 {
+			t.Fatal("program does not halt")
+		}
+		if err := m.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// compileDir compiles the .jack files in dir into a temporary directory with the OS.
+func compileDir(t *testing.T, dir string) string {
+	t.Helper()
+
+	out := t.TempDir()
+	srcs, err := filepath.Glob(filepath.Join(dir, "*.jack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range srcs {
+		file, err := os.Open(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens, err := compiler.Tokenize(src, file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cls, err := compiler.Analyze(tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := os.Create(filepath.Join(out, strings.TrimSuffix(filepath.Base(src), ".jack")+".vm"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = compiler.CompileClass(compiler.NewJackVM(w), cls)
+		w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for vm := range compiler.OSVMs() {
+		w, err := os.Create(filepath.Join(out, vm.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.Copy(w, vm)
+		w.Close()
+		vm.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+
+	b, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equalWords(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
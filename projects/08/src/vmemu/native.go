@@ -0,0 +1,372 @@
+package vmemu
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// OSNatives returns the Go implementations of the OS functions in 11/src/compiler/os, which run much
+// faster than the VM code. They follow the OS API, and the Output functions draw the same characters
+// as the OS. The printed characters are also written to out when it is not nil.
+//
+// Math, Memory, Array and Output are replaced as a whole, because they keep their state in Go.
+// Output.printString reads the String object laid out like the OS: capacity, buffer and length.
+func OSNatives(out io.Writer) map[string]Native {
+	n := &natives{out: out}
+	return map[string]Native{
+		"Math.init":     n.nop,
+		"Math.abs":      n.abs,
+		"Math.multiply": n.multiply,
+		"Math.divide":   n.divide,
+		"Math.sqrt":     n.sqrt,
+		"Math.max":      n.max,
+		"Math.min":      n.min,
+
+		"Memory.init":    n.memoryInit,
+		"Memory.peek":    n.peek,
+		"Memory.poke":    n.poke,
+		"Memory.alloc":   n.alloc,
+		"Memory.deAlloc": n.deAlloc,
+		"Array.new":      n.alloc,
+		"Array.dispose":  n.deAlloc,
+
+		"Output.init":        n.outputInit,
+		"Output.moveCursor":  n.moveCursor,
+		"Output.printChar":   n.printChar,
+		"Output.printString": n.printString,
+		"Output.printInt":    n.printInt,
+		"Output.println":     n.println,
+		"Output.backSpace":   n.backSpace,
+
+		"Sys.halt":  n.halt,
+		"Sys.wait":  n.nop,
+		"Sys.error": n.error,
+	}
+}
+
+type natives struct {
+	out      io.Writer
+	freeList uint16
+
+	address    int
+	wordInLine int
+	left       bool
+}
+
+const (
+	heapBase = 2048
+	heapEnd  = ScreenBase
+
+	textRows = 23
+	textCols = 64
+
+	newLine   = 128
+	backSpace = 129
+)
+
+func (n *natives) nop(m *Machine, args []uint16) (uint16, error) {
+	return 0, nil
+}
+
+func (n *natives) abs(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 1); err != nil {
+		return 0, err
+	}
+	if x := int16(args[0]); x < 0 {
+		return uint16(-x), nil
+	}
+	return args[0], nil
+}
+
+func (n *natives) multiply(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 2); err != nil {
+		return 0, err
+	}
+	return args[0] * args[1], nil
+}
+
+func (n *natives) divide(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 2); err != nil {
+		return 0, err
+	}
+	x, y := int16(args[0]), int16(args[1])
+	if y == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return uint16(x / y), nil
+}
+
+func (n *natives) sqrt(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 1); err != nil {
+		return 0, err
+	}
+	x := int(int16(args[0]))
+	y := 0
+	for (y+1)*(y+1) <= x {
+		y++
+	}
+	return uint16(y), nil
+}
+
+func (n *natives) max(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 2); err != nil {
+		return 0, err
+	}
+	if int16(args[0]) > int16(args[1]) {
+		return args[0], nil
+	}
+	return args[1], nil
+}
+
+func (n *natives) min(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 2); err != nil {
+		return 0, err
+	}
+	if int16(args[0]) > int16(args[1]) {
+		return args[1], nil
+	}
+	return args[0], nil
+}
+
+// memoryInit makes the whole heap a free segment. A free segment holds its size and the next
+// segment in its first two words.
+func (n *natives) memoryInit(m *Machine, args []uint16) (uint16, error) {
+	n.freeList = heapBase
+	m.RAM[heapBase] = heapEnd - heapBase
+	m.RAM[heapBase+1] = 0
+	return 0, nil
+}
+
+func (n *natives) peek(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 1); err != nil {
+		return 0, err
+	}
+	if args[0] >= RAMSize {
+		return 0, fmt.Errorf("address %d is out of the RAM", args[0])
+	}
+	return m.RAM[args[0]], nil
+}
+
+func (n *natives) poke(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 2); err != nil {
+		return 0, err
+	}
+	if args[0] >= RAMSize {
+		return 0, fmt.Errorf("address %d is out of the RAM", args[0])
+	}
+	m.RAM[args[0]] = args[1]
+	return 0, nil
+}
+
+// alloc finds the best fit segment, and returns the block taken from its end, or the whole segment
+// when it is too small to split. The word before the block holds its size.
+func (n *natives) alloc(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 1); err != nil {
+		return 0, err
+	}
+	if n.freeList == 0 {
+		return 0, fmt.Errorf("heap is not initialized")
+	}
+	size := int(int16(args[0]))
+	if size <= 0 {
+		return 0, fmt.Errorf("invalid allocation size: %d", size)
+	}
+
+	var selected, selectedPrev, prev uint16
+	minDiff := heapEnd
+	for seg := n.freeList; seg != 0; prev, seg = seg, m.RAM[seg+1] {
+		if diff := int(m.RAM[seg]) - size - 2; diff >= 0 && diff < minDiff {
+			selected, selectedPrev, minDiff = seg, prev, diff
+		}
+	}
+	if selected == 0 {
+		return 0, fmt.Errorf("heap overflow: no segment for %d words", size)
+	}
+
+	if int(m.RAM[selected]) > (size+1)*2 {
+		block := selected + m.RAM[selected] - uint16(size)
+		m.RAM[block-1] = uint16(size + 1)
+		m.RAM[selected] -= uint16(size + 1)
+		return block, nil
+	}
+	if selectedPrev == 0 {
+		n.freeList = m.RAM[selected+1]
+	} else {
+		m.RAM[selectedPrev+1] = m.RAM[selected+1]
+	}
+	return selected + 1, nil
+}
+
+func (n *natives) deAlloc(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 1); err != nil {
+		return 0, err
+	}
+	if args[0] <= heapBase || args[0] >= heapEnd {
+		return 0, fmt.Errorf("address %d is out of the heap", args[0])
+	}
+	seg := args[0] - 1
+	m.RAM[seg+1] = n.freeList
+	n.freeList = seg
+	return 0, nil
+}
+
+// The Output functions keep the cursor like the OS: address is the offset of the screen word,
+// and left tells whether the character goes to the lower byte of the word. The text lines start
+// at the second pixel row, and are 11 pixel rows (352 words) apart.
+func (n *natives) outputInit(m *Machine, args []uint16) (uint16, error) {
+	n.address, n.wordInLine, n.left = 32, 0, true
+	return 0, nil
+}
+
+func (n *natives) moveCursor(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 2); err != nil {
+		return 0, err
+	}
+	row, col := int(int16(args[0])), int(int16(args[1]))
+	if row < 0 || row >= textRows || col < 0 || col >= textCols {
+		return 0, fmt.Errorf("cursor (%d, %d) is out of the screen", row, col)
+	}
+	n.wordInLine = col / 2
+	n.address = 32 + row*352 + n.wordInLine
+	n.left = col%2 == 0
+	n.drawChar(m, ' ')
+	return 0, nil
+}
+
+func (n *natives) printChar(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 1); err != nil {
+		return 0, err
+	}
+	switch c := args[0]; c {
+	case newLine:
+		return n.println(m, nil)
+	case backSpace:
+		return n.backSpace(m, nil)
+	default:
+		if n.out != nil && c >= 32 && c <= 126 {
+			fmt.Fprintf(n.out, "%c", rune(c))
+		}
+		n.drawChar(m, c)
+	}
+
+	if !n.left {
+		n.wordInLine++
+		n.address++
+	}
+	if n.wordInLine == textCols/2 {
+		n.newLine()
+	} else {
+		n.left = !n.left
+	}
+	return 0, nil
+}
+
+func (n *natives) printString(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 1); err != nil {
+		return 0, err
+	}
+	s := int(args[0])
+	if s == 0 || s+2 >= RAMSize {
+		return 0, fmt.Errorf("invalid string: %d", s)
+	}
+	buf, length := int(m.RAM[s+1]), int(m.RAM[s+2])
+	if buf+length > RAMSize {
+		return 0, fmt.Errorf("invalid string: %d", s)
+	}
+	for i := 0; i < length; i++ {
+		if _, err := n.printChar(m, []uint16{m.RAM[buf+i]}); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+func (n *natives) printInt(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 1); err != nil {
+		return 0, err
+	}
+	for _, c := range strconv.Itoa(int(int16(args[0]))) {
+		if _, err := n.printChar(m, []uint16{uint16(c)}); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// drawChar draws the character at the cursor, keeping the other character in the word.
+func (n *natives) drawChar(m *Machine, c uint16) {
+	if c < 32 || c > 126 {
+		c = 0
+	}
+	for i, bits := range font[c] {
+		addr := ScreenBase + n.address + i*32
+		if addr >= RAMSize {
+			continue
+		}
+		if n.left {
+			m.RAM[addr] = m.RAM[addr]&0xff00 | bits
+		} else {
+			m.RAM[addr] = m.RAM[addr]&0x00ff | bits<<8
+		}
+	}
+}
+
+func (n *natives) println(m *Machine, args []uint16) (uint16, error) {
+	if n.out != nil {
+		fmt.Fprintln(n.out)
+	}
+	n.newLine()
+	return 0, nil
+}
+
+func (n *natives) newLine() {
+	n.address += 352 - n.wordInLine
+	n.wordInLine = 0
+	n.left = true
+	if n.address == textRows*352+32 {
+		n.address = 32
+	}
+}
+
+func (n *natives) backSpace(m *Machine, args []uint16) (uint16, error) {
+	if n.out != nil {
+		fmt.Fprint(n.out, "\b")
+	}
+	if n.left {
+		if n.wordInLine > 0 {
+			n.wordInLine--
+			n.address--
+		} else {
+			n.wordInLine = textCols/2 - 1
+			if n.address == 32 {
+				n.address = textRows*352 + 32
+			}
+			n.address -= 321
+		}
+		n.left = false
+	} else {
+		n.left = true
+	}
+	n.drawChar(m, ' ')
+	return 0, nil
+}
+
+func (n *natives) halt(m *Machine, args []uint16) (uint16, error) {
+	m.Halted = true
+	return 0, nil
+}
+
+func (n *natives) error(m *Machine, args []uint16) (uint16, error) {
+	if err := argc(args, 1); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("Sys.error: error code %d", int16(args[0]))
+}
+
+func argc(args []uint16, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("%d arguments are expected, but got %d", n, len(args))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package vmemu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nfukaaswa/nand2tetris/05/src/tst"
+)
+
+// Simulator runs test scripts written for the VM emulator (load Foo.vm, or load a directory).
+type Simulator struct {
+	Machine *Machine
+	Options Options
+}
+
+func NewSimulator(opts Options) *Simulator {
+	return &Simulator{Options: opts}
+}
+
+func (s *Simulator) Load(path string) error {
+	m := New(s.Options)
+	if err := m.LoadFiles([]string{path}); err != nil {
+		return err
+	}
+	s.Machine = m
+	return nil
+}
+
+func (s *Simulator) Get(name string) (int, error) {
+	ptr, err := s.variable(name)
+	if err != nil {
+		return 0, err
+	}
+	return int(int16(*ptr)), nil
+}
+
+func (s *Simulator) Set(name string, value int) error {
+	ptr, err := s.variable(name)
+	if err != nil {
+		return err
+	}
+	*ptr = uint16(value)
+	return nil
+}
+
+func (s *Simulator) Eval() error {
+	return nil
+}
+
+// Tick runs a command like vmstep.
+func (s *Simulator) Tick() error {
+	if s.Machine == nil {
+		return fmt.Errorf("program is not loaded")
+	}
+	return s.Machine.Step()
+}
+
+func (s *Simulator) Tock() error {
+	return nil
+}
+
+func (s *Simulator) Command(args []string) error {
+	if len(args) == 1 && args[0] == "vmstep" {
+		return s.Tick()
+	}
+	return fmt.Errorf("unknown command: %s", strings.Join(args, " "))
+}
+
+// variable returns the RAM word of the variable: RAM[i], the pointers (sp, local, argument, this, that)
+// and the segment entries (local[i], argument[i], this[i], that[i], temp[i]).
+func (s *Simulator) variable(v string) (*uint16, error) {
+	if s.Machine == nil {
+		return nil, fmt.Errorf("program is not loaded")
+	}
+	name, index, err := tst.SplitVar(v)
+	if err != nil {
+		return nil, err
+	}
+
+	ram := &s.Machine.RAM
+	addr := -1
+	switch name {
+	case "RAM":
+		addr = index
+	case "sp":
+		addr = SP
+	case "temp":
+		if index >= 0 && index < 8 {
+			addr = tempBase + index
+		}
+	case "local", "argument", "this", "that":
+		ptr := map[string]int{"local": LCL, "argument": ARG, "this": THIS, "that": THAT}[name]
+		addr = ptr
+		if index >= 0 {
+			addr = int(ram[ptr]) + index
+		}
+	default:
+		return nil, fmt.Errorf("unknown variable: %s", v)
+	}
+	if addr < 0 || addr >= RAMSize {
+		return nil, fmt.Errorf("index out of range: %s", v)
+	}
+	return &ram[addr], nil
+}
@@ -5,7 +5,7 @@ type Class struct {
 	ClassVarDecs   []ClassVarDec
 	SubRoutineDecs []SubroutineDec
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Type string
@@ -23,7 +23,7 @@ type ClassVarDec struct {
 	VarType         Type
 	VarNames        []string
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type ClassVarDecType string
@@ -40,7 +40,7 @@ type SubroutineDec struct {
 	ParameterList  ParameterList
 	SubroutineBody SubroutineBody
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type SubRoutineType string
@@ -52,45 +52,45 @@ const (
 )
 
 type ParameterList struct {
-	Paramters []Parameter
+	Paramters []Parameter `json:"Parameters"`
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Parameter struct {
 	VarType Type
 	VarName string
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type SubroutineBody struct {
 	VarDecs    []VarDec
 	Statements Statements
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type VarDec struct {
 	VarType  Type
 	VarNames []string
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Statements struct {
 	Statements []Statement
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Statement struct {
 	Type            StatementType
-	LetStatement    *LetStatement
-	IfStatement     *IfStatement
-	WhileStatement  *WhileStatement
-	DoStatement     *DoStatement
-	ReturnStatement *ReturnStatement
+	LetStatement    *LetStatement    `json:",omitempty"`
+	IfStatement     *IfStatement     `json:",omitempty"`
+	WhileStatement  *WhileStatement  `json:",omitempty"`
+	DoStatement     *DoStatement     `json:",omitempty"`
+	ReturnStatement *ReturnStatement `json:",omitempty"`
 }
 
 type StatementType string
@@ -105,10 +105,10 @@ const (
 
 type LetStatement struct {
 	VarName  string
-	Index    *Expression
+	Index    *Expression `json:",omitempty"`
 	VarValue Expression
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type IfStatement struct {
@@ -116,33 +116,33 @@ type IfStatement struct {
 	IfStatements   Statements
 	ElseStatements Statements
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type WhileStatement struct {
 	Condition  Expression
 	Statements Statements
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type DoStatement struct {
 	SubroutineCall SubroutineCall
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type ReturnStatement struct {
-	Expression *Expression
+	Expression *Expression `json:",omitempty"`
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Expression struct {
 	Term Term
 	Tail []ExpressionTail
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type ExpressionTail struct {
@@ -152,17 +152,17 @@ type ExpressionTail struct {
 
 type Term struct {
 	Type            TermType
-	IntegerConst    *int64
-	StringConst     *string
-	KeywordConstant *string
-	VarName         *string
-	Index           *Expression
-	SubroutineCall  *SubroutineCall
-	Expression      *Expression
-	UnaryOp         *UnaryOp
-	UnaryOpTerm     *Term
+	IntegerConst    *int64          `json:",omitempty"`
+	StringConst     *string         `json:",omitempty"`
+	KeywordConstant *string         `json:",omitempty"`
+	VarName         *string         `json:",omitempty"`
+	Index           *Expression     `json:",omitempty"`
+	SubroutineCall  *SubroutineCall `json:",omitempty"`
+	Expression      *Expression     `json:",omitempty"`
+	UnaryOp         *UnaryOp        `json:",omitempty"`
+	UnaryOpTerm     *Term           `json:",omitempty"`
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type TermType string
@@ -179,17 +179,17 @@ const (
 )
 
 type SubroutineCall struct {
-	Receiver       *string
+	Receiver       *string `json:",omitempty"`
 	SubroutineName string
 	ExpressionList ExpressionList
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type ExpressionList struct {
 	Expressions []Expression
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Op string
@@ -0,0 +1,154 @@
+package compiler
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MarshalSexp writes the tokens as an S-expression, one token per line: (tokens (keyword "class") ...).
+func (ts Tokens) MarshalSexp(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("(tokens")
+	for _, t := range ts {
+		sb.WriteString("\n  (" + string(t.Type) + " " + strconv.Quote(t.Value) + ")")
+	}
+	sb.WriteString(")\n")
+	return writeString(w, sb.String())
+}
+
+// MarshalSexp writes the class as a compact S-expression, one declaration or statement per line.
+// An expression is nested in the order of the evaluation, since Jack has no operator precedence:
+// a + b * c is (* (+ a b) c).
+func (x *Class) MarshalSexp(w io.Writer) error {
+	s := sexpWriter{}
+	s.class(x)
+	s.sb.WriteString("\n")
+	return writeString(w, s.sb.String())
+}
+
+type sexpWriter struct {
+	sb     strings.Builder
+	indent int
+}
+
+func (s *sexpWriter) line(str string) {
+	if s.sb.Len() > 0 {
+		s.sb.WriteString("\n")
+	}
+	s.sb.WriteString(strings.Repeat("  ", s.indent) + str)
+}
+
+func (s *sexpWriter) class(cls *Class) {
+	s.line("(class " + cls.ClassName)
+	s.indent++
+	for _, dec := range cls.ClassVarDecs {
+		s.line("(" + string(dec.ClassVarDecType) + " " + string(dec.VarType) + " " + strings.Join(dec.VarNames, " ") + ")")
+	}
+	for _, dec := range cls.SubRoutineDecs {
+		params := make([]string, len(dec.ParameterList.Paramters))
+		for i, param := range dec.ParameterList.Paramters {
+			params[i] = "(" + string(param.VarType) + " " + param.VarName + ")"
+		}
+		s.line("(" + string(dec.SubRoutineType) + " " + string(dec.RetType) + " " + dec.SubroutineName + " (" + strings.Join(params, " ") + ")")
+		s.indent++
+		for _, v := range dec.SubroutineBody.VarDecs {
+			s.line("(var " + string(v.VarType) + " " + strings.Join(v.VarNames, " ") + ")")
+		}
+		s.statements(&dec.SubroutineBody.Statements)
+		s.indent--
+		s.sb.WriteString(")")
+	}
+	s.indent--
+	s.sb.WriteString(")")
+}
+
+func (s *sexpWriter) statements(st *Statements) {
+	for _, st := range st.Statements {
+		switch st.Type {
+		case StatementTypeLet:
+			target := st.LetStatement.VarName
+			if st.LetStatement.Index != nil {
+				target = "(index " + target + " " + expressionSexp(st.LetStatement.Index) + ")"
+			}
+			s.line("(let " + target + " " + expressionSexp(&st.LetStatement.VarValue) + ")")
+
+		case StatementTypeIf:
+			s.line("(if " + expressionSexp(&st.IfStatement.Condition))
+			s.indent++
+			s.block("then", &st.IfStatement.IfStatements)
+			if len(st.IfStatement.ElseStatements.Statements) > 0 {
+				s.block("else", &st.IfStatement.ElseStatements)
+			}
+			s.indent--
+			s.sb.WriteString(")")
+
+		case StatementTypeWhile:
+			s.line("(while " + expressionSexp(&st.WhileStatement.Condition))
+			s.indent++
+			s.statements(&st.WhileStatement.Statements)
+			s.indent--
+			s.sb.WriteString(")")
+
+		case StatementTypeDo:
+			s.line("(do " + callSexp(&st.DoStatement.SubroutineCall) + ")")
+
+		case StatementTypeReturn:
+			if st.ReturnStatement.Expression == nil {
+				s.line("(return)")
+			} else {
+				s.line("(return " + expressionSexp(st.ReturnStatement.Expression) + ")")
+			}
+		}
+	}
+}
+
+func (s *sexpWriter) block(name string, st *Statements) {
+	s.line("(" + name)
+	s.indent++
+	s.statements(st)
+	s.indent--
+	s.sb.WriteString(")")
+}
+
+func expressionSexp(exp *Expression) string {
+	str := termSexp(&exp.Term)
+	for _, tail := range exp.Tail {
+		str = "(" + string(tail.Op) + " " + str + " " + termSexp(&tail.Term) + ")"
+	}
+	return str
+}
+
+func termSexp(t *Term) string {
+	switch t.Type {
+	case TermTypeIntegerConst:
+		return strconv.FormatInt(*t.IntegerConst, 10)
+	case TermTypeStringConst:
+		return strconv.Quote(*t.StringConst)
+	case TermTypeKeywordConst:
+		return *t.KeywordConstant
+	case TermTypeVarName:
+		return *t.VarName
+	case TermTypeVarNameIndex:
+		return "(index " + *t.VarName + " " + expressionSexp(t.Index) + ")"
+	case TermTypeSubroutineCall:
+		return callSexp(t.SubroutineCall)
+	case TermTypeExpression:
+		return expressionSexp(t.Expression)
+	case TermTypeUnaryOp:
+		return "(" + string(*t.UnaryOp) + " " + termSexp(t.UnaryOpTerm) + ")"
+	default:
+		return "()"
+	}
+}
+
+func callSexp(call *SubroutineCall) string {
+	str := "(call " + call.SubroutineName
+	if call.Receiver != nil {
+		str = "(call " + *call.Receiver + "." + call.SubroutineName
+	}
+	for i := range call.ExpressionList.Expressions {
+		str += " " + expressionSexp(&call.ExpressionList.Expressions[i])
+	}
+	return str + ")"
+}
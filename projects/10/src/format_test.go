@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nfukaaswa/nand2tetris/10/src/compiler"
+)
+
+const formatSource = `class Main {
+  function void f(int a, boolean b) {
+    do Output.printInt(a + 1);
+    return;
+  }
+}`
+
+func TestMarshalJSON(t *testing.T) {
+	tokens, err := compiler.Tokenize(strings.NewReader(formatSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cls, err := compiler.Analyze(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := marshal(&buf, "json", "Main.jack", tokens); err != nil {
+		t.Fatal(err)
+	}
+	var gotTokens struct {
+		File   string
+		Tokens []map[string]interface{}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &gotTokens); err != nil {
+		t.Fatal(err)
+	}
+	if gotTokens.File != "Main.jack" || len(gotTokens.Tokens) != len(tokens) {
+		t.Fatalf("got file %q and %d tokens, want Main.jack and %d tokens", gotTokens.File, len(gotTokens.Tokens), len(tokens))
+	}
+	if tok := gotTokens.Tokens[0]; tok["Type"] != "keyword" || tok["Value"] != "class" || tok["Line"] != 1.0 {
+		t.Errorf("unexpected first token: %v", tok)
+	}
+
+	buf.Reset()
+	if err := marshal(&buf, "json", "Main.jack", cls); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{`"File": "Main.jack"`, `"ClassName": "Main"`, `"Parameters": [`, `"VarName": "b"`} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%s is not found in:\n%s", s, out)
+		}
+	}
+	for _, s := range []string{"Paramters", `"Node"`} {
+		if strings.Contains(out, s) {
+			t.Errorf("%s is found in:\n%s", s, out)
+		}
+	}
+	if n := strings.Count(out, `"File"`); n != 1 {
+		t.Errorf("File appears %d times, want once", n)
+	}
+}
+
+func TestMarshalSexp(t *testing.T) {
+	tokens, err := compiler.Tokenize(strings.NewReader(formatSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cls, err := compiler.Analyze(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := marshal(&buf, "sexp", "Main.jack", cls); err != nil {
+		t.Fatal(err)
+	}
+	want := `(class Main
+  (function void f ((int a) (boolean b))
+    (do (call Output.printInt (+ a 1)))
+    (return)))
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := marshal(&buf, "sexp", "Main.jack", tokens[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if want := "(tokens\n  (keyword \"class\")\n  (identifier \"Main\"))\n"; buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
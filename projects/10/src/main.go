@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
@@ -16,6 +17,7 @@ import (
 type opts struct {
 	Inputs []string `short:"i" long:"in" required:"true" description:"input file or directory path"`
 	Output string   `short:"o" long:"out" required:"true" description:"output directory path"`
+	Format string   `long:"format" choice:"xml" choice:"json" choice:"sexp" default:"xml" description:"output format of the tokens and the tree"`
 }
 
 func main() {
@@ -49,8 +51,12 @@ func main() {
 			return
 		}
 
-		// write tokens xml
-		if err := writeXML(filepath.Join(opts.Output, srcBase+"T.xml"), tokens.ToNode()); err != nil {
+		// write tokens
+		var tokensOut interface{} = tokens.ToNode()
+		if opts.Format != "xml" {
+			tokensOut = tokens
+		}
+		if err := write(filepath.Join(opts.Output, srcBase+"T."+opts.Format), opts.Format, src, tokensOut); err != nil {
 			fmt.Println(err)
 			return
 		}
@@ -62,8 +68,12 @@ func main() {
 			return
 		}
 
-		// write tree xml
-		if err := writeXML(filepath.Join(opts.Output, srcBase+".xml"), cls.ToNode()); err != nil {
+		// write tree
+		var treeOut interface{} = cls.ToNode()
+		if opts.Format != "xml" {
+			treeOut = cls
+		}
+		if err := write(filepath.Join(opts.Output, srcBase+"."+opts.Format), opts.Format, src, treeOut); err != nil {
 			fmt.Println(err)
 			return
 		}
@@ -96,9 +106,10 @@ func collectSourceFiles(inputs []string) ([]string, error) {
 	return srcs, nil
 }
 
-func writeXML(path string, node *compiler.Node) error {
+// write writes v in format to path. See marshal for v.
+func write(path, format, src string, v interface{}) error {
 	buf := bytes.NewBuffer(nil)
-	if err := node.MarshalXML(buf); err != nil {
+	if err := marshal(buf, format, src, v); err != nil {
 		return err
 	}
 	if err := writeFile(path, buf); err != nil {
@@ -107,6 +118,37 @@ func writeXML(path string, node *compiler.Node) error {
 	return nil
 }
 
+// jsonFile is the top level of the json output, which holds the source file path once for the
+// tokens or the tree.
+type jsonFile struct {
+	File   string
+	Tokens compiler.Tokens `json:",omitempty"`
+	Class  *compiler.Class `json:",omitempty"`
+}
+
+// marshal writes v of src in format: a *compiler.Node for xml, and compiler.Tokens or
+// *compiler.Class for the others.
+func marshal(w io.Writer, format, src string, v interface{}) error {
+	switch format {
+	case "xml":
+		return v.(*compiler.Node).MarshalXML(w)
+	case "json":
+		out := jsonFile{File: src}
+		switch v := v.(type) {
+		case compiler.Tokens:
+			out.Tokens = v
+		case *compiler.Class:
+			out.Class = v
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "sexp":
+		return v.(interface{ MarshalSexp(io.Writer) error }).MarshalSexp(w)
+	}
+	return fmt.Errorf("unknown format: %s", format)
+}
+
 func writeFile(path string, buf io.Reader) error {
 	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nfukaaswa/nand2tetris/10/src/compiler"
+)
+
+// TestGolden compares the XML of the tokens and the tree of the samples with the reference *T.xml
+// and *.xml files, ignoring the whitespace.
+func TestGolden(t *testing.T) {
+	sources, _ := filepath.Glob("../*/*.jack")
+	if len(sources) == 0 {
+		t.Fatal("no samples")
+	}
+	for _, source := range sources {
+		source := source
+		t.Run(strings.TrimPrefix(source, "../"), func(t *testing.T) {
+			base := strings.TrimSuffix(source, ".jack")
+
+			file, err := os.Open(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			tokens, err := compiler.Tokenize(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			if err := tokens.ToNode().MarshalXML(&got); err != nil {
+				t.Fatal(err)
+			}
+			compareXML(t, base+"T.xml", &got)
+
+			cls, err := compiler.Analyze(tokens)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got.Reset()
+			if err := cls.ToNode().MarshalXML(&got); err != nil {
+				t.Fatal(err)
+			}
+			compareXML(t, base+".xml", &got)
+		})
+	}
+}
+
+// compareXML reports the differences of got from the reference file as a tree diff.
+func compareXML(t *testing.T, reference string, got io.Reader) {
+	t.Helper()
+	file, err := os.Open(reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	want, err := parseXMLTree(file)
+	if err != nil {
+		t.Fatalf("%s: %v", reference, err)
+	}
+	tree, err := parseXMLTree(got)
+	if err != nil {
+		t.Fatalf("output of %s: %v", reference, err)
+	}
+
+	var diffs []string
+	diffTree(tree.name, tree, want, &diffs)
+	if len(diffs) > 0 {
+		t.Errorf("%s differs (- got, + want):\n%s", reference, strings.Join(diffs, "\n"))
+	}
+}
+
+// xmlTree is an element of the XML, whose value is trimmed of the whitespace.
+type xmlTree struct {
+	name     string
+	value    string
+	children []*xmlTree
+}
+
+func parseXMLTree(r io.Reader) (*xmlTree, error) {
+	d := xml.NewDecoder(r)
+	var root *xmlTree
+	var stack []*xmlTree
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			e := &xmlTree{name: token.Name.Local}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			e.value = strings.TrimSpace(e.value)
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].value += string(token)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no XML element")
+	}
+	return root, nil
+}
+
+// lines renders the tree with an element per line, up to max lines.
+func (e *xmlTree) lines(indent string, max int, lines []string) []string {
+	if len(lines) >= max {
+		return lines
+	}
+	if len(lines) == max-1 && len(e.children) > 0 {
+		return append(lines, indent+"...")
+	}
+	line := indent + "<" + e.name + ">"
+	if e.value != "" {
+		line += " " + e.value
+	}
+	lines = append(lines, line)
+	for _, c := range e.children {
+		lines = c.lines(indent+"  ", max, lines)
+	}
+	return lines
+}
+
+// diffTree appends the differences of got from want under path. At each level, only the first
+// differing child is reported, since the children after it are usually shifted.
+func diffTree(path string, got, want *xmlTree, diffs *[]string) {
+	if got.name != want.name || got.value != want.value {
+		*diffs = append(*diffs, path+":")
+		for _, line := range got.lines("", 8, nil) {
+			*diffs = append(*diffs, "- "+line)
+		}
+		for _, line := range want.lines("", 8, nil) {
+			*diffs = append(*diffs, "+ "+line)
+		}
+		return
+	}
+
+	count := map[string]int{}
+	for i := 0; i < len(got.children) || i < len(want.children); i++ {
+		var name string
+		switch {
+		case i >= len(got.children):
+			name = want.children[i].name
+		default:
+			name = got.children[i].name
+		}
+		childPath := fmt.Sprintf("%s/%s[%d]", path, name, count[name])
+		count[name]++
+
+		switch {
+		case i >= len(got.children):
+			*diffs = append(*diffs, childPath+": missing")
+			for _, line := range want.children[i].lines("", 8, nil) {
+				*diffs = append(*diffs, "+ "+line)
+			}
+			return
+		case i >= len(want.children):
+			*diffs = append(*diffs, childPath+": unexpected")
+			for _, line := range got.children[i].lines("", 8, nil) {
+				*diffs = append(*diffs, "- "+line)
+			}
+			return
+		}
+
+		n := len(*diffs)
+		diffTree(childPath, got.children[i], want.children[i], diffs)
+		if len(*diffs) > n {
+			return
+		}
+	}
+}
+
+func TestDiffTree(t *testing.T) {
+	got, err := parseXMLTree(strings.NewReader(`<expression><term><identifier> x </identifier></term><symbol> + </symbol>
+		<term><identifier> y </identifier></term></expression>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := parseXMLTree(strings.NewReader(`<expression>
+  <term>
+    <identifier> x </identifier>
+  </term>
+  <symbol> + </symbol>
+  <term>
+    <integerConstant> 1 </integerConstant>
+  </term>
+</expression>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var diffs []string
+	diffTree("expression", got, want, &diffs)
+	wantDiffs := []string{
+		"expression/term[1]/identifier[0]:",
+		"- <identifier> y",
+		"+ <integerConstant> 1",
+	}
+	if strings.Join(diffs, "\n") != strings.Join(wantDiffs, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(diffs, "\n"), strings.Join(wantDiffs, "\n"))
+	}
+
+	diffs = nil
+	diffTree("expression", got, got, &diffs)
+	if len(diffs) != 0 {
+		t.Errorf("no differences are expected, but got:\n%s", strings.Join(diffs, "\n"))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/nfukaaswa/nand2tetris/08/src/vm"
+	"github.com/nfukaaswa/nand2tetris/11/src/compiler"
+)
+
+// hack-trace maps ROM addresses of a Hack program back to the VM commands and the Jack code, with
+// the maps written by the VM translator and the Jack compiler with --source-map. The addresses are
+// taken from the arguments, or from the standard input without arguments, such as the return
+// addresses of a stack dump.
+type opts struct {
+	Map   string `short:"m" long:"map" required:"true" description:"source map of the .asm file"`
+	VMDir string `short:"v" long:"vm-dir" description:"directory of the .vm.map files (default: the directory of the .asm map)"`
+}
+
+func main() {
+	var opts opts
+	args, err := flags.Parse(&opts)
+	if err != nil {
+		return
+	}
+	if opts.VMDir == "" {
+		opts.VMDir = filepath.Dir(opts.Map)
+	}
+
+	file, err := os.Open(opts.Map)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	romMap, err := vm.ReadSourceMap(opts.Map, file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if len(args) == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		args = strings.Fields(string(data))
+	}
+
+	t := tracer{romMap: romMap, vmDir: opts.VMDir, vmMaps: map[string]compiler.VMSourceMap{}}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for _, arg := range args {
+		address, err := strconv.ParseInt(arg, 0, 32)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid address: %s\n", arg)
+			os.Exit(1)
+		}
+		line, err := t.lookup(int(address))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+type tracer struct {
+	romMap vm.SourceMap
+	vmDir  string
+	vmMaps map[string]compiler.VMSourceMap
+}
+
+// lookup returns the line of the trace for address: "address: function (file.vm:line, file.jack:line:col)".
+func (t *tracer) lookup(address int) (string, error) {
+	e, ok := t.romMap.Lookup(address)
+	if !ok {
+		return fmt.Sprintf("%d: unknown", address), nil
+	}
+	if e.File == "" {
+		return fmt.Sprintf("%d: %s", address, e.Function), nil
+	}
+
+	sources := []string{fmt.Sprintf("%s:%d", e.File, e.Line)}
+	vmMap, err := t.vmMap(e.File)
+	if err != nil {
+		return "", err
+	}
+	if pos, ok := vmMap.Lookup(e.Line); ok {
+		sources = append(sources, pos.String())
+	}
+	return fmt.Sprintf("%d: %s (%s)", address, e.Function, strings.Join(sources, ", ")), nil
+}
+
+// vmMap returns the map of the VM file, which is empty if the file has no map, as the OS files.
+func (t *tracer) vmMap(vmFile string) (compiler.VMSourceMap, error) {
+	if m, ok := t.vmMaps[vmFile]; ok {
+		return m, nil
+	}
+	path := filepath.Join(t.vmDir, vmFile+".map")
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.vmMaps[vmFile] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	m, err := compiler.ReadVMSourceMap(path, file)
+	if err != nil {
+		return nil, err
+	}
+	t.vmMaps[vmFile] = m
+	return m, nil
+}
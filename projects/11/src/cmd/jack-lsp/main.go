@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nfukaaswa/nand2tetris/11/src/lsp"
+)
+
+// jack-lsp is a language server of Jack, which talks LSP over stdin and stdout.
+func main() {
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of the unchanged lines around the changes in a hunk.
+const diffContext = 3
+
+// diff returns the unified diff from a to b, which are the original and the formatted source of path.
+func diff(path, a, b string) string {
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// edits is the script of the lines prefixed by ' ', '-' or '+'.
+	var edits []string
+	for i, j := 0, 0; i < len(x) || j < len(y); {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			edits = append(edits, " "+x[i])
+			i++
+			j++
+		case j == len(y) || i < len(x) && lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, "-"+x[i])
+			i++
+		default:
+			edits = append(edits, "+"+y[j])
+			j++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s.orig\n+++ %s\n", path, path)
+	line := []int{1, 1} // the lines of a and b at the start of edits[k]
+	for k := 0; k < len(edits); {
+		if edits[k][0] == ' ' {
+			line[0]++
+			line[1]++
+			k++
+			continue
+		}
+
+		// a hunk lasts until more than 2*diffContext lines are unchanged.
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		last := k
+		for e := k + 1; e < len(edits); e++ {
+			if edits[e][0] != ' ' {
+				last = e
+			} else if e-last > 2*diffContext {
+				break
+			}
+		}
+		end := last + 1 + diffContext
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		from := []int{line[0] - (k - start), line[1] - (k - start)}
+		count := []int{0, 0}
+		for _, e := range edits[start:end] {
+			if e[0] != '+' {
+				count[0]++
+			}
+			if e[0] != '-' {
+				count[1]++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", from[0], count[0], from[1], count[1])
+		for _, e := range edits[start:end] {
+			sb.WriteString(e + "\n")
+		}
+
+		for _, e := range edits[k:end] {
+			if e[0] != '+' {
+				line[0]++
+			}
+			if e[0] != '-' {
+				line[1]++
+			}
+		}
+		k = end
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
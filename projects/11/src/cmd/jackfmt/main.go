@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/nfukaaswa/nand2tetris/11/src/compiler"
+)
+
+// jackfmt formats .jack files. Without paths, it formats the standard input.
+type opts struct {
+	List  bool `short:"l" description:"list the files whose formatting differs, and exit with 1 if any"`
+	Diff  bool `short:"d" description:"display the diffs of the formatting, and exit with 1 if any"`
+	Write bool `short:"w" description:"write the result to the files instead of the standard output"`
+}
+
+func main() {
+	var opts opts
+	paths, err := flags.Parse(&opts)
+	if err != nil {
+		return
+	}
+
+	if len(paths) == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		out, err := compiler.Format("<stdin>", src)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	files, err := collectSourceFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	failed, changed := false, false
+	for _, path := range files {
+		c, err := formatFile(path, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
+		changed = changed || c
+	}
+	if failed || changed && (opts.List || opts.Diff) && !opts.Write {
+		os.Exit(1)
+	}
+}
+
+// formatFile formats path as opts, and reports whether the formatting differs from the file.
+func formatFile(path string, opts opts) (bool, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	out, err := compiler.Format(path, src)
+	if err != nil {
+		return false, err
+	}
+	changed := !bytes.Equal(src, out)
+
+	if changed && opts.List {
+		fmt.Println(path)
+	}
+	if changed && opts.Diff {
+		fmt.Print(diff(path, string(src), string(out)))
+	}
+	if changed && opts.Write {
+		if err := os.WriteFile(path, out, 0644); err != nil {
+			return changed, err
+		}
+	}
+	if !opts.List && !opts.Diff && !opts.Write {
+		os.Stdout.Write(out)
+	}
+	return changed, nil
+}
+
+func collectSourceFiles(inputs []string) ([]string, error) {
+	var srcs []string
+	for _, in := range inputs {
+		info, err := os.Stat(in)
+		if err != nil {
+			return nil, fmt.Errorf("os stat error: %v", err)
+		}
+		if info.IsDir() {
+			filepath.Walk(in, func(path string, info fs.FileInfo, err error) error {
+				if strings.HasSuffix(info.Name(), ".jack") {
+					srcs = append(srcs, path)
+				}
+				return err
+			})
+		}
+		if strings.HasSuffix(info.Name(), ".jack") {
+			srcs = append(srcs, in)
+		}
+	}
+	if len(srcs) == 0 {
+		return nil, fmt.Errorf(".jack file not found in: %v", inputs)
+	}
+	return srcs, nil
+}
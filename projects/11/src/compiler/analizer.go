@@ -1,52 +1,75 @@
 package compiler
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
 )
 
+// Analyze parses the tokens of a class. On syntax errors, it resumes at the next statement or
+// declaration, and returns the class parsed so far with the ErrorList of all the errors.
 func Analyze(tokens Tokens) (*Class, error) {
 	a := newAnalyzer(tokens)
-	return a.parseClass()
+	cls, err := a.parseClass()
+	if err != nil {
+		a.report(err)
+	}
+	return cls, a.errs.Err()
 }
 
 type analyzer struct {
-	tokens Tokens
+	tokens    Tokens
+	next      int
+	eof       Pos
+	errs      ErrorList
+	recovered int
 }
 
 func newAnalyzer(tokens Tokens) analyzer {
-	return analyzer{
-		tokens: tokens,
+	a := analyzer{
+		tokens:    tokens,
+		recovered: -1,
 	}
+	if len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		a.eof = last.Pos
+		a.eof.Col += len(last.Value)
+		if last.Type == TokenTypeStringConst {
+			a.eof.Col += 2
+		}
+	}
+	return a
 }
 
 func (a *analyzer) parseClass() (*Class, error) {
 	cls := Class{Node: Node{Name: "class"}}
 
 	token := a.popToken()
-	if err := assertToken(token, TokenTypeKeyword, "class"); err != nil {
+	if err := a.assertToken(token, TokenTypeKeyword, "class"); err != nil {
 		return nil, err
 	}
 	cls.Node.AddChild(token)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeIdentifier); err != nil {
+	if err := a.assertToken(token, TokenTypeIdentifier); err != nil {
 		return nil, err
 	}
 	cls.ClassName = token.Value
+	cls.Pos = token.Pos
 	cls.Node.AddChild(token)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "{"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "{"); err != nil {
 		return nil, err
 	}
 	cls.Node.AddChild(token)
 
 	var vDecs []ClassVarDec
 	for {
+		start := a.next
 		dec, err := a.parseClassVarDec()
 		if err != nil {
-			return nil, err
+			a.recoverDeclaration(err, start)
+			continue
 		}
 		if dec == nil {
 			break
@@ -58,9 +81,11 @@ func (a *analyzer) parseClass() (*Class, error) {
 
 	var srDecs []SubroutineDec
 	for {
+		start := a.next
 		dec, err := a.parseSubroutineDec()
 		if err != nil {
-			return nil, err
+			a.recoverDeclaration(err, start)
+			continue
 		}
 		if dec == nil {
 			break
@@ -71,45 +96,39 @@ func (a *analyzer) parseClass() (*Class, error) {
 	cls.SubRoutineDecs = srDecs
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "}"); err != nil {
-		return nil, err
+	if err := a.assertToken(token, TokenTypeSymbol, "}"); err != nil {
+		return &cls, err
 	}
 	cls.Node.AddChild(token)
 
+	// the tokens left after an error are skipped by the recovery
+	if token := a.topToken(); token != nil && len(a.errs) == 0 {
+		return &cls, a.unexpected(token, "end of file")
+	}
 	return &cls, nil
 }
 
 func (a *analyzer) parseType() (Type, *Token, error) {
 	token := a.popToken()
-	switch token.Type {
-	case TokenTypeKeyword:
-		switch token.Value {
-		case "int", "char", "boolean":
-			return Type(token.Value), token, nil
-		default:
-			return "", nil, fmt.Errorf("int, char, boolean or className is expected, but got %+v", token)
-		}
-	case TokenTypeIdentifier:
+	switch {
+	case checkToken(token, TokenTypeKeyword, "int", "char", "boolean"):
+		return Type(token.Value), token, nil
+	case checkToken(token, TokenTypeIdentifier):
 		return Type(token.Value), token, nil
 	default:
-		return "", nil, fmt.Errorf("int, char, boolean or className is expected, but got %+v", token)
+		return "", nil, a.unexpected(token, "int, char, boolean or className")
 	}
 }
 
 func (a *analyzer) parseRetType() (Type, *Token, error) {
 	token := a.popToken()
-	switch token.Type {
-	case TokenTypeKeyword:
-		switch token.Value {
-		case "int", "char", "boolean", "void":
-			return Type(token.Value), token, nil
-		default:
-			return "", nil, fmt.Errorf("int, char, boolean, void or className is expected, but got %+v", token)
-		}
-	case TokenTypeIdentifier:
+	switch {
+	case checkToken(token, TokenTypeKeyword, "int", "char", "boolean", "void"):
+		return Type(token.Value), token, nil
+	case checkToken(token, TokenTypeIdentifier):
 		return Type(token.Value), token, nil
 	default:
-		return "", nil, fmt.Errorf("int, char, boolean, void or className is expected, but got %+v", token)
+		return "", nil, a.unexpected(token, "int, char, boolean, void or className")
 	}
 }
 
@@ -121,6 +140,7 @@ func (a *analyzer) parseClassVarDec() (*ClassVarDec, error) {
 
 	token := a.popToken()
 	dec.ClassVarDecType = ClassVarDecType(token.Value)
+	dec.Pos = token.Pos
 	dec.Node.AddChild(token)
 
 	var err error
@@ -133,14 +153,15 @@ func (a *analyzer) parseClassVarDec() (*ClassVarDec, error) {
 	var varNames []string
 	for {
 		token = a.popToken()
-		if err := assertToken(token, TokenTypeIdentifier); err != nil {
+		if err := a.assertToken(token, TokenTypeIdentifier); err != nil {
 			return nil, err
 		}
 		varNames = append(varNames, token.Value)
+		dec.NamePos = append(dec.NamePos, token.Pos)
 		dec.Node.AddChild(token)
 
 		token = a.popToken()
-		if err := assertToken(token, TokenTypeSymbol, ",", ";"); err != nil {
+		if err := a.assertToken(token, TokenTypeSymbol, ",", ";"); err != nil {
 			return nil, err
 		}
 		dec.Node.AddChild(token)
@@ -171,14 +192,15 @@ func (a *analyzer) parseSubroutineDec() (*SubroutineDec, error) {
 	dec.Node.AddChild(token)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeIdentifier); err != nil {
+	if err := a.assertToken(token, TokenTypeIdentifier); err != nil {
 		return nil, err
 	}
 	dec.SubroutineName = token.Value
+	dec.Pos = token.Pos
 	dec.Node.AddChild(token)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "("); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "("); err != nil {
 		return nil, err
 	}
 	dec.Node.AddChild(token)
@@ -204,8 +226,7 @@ func (a *analyzer) parseParamterList() (*ParameterList, error) {
 
 	params := &ParameterList{Node: Node{Name: "parameterList", Children: []Node{}}}
 
-	token := a.topToken()
-	if token.Type == TokenTypeSymbol && token.Value == ")" {
+	if checkToken(a.topToken(), TokenTypeSymbol, ")") {
 		return params, nil
 	}
 
@@ -217,15 +238,15 @@ func (a *analyzer) parseParamterList() (*ParameterList, error) {
 		params.Node.AddChild(token)
 
 		token = a.popToken()
-		if err := assertToken(token, TokenTypeIdentifier); err != nil {
+		if err := a.assertToken(token, TokenTypeIdentifier); err != nil {
 			return nil, err
 		}
 		params.Node.AddChild(token)
 
-		params.Paramters = append(params.Paramters, Parameter{VarType: ty, VarName: token.Value})
+		params.Paramters = append(params.Paramters, Parameter{VarType: ty, VarName: token.Value, Pos: token.Pos})
 
 		token = a.topToken()
-		if err := assertToken(token, TokenTypeSymbol, ",", ")"); err != nil {
+		if err := a.assertToken(token, TokenTypeSymbol, ",", ")"); err != nil {
 			return nil, err
 		}
 		if token.Value == "," {
@@ -242,15 +263,17 @@ func (a *analyzer) parseSubroutineBody() (*SubroutineBody, error) {
 	body := SubroutineBody{Node: Node{Name: "subroutineBody"}}
 
 	token := a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "{"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "{"); err != nil {
 		return nil, err
 	}
 	body.Node.AddChild(token)
 
 	for {
+		start := a.next
 		dec, err := a.parseVarDec()
 		if err != nil {
-			return nil, err
+			a.recoverStatement(err, start)
+			continue
 		}
 		if dec == nil {
 			break
@@ -268,7 +291,7 @@ func (a *analyzer) parseSubroutineBody() (*SubroutineBody, error) {
 	body.Node.AddChild(statements)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "}"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "}"); err != nil {
 		return nil, err
 	}
 	body.Node.AddChild(token)
@@ -281,7 +304,7 @@ func (a *analyzer) parseVarDec() (*VarDec, error) {
 		return nil, nil
 	}
 
-	dec := VarDec{Node: Node{Name: "varDec"}}
+	dec := VarDec{Node: Node{Name: "varDec"}, Pos: a.topToken().Pos}
 	dec.Node.AddChild(a.popToken())
 
 	varTy, token, err := a.parseType()
@@ -293,15 +316,16 @@ func (a *analyzer) parseVarDec() (*VarDec, error) {
 
 	for {
 		token := a.popToken()
-		if err := assertToken(token, TokenTypeIdentifier); err != nil {
+		if err := a.assertToken(token, TokenTypeIdentifier); err != nil {
 			return nil, err
 		}
 		dec.Node.AddChild(token)
 
 		dec.VarNames = append(dec.VarNames, token.Value)
+		dec.NamePos = append(dec.NamePos, token.Pos)
 
 		token = a.popToken()
-		if err := assertToken(token, TokenTypeSymbol, ",", ";"); err != nil {
+		if err := a.assertToken(token, TokenTypeSymbol, ",", ";"); err != nil {
 			return nil, err
 		}
 		dec.Node.AddChild(token)
@@ -317,9 +341,11 @@ func (a *analyzer) parseVarDec() (*VarDec, error) {
 func (a *analyzer) parseStatements() (*Statements, error) {
 	statements := Statements{Node: Node{Name: "statements", Children: []Node{}}}
 	for {
+		start := a.next
 		statement, err := a.parseStatement()
 		if err != nil {
-			return nil, err
+			a.recoverStatement(err, start)
+			continue
 		}
 		if statement == nil {
 			break
@@ -331,7 +357,7 @@ func (a *analyzer) parseStatements() (*Statements, error) {
 }
 
 func (a *analyzer) parseStatement() (*Statement, error) {
-	if checkToken(a.topToken(), TokenTypeSymbol, "}") {
+	if a.topToken() == nil || checkToken(a.topToken(), TokenTypeSymbol, "}") {
 		return nil, nil
 	}
 
@@ -385,21 +411,22 @@ func (a *analyzer) parseStatement() (*Statement, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("invalid statement: %+v", a.topToken())
+	return nil, a.unexpected(a.topToken(), "statement")
 }
 
 func (a *analyzer) parseLetStatement() (*LetStatement, error) {
 	if !checkToken(a.topToken(), TokenTypeKeyword, "let") {
 		return nil, nil
 	}
-	statement := LetStatement{Node: Node{Name: "letStatement"}}
+	statement := LetStatement{Node: Node{Name: "letStatement"}, Pos: a.topToken().Pos}
 	statement.Node.AddChild(a.popToken())
 
 	token := a.popToken()
-	if err := assertToken(token, TokenTypeIdentifier); err != nil {
+	if err := a.assertToken(token, TokenTypeIdentifier); err != nil {
 		return nil, err
 	}
 	statement.VarName = token.Value
+	statement.VarPos = token.Pos
 	statement.Node.AddChild(token)
 
 	var err error
@@ -413,14 +440,14 @@ func (a *analyzer) parseLetStatement() (*LetStatement, error) {
 		statement.Node.AddChild(statement.Index)
 
 		token := a.popToken()
-		if err := assertToken(token, TokenTypeSymbol, "]"); err != nil {
+		if err := a.assertToken(token, TokenTypeSymbol, "]"); err != nil {
 			return nil, err
 		}
 		statement.Node.AddChild(token)
 	}
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "="); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "="); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
@@ -433,7 +460,7 @@ func (a *analyzer) parseLetStatement() (*LetStatement, error) {
 	statement.Node.AddChild(val)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, ";"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, ";"); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
@@ -445,11 +472,11 @@ func (a *analyzer) parseIfStatement() (*IfStatement, error) {
 	if !checkToken(a.topToken(), TokenTypeKeyword, "if") {
 		return nil, nil
 	}
-	statement := IfStatement{Node: Node{Name: "ifStatement"}}
+	statement := IfStatement{Node: Node{Name: "ifStatement"}, Pos: a.topToken().Pos}
 	statement.Node.AddChild(a.popToken())
 
 	token := a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "("); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "("); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
@@ -462,13 +489,13 @@ func (a *analyzer) parseIfStatement() (*IfStatement, error) {
 	statement.Node.AddChild(cond)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, ")"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, ")"); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "{"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "{"); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
@@ -481,7 +508,7 @@ func (a *analyzer) parseIfStatement() (*IfStatement, error) {
 	statement.Node.AddChild(statements)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "}"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "}"); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
@@ -491,7 +518,7 @@ func (a *analyzer) parseIfStatement() (*IfStatement, error) {
 		statement.Node.AddChild(a.popToken())
 
 		token = a.popToken()
-		if err := assertToken(token, TokenTypeSymbol, "{"); err != nil {
+		if err := a.assertToken(token, TokenTypeSymbol, "{"); err != nil {
 			return nil, err
 		}
 		statement.Node.AddChild(token)
@@ -504,7 +531,7 @@ func (a *analyzer) parseIfStatement() (*IfStatement, error) {
 		statement.Node.AddChild(elseStatements)
 
 		token := a.popToken()
-		if err := assertToken(token, TokenTypeSymbol, "}"); err != nil {
+		if err := a.assertToken(token, TokenTypeSymbol, "}"); err != nil {
 			return nil, err
 		}
 		statement.Node.AddChild(token)
@@ -517,11 +544,11 @@ func (a *analyzer) parseWhileStatement() (*WhileStatement, error) {
 	if !checkToken(a.topToken(), TokenTypeKeyword, "while") {
 		return nil, nil
 	}
-	statement := WhileStatement{Node: Node{Name: "whileStatement"}}
+	statement := WhileStatement{Node: Node{Name: "whileStatement"}, Pos: a.topToken().Pos}
 	statement.Node.AddChild(a.popToken())
 
 	token := a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "("); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "("); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
@@ -534,13 +561,13 @@ func (a *analyzer) parseWhileStatement() (*WhileStatement, error) {
 	statement.Node.AddChild(cond)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, ")"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, ")"); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "{"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "{"); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
@@ -553,7 +580,7 @@ func (a *analyzer) parseWhileStatement() (*WhileStatement, error) {
 	statement.Node.AddChild(statements)
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "}"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "}"); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
@@ -565,7 +592,7 @@ func (a *analyzer) parseDoStatement() (*DoStatement, error) {
 	if !checkToken(a.topToken(), TokenTypeKeyword, "do") {
 		return nil, nil
 	}
-	statement := DoStatement{Node: Node{Name: "doStatement"}}
+	statement := DoStatement{Node: Node{Name: "doStatement"}, Pos: a.topToken().Pos}
 	statement.Node.AddChild(a.popToken())
 
 	call, err := a.parseSubroutineCall()
@@ -576,7 +603,7 @@ func (a *analyzer) parseDoStatement() (*DoStatement, error) {
 	statement.Node.AddChild(call)
 
 	token := a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, ";"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, ";"); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
@@ -588,7 +615,7 @@ func (a *analyzer) parseReturnStatement() (*ReturnStatement, error) {
 	if !checkToken(a.topToken(), TokenTypeKeyword, "return") {
 		return nil, nil
 	}
-	statement := ReturnStatement{Node: Node{Name: "returnStatement"}}
+	statement := ReturnStatement{Node: Node{Name: "returnStatement"}, Pos: a.topToken().Pos}
 	statement.Node.AddChild(a.popToken())
 
 	if checkToken(a.topToken(), TokenTypeSymbol, ";") {
@@ -604,7 +631,7 @@ func (a *analyzer) parseReturnStatement() (*ReturnStatement, error) {
 	statement.Node.AddChild(exp)
 
 	token := a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, ";"); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, ";"); err != nil {
 		return nil, err
 	}
 	statement.Node.AddChild(token)
@@ -649,34 +676,39 @@ func (a *analyzer) parseTerm() (*Term, error) {
 	node := Node{Name: "term"}
 
 	token := a.popToken()
+	if token == nil {
+		return nil, a.unexpected(token, "term")
+	}
+	pos := token.Pos
+
 	switch {
 	case checkToken(token, TokenTypeIntegerConst):
 		i, err := strconv.ParseInt(token.Value, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("integerConstant parse error: %+v", token)
+		if err != nil || i > 32767 {
+			return nil, errorf(pos, "integer constant %s is out of range 0..32767", token.Value)
 		}
 		node.AddChild(token)
-		return &Term{Type: TermTypeIntegerConst, IntegerConst: &i, Node: node}, nil
+		return &Term{Type: TermTypeIntegerConst, IntegerConst: &i, Node: node, Pos: pos}, nil
 
 	case checkToken(token, TokenTypeStringConst):
 		node.AddChild(token)
-		return &Term{Type: TermTypeStringConst, StringConst: &token.Value, Node: node}, nil
+		return &Term{Type: TermTypeStringConst, StringConst: &token.Value, Node: node, Pos: pos}, nil
 
 	case checkToken(token, TokenTypeKeyword, "true", "false", "null", "this"):
 		node.AddChild(token)
-		return &Term{Type: TermTypeKeywordConst, KeywordConstant: &token.Value, Node: node}, nil
+		return &Term{Type: TermTypeKeywordConst, KeywordConstant: &token.Value, Node: node, Pos: pos}, nil
 
 	case checkToken(token, TokenTypeIdentifier):
 		next := a.topToken()
 		switch {
 		case checkToken(next, TokenTypeSymbol, "(", "."):
-			a.pushToken(*token)
+			a.unpopToken()
 			call, err := a.parseSubroutineCall()
 			if err != nil {
 				return nil, err
 			}
 			node.AddChild(call)
-			return &Term{Type: TermTypeSubroutineCall, SubroutineCall: call, Node: node}, nil
+			return &Term{Type: TermTypeSubroutineCall, SubroutineCall: call, Node: node, Pos: pos}, nil
 
 		case checkToken(next, TokenTypeSymbol, "["):
 			varName := token.Value
@@ -688,15 +720,15 @@ func (a *analyzer) parseTerm() (*Term, error) {
 			}
 			node.AddChild(exp)
 			token := a.popToken()
-			if err := assertToken(token, TokenTypeSymbol, "]"); err != nil {
+			if err := a.assertToken(token, TokenTypeSymbol, "]"); err != nil {
 				return nil, err
 			}
 			node.AddChild(token)
-			return &Term{Type: TermTypeVarNameIndex, VarName: &varName, Index: exp, Node: node}, nil
+			return &Term{Type: TermTypeVarNameIndex, VarName: &varName, Index: exp, Node: node, Pos: pos}, nil
 
 		default:
 			node.AddChild(token)
-			return &Term{Type: TermTypeVarName, VarName: &token.Value, Node: node}, nil
+			return &Term{Type: TermTypeVarName, VarName: &token.Value, Node: node, Pos: pos}, nil
 		}
 
 	case checkToken(token, TokenTypeSymbol, "("):
@@ -707,11 +739,11 @@ func (a *analyzer) parseTerm() (*Term, error) {
 		}
 		node.AddChild(exp)
 		token := a.popToken()
-		if err := assertToken(token, TokenTypeSymbol, ")"); err != nil {
+		if err := a.assertToken(token, TokenTypeSymbol, ")"); err != nil {
 			return nil, err
 		}
 		node.AddChild(token)
-		return &Term{Type: TermTypeExpression, Expression: exp, Node: node}, nil
+		return &Term{Type: TermTypeExpression, Expression: exp, Node: node, Pos: pos}, nil
 
 	case checkToken(token, TokenTypeSymbol, "-", "~"):
 		node.AddChild(token)
@@ -722,23 +754,23 @@ func (a *analyzer) parseTerm() (*Term, error) {
 			return nil, err
 		}
 		node.AddChild(term)
-		return &Term{Type: TermTypeUnaryOp, UnaryOp: &op, UnaryOpTerm: term, Node: node}, nil
+		return &Term{Type: TermTypeUnaryOp, UnaryOp: &op, UnaryOpTerm: term, Node: node, Pos: pos}, nil
 	default:
-		return nil, fmt.Errorf("term is expected: %+v", token)
+		return nil, a.unexpected(token, "term")
 	}
 }
 
 func (a *analyzer) parseSubroutineCall() (*SubroutineCall, error) {
 	token := a.popToken()
-	if err := assertToken(token, TokenTypeIdentifier); err != nil {
+	if err := a.assertToken(token, TokenTypeIdentifier); err != nil {
 		return nil, err
 	}
 
-	call := SubroutineCall{Node: Node{SkipLayer: true}}
+	call := SubroutineCall{Node: Node{SkipLayer: true}, Pos: token.Pos}
 	call.Node.AddChild(token)
 
 	next := a.topToken()
-	if err := assertToken(next, TokenTypeSymbol, "(", "."); err != nil {
+	if err := a.assertToken(next, TokenTypeSymbol, "(", "."); err != nil {
 		return nil, err
 	}
 
@@ -750,7 +782,7 @@ func (a *analyzer) parseSubroutineCall() (*SubroutineCall, error) {
 		call.Receiver = &token.Value
 
 		token := a.popToken()
-		if err := assertToken(token, TokenTypeIdentifier); err != nil {
+		if err := a.assertToken(token, TokenTypeIdentifier); err != nil {
 			return nil, err
 		}
 		call.SubroutineName = token.Value
@@ -758,7 +790,7 @@ func (a *analyzer) parseSubroutineCall() (*SubroutineCall, error) {
 	}
 
 	token = a.popToken()
-	if err := assertToken(token, TokenTypeSymbol, "("); err != nil {
+	if err := a.assertToken(token, TokenTypeSymbol, "("); err != nil {
 		return nil, err
 	}
 	call.Node.AddChild(token)
@@ -790,7 +822,7 @@ func (a *analyzer) parseExpressionList() (*ExpressionList, error) {
 		exps.Expressions = append(exps.Expressions, *exp)
 
 		token := a.topToken()
-		if err := assertToken(token, TokenTypeSymbol, ",", ")"); err != nil {
+		if err := a.assertToken(token, TokenTypeSymbol, ",", ")"); err != nil {
 			return nil, err
 		}
 		if token.Value == "," {
@@ -803,24 +835,106 @@ func (a *analyzer) parseExpressionList() (*ExpressionList, error) {
 	return &exps, nil
 }
 
+// The keywords at which the analyzer resumes after a syntax error.
+var (
+	statementKeywords   = []string{"let", "do", "if", "while", "return"}
+	declarationKeywords = []string{"static", "field", "constructor", "function", "method"}
+)
+
+// recoverStatement reports err, and skips the tokens to the end of the statement which started at
+// start (the number of the tokens left then): after ';', or before '}' or the next statement.
+func (a *analyzer) recoverStatement(err error, start int) {
+	a.report(err)
+	defer func() { a.recovered = a.next }()
+	for {
+		token := a.topToken()
+		switch {
+		case token == nil:
+			return
+		case checkToken(token, TokenTypeSymbol, ";"):
+			a.popToken()
+			return
+		case checkToken(token, TokenTypeSymbol, "}"), checkToken(token, TokenTypeKeyword, statementKeywords...):
+			if a.next > start {
+				return
+			}
+			a.popToken()
+		case checkToken(token, TokenTypeSymbol, "{"):
+			a.skipBlock()
+		default:
+			a.popToken()
+		}
+	}
+}
+
+// recoverDeclaration reports err, and skips the tokens to the next declaration or the end of the class.
+func (a *analyzer) recoverDeclaration(err error, start int) {
+	a.report(err)
+	defer func() { a.recovered = a.next }()
+	for {
+		token := a.topToken()
+		switch {
+		case token == nil:
+			return
+		case checkToken(token, TokenTypeSymbol, "}"), checkToken(token, TokenTypeKeyword, declarationKeywords...):
+			if a.next > start {
+				return
+			}
+			a.popToken()
+		case checkToken(token, TokenTypeSymbol, "{"):
+			a.skipBlock()
+		default:
+			a.popToken()
+		}
+	}
+}
+
+// skipBlock skips the tokens from '{' to the matching '}'.
+func (a *analyzer) skipBlock() {
+	depth := 0
+	for token := a.popToken(); token != nil; token = a.popToken() {
+		switch {
+		case checkToken(token, TokenTypeSymbol, "{"):
+			depth++
+		case checkToken(token, TokenTypeSymbol, "}"):
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+// report adds err to the errors. An error before any token is parsed after the last recovery
+// is dropped, since it is likely caused by the last error.
+func (a *analyzer) report(err error) {
+	e, ok := err.(*Error)
+	if !ok {
+		e = errorf(a.eof, "%v", err)
+	}
+	if a.next != a.recovered {
+		a.errs = append(a.errs, e)
+	}
+}
+
 func (a *analyzer) topToken() *Token {
-	if len(a.tokens) == 0 {
+	if a.next >= len(a.tokens) {
 		return nil
 	}
-	return &a.tokens[0]
+	return &a.tokens[a.next]
 }
 
 func (a *analyzer) popToken() *Token {
-	if len(a.tokens) == 0 {
+	if a.next >= len(a.tokens) {
 		return nil
 	}
-	ret := &a.tokens[0]
-	a.tokens = a.tokens[1:]
+	ret := &a.tokens[a.next]
+	a.next++
 	return ret
 }
 
-func (a *analyzer) pushToken(token Token) {
-	a.tokens = append(Tokens{token}, a.tokens...)
+func (a *analyzer) unpopToken() {
+	a.next--
 }
 
 func checkToken(token *Token, expectedType TokenType, candidateValues ...string) bool {
@@ -839,16 +953,33 @@ func checkToken(token *Token, expectedType TokenType, candidateValues ...string)
 	return true
 }
 
-func assertToken(token *Token, expectedType TokenType, candidateValues ...string) error {
+func (a *analyzer) assertToken(token *Token, expectedType TokenType, candidateValues ...string) error {
 	if !checkToken(token, expectedType, candidateValues...) {
-		str := fmt.Sprintf("token type '%s' is expected", expectedType)
+		expected := string(expectedType)
 		if len(candidateValues) > 0 {
-			str += fmt.Sprintf(" with values %+v", candidateValues)
-		}
-		if token != nil {
-			str += fmt.Sprintf(", but got %+v", token)
+			quoted := make([]string, len(candidateValues))
+			for i, v := range candidateValues {
+				quoted[i] = "'" + v + "'"
+			}
+			expected = strings.Join(quoted, " or ")
 		}
-		return fmt.Errorf(str)
+		return a.unexpected(token, expected)
 	}
 	return nil
 }
+
+// unexpected returns the error for token, which is nil at the end of the file. The token is
+// put back when it is the last popped one, so that the recovery starts from it.
+func (a *analyzer) unexpected(token *Token, expected string) error {
+	if token == nil {
+		return errorf(a.eof, "expected %s but found end of file", expected)
+	}
+	if a.next > 0 && token == &a.tokens[a.next-1] {
+		a.unpopToken()
+	}
+	found := "'" + token.Value + "'"
+	if token.Type == TokenTypeStringConst {
+		found = `"` + token.Value + `"`
+	}
+	return errorf(token.Pos, "expected %s but found %s", expected, found)
+}
@@ -1,11 +1,14 @@
 package compiler
 
+// Pos is the position of the name in Class, SubroutineDec and Parameter, and the position of
+// the first token in the others. NamePos holds the positions of VarNames.
 type Class struct {
 	ClassName      string
 	ClassVarDecs   []ClassVarDec
 	SubRoutineDecs []SubroutineDec
+	Pos            Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Type string
@@ -22,8 +25,10 @@ type ClassVarDec struct {
 	ClassVarDecType ClassVarDecType
 	VarType         Type
 	VarNames        []string
+	Pos             Pos
+	NamePos         []Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type ClassVarDecType string
@@ -39,8 +44,9 @@ type SubroutineDec struct {
 	SubroutineName string
 	ParameterList  ParameterList
 	SubroutineBody SubroutineBody
+	Pos            Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type SubRoutineType string
@@ -52,45 +58,48 @@ const (
 )
 
 type ParameterList struct {
-	Paramters []Parameter
+	Paramters []Parameter `json:"Parameters"`
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Parameter struct {
 	VarType Type
 	VarName string
+	Pos     Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type SubroutineBody struct {
 	VarDecs    []VarDec
 	Statements Statements
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type VarDec struct {
 	VarType  Type
 	VarNames []string
+	Pos      Pos
+	NamePos  []Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Statements struct {
 	Statements []Statement
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Statement struct {
 	Type            StatementType
-	LetStatement    *LetStatement
-	IfStatement     *IfStatement
-	WhileStatement  *WhileStatement
-	DoStatement     *DoStatement
-	ReturnStatement *ReturnStatement
+	LetStatement    *LetStatement    `json:",omitempty"`
+	IfStatement     *IfStatement     `json:",omitempty"`
+	WhileStatement  *WhileStatement  `json:",omitempty"`
+	DoStatement     *DoStatement     `json:",omitempty"`
+	ReturnStatement *ReturnStatement `json:",omitempty"`
 }
 
 type StatementType string
@@ -105,44 +114,50 @@ const (
 
 type LetStatement struct {
 	VarName  string
-	Index    *Expression
+	Index    *Expression `json:",omitempty"`
 	VarValue Expression
+	Pos      Pos
+	VarPos   Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type IfStatement struct {
 	Condition      Expression
 	IfStatements   Statements
 	ElseStatements Statements
+	Pos            Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type WhileStatement struct {
 	Condition  Expression
 	Statements Statements
+	Pos        Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type DoStatement struct {
 	SubroutineCall SubroutineCall
+	Pos            Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type ReturnStatement struct {
-	Expression *Expression
+	Expression *Expression `json:",omitempty"`
+	Pos        Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Expression struct {
 	Term Term
 	Tail []ExpressionTail
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type ExpressionTail struct {
@@ -152,17 +167,18 @@ type ExpressionTail struct {
 
 type Term struct {
 	Type            TermType
-	IntegerConst    *int64
-	StringConst     *string
-	KeywordConstant *string
-	VarName         *string
-	Index           *Expression
-	SubroutineCall  *SubroutineCall
-	Expression      *Expression
-	UnaryOp         *UnaryOp
-	UnaryOpTerm     *Term
+	IntegerConst    *int64          `json:",omitempty"`
+	StringConst     *string         `json:",omitempty"`
+	KeywordConstant *string         `json:",omitempty"`
+	VarName         *string         `json:",omitempty"`
+	Index           *Expression     `json:",omitempty"`
+	SubroutineCall  *SubroutineCall `json:",omitempty"`
+	Expression      *Expression     `json:",omitempty"`
+	UnaryOp         *UnaryOp        `json:",omitempty"`
+	UnaryOpTerm     *Term           `json:",omitempty"`
+	Pos             Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type TermType string
@@ -179,17 +195,18 @@ const (
 )
 
 type SubroutineCall struct {
-	Receiver       *string
+	Receiver       *string `json:",omitempty"`
 	SubroutineName string
 	ExpressionList ExpressionList
+	Pos            Pos
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type ExpressionList struct {
 	Expressions []Expression
 
-	Node Node
+	Node Node `json:"-"`
 }
 
 type Op string
@@ -0,0 +1,182 @@
+package compiler
+
+import "strings"
+
+// ErrorList is a list of errors in the order of the source.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Err returns nil when the list is empty, and the list itself otherwise.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// Check reports undeclared variables, duplicate declarations, and uses of this in functions,
+// which are the errors the engine can not compile.
+func Check(cls *Class) error {
+	c := checker{class: cls, classVars: map[string]checkSym{}, subroutines: map[string]*SubroutineDec{}}
+	c.check()
+	return c.errs.Err()
+}
+
+type checkSym struct {
+	kind SymKind
+	pos  Pos
+}
+
+type checker struct {
+	class       *Class
+	classVars   map[string]checkSym
+	subroutines map[string]*SubroutineDec
+
+	current *SubroutineDec
+	vars    map[string]checkSym
+	errs    ErrorList
+}
+
+func (c *checker) check() {
+	for _, dec := range c.class.ClassVarDecs {
+		for i, name := range dec.VarNames {
+			c.define(c.classVars, name, SymKind(dec.ClassVarDecType), dec.NamePos[i])
+		}
+	}
+
+	for i := range c.class.SubRoutineDecs {
+		dec := &c.class.SubRoutineDecs[i]
+		if prev, ok := c.subroutines[dec.SubroutineName]; ok {
+			c.errorf(dec.Pos, "duplicate declaration of '%s', previously declared at %s", dec.SubroutineName, prev.Pos)
+			continue
+		}
+		c.subroutines[dec.SubroutineName] = dec
+	}
+
+	for i := range c.class.SubRoutineDecs {
+		c.checkSubroutine(&c.class.SubRoutineDecs[i])
+	}
+}
+
+func (c *checker) checkSubroutine(dec *SubroutineDec) {
+	c.current = dec
+	c.vars = map[string]checkSym{}
+	for _, param := range dec.ParameterList.Paramters {
+		c.define(c.vars, param.VarName, SymKindArg, param.Pos)
+	}
+	for _, v := range dec.SubroutineBody.VarDecs {
+		for i, name := range v.VarNames {
+			c.define(c.vars, name, SymKindVar, v.NamePos[i])
+		}
+	}
+	c.checkStatements(&dec.SubroutineBody.Statements)
+}
+
+func (c *checker) define(table map[string]checkSym, name string, kind SymKind, pos Pos) {
+	if prev, ok := table[name]; ok {
+		c.errorf(pos, "duplicate declaration of '%s', previously declared at %s", name, prev.pos)
+		return
+	}
+	table[name] = checkSym{kind: kind, pos: pos}
+}
+
+func (c *checker) checkStatements(s *Statements) {
+	for _, st := range s.Statements {
+		switch st.Type {
+		case StatementTypeLet:
+			let := st.LetStatement
+			if _, ok := c.variable(let.VarName, let.VarPos); !ok {
+				c.errorf(let.VarPos, "assignment to undeclared variable '%s'", let.VarName)
+			}
+			if let.Index != nil {
+				c.checkExpression(let.Index)
+			}
+			c.checkExpression(&let.VarValue)
+		case StatementTypeIf:
+			c.checkExpression(&st.IfStatement.Condition)
+			c.checkStatements(&st.IfStatement.IfStatements)
+			c.checkStatements(&st.IfStatement.ElseStatements)
+		case StatementTypeWhile:
+			c.checkExpression(&st.WhileStatement.Condition)
+			c.checkStatements(&st.WhileStatement.Statements)
+		case StatementTypeDo:
+			c.checkSubroutineCall(&st.DoStatement.SubroutineCall)
+		case StatementTypeReturn:
+			if st.ReturnStatement.Expression != nil {
+				c.checkExpression(st.ReturnStatement.Expression)
+			}
+		}
+	}
+}
+
+func (c *checker) checkExpression(exp *Expression) {
+	c.checkTerm(&exp.Term)
+	for i := range exp.Tail {
+		c.checkTerm(&exp.Tail[i].Term)
+	}
+}
+
+func (c *checker) checkTerm(t *Term) {
+	switch t.Type {
+	case TermTypeKeywordConst:
+		if *t.KeywordConstant == "this" && c.current.SubRoutineType == SubRoutineTypeFunction {
+			c.errorf(t.Pos, "'this' cannot be used in function '%s'", c.current.SubroutineName)
+		}
+	case TermTypeVarName:
+		if _, ok := c.variable(*t.VarName, t.Pos); !ok {
+			c.errorf(t.Pos, "undeclared variable '%s'", *t.VarName)
+		}
+	case TermTypeVarNameIndex:
+		if _, ok := c.variable(*t.VarName, t.Pos); !ok {
+			c.errorf(t.Pos, "undeclared variable '%s'", *t.VarName)
+		}
+		c.checkExpression(t.Index)
+	case TermTypeSubroutineCall:
+		c.checkSubroutineCall(t.SubroutineCall)
+	case TermTypeExpression:
+		c.checkExpression(t.Expression)
+	case TermTypeUnaryOp:
+		c.checkTerm(t.UnaryOpTerm)
+	}
+}
+
+func (c *checker) checkSubroutineCall(call *SubroutineCall) {
+	if call.Receiver == nil {
+		// a method of this class is called on this
+		dec, ok := c.subroutines[call.SubroutineName]
+		if ok && dec.SubRoutineType == SubRoutineTypeMethod && c.current.SubRoutineType == SubRoutineTypeFunction {
+			c.errorf(call.Pos, "method '%s' cannot be called without an object in function '%s'",
+				call.SubroutineName, c.current.SubroutineName)
+		}
+	} else {
+		// the receiver is a variable, or a class name otherwise
+		c.variable(*call.Receiver, call.Pos)
+	}
+	for i := range call.ExpressionList.Expressions {
+		c.checkExpression(&call.ExpressionList.Expressions[i])
+	}
+}
+
+// variable looks up name in the subroutine and the class. A field used in a function is reported,
+// since it is accessed through this.
+func (c *checker) variable(name string, pos Pos) (checkSym, bool) {
+	if sym, ok := c.vars[name]; ok {
+		return sym, true
+	}
+	sym, ok := c.classVars[name]
+	if ok && sym.kind == SymKindField && c.current.SubRoutineType == SubRoutineTypeFunction {
+		c.errorf(pos, "field '%s' cannot be used in function '%s'", name, c.current.SubroutineName)
+	}
+	return sym, ok
+}
+
+func (c *checker) errorf(pos Pos, format string, a ...interface{}) {
+	c.errs = append(c.errs, errorf(pos, format, a...))
+}
@@ -4,50 +4,137 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/nfukaaswa/nand2tetris/08/src/vm/ir"
 )
 
-func Compile(inputs []string, outDir string) error {
+type CompileOptions struct {
+	TypeCheck TypeCheckLevel
+
+	// SourceMap writes the map from the VM lines to the Jack code of each class to <class>.vm.map.
+	SourceMap bool
+
+	// Passes are run over the VM code of each class in order, before it is written.
+	Passes []ir.Pass
+}
+
+func Compile(inputs []string, outDir string, opts CompileOptions) error {
 	srcs, err := collectSourceFiles(inputs)
 	if err != nil {
 		return err
 	}
 
+	// parse all the classes first, for checking the calls across them.
+	// the syntax errors of all the files are reported together.
+	type source struct {
+		path string
+		code []byte
+		cls  *Class
+	}
+	var sources []source
+	var classes []*Class
+	var errs ErrorList
 	for _, src := range srcs {
-		file, err := os.Open(src)
+		code, err := os.ReadFile(src)
 		if err != nil {
 			return err
 		}
 
 		// tokenize
-		tokens, err := Tokenize(file)
+		tokens, err := Tokenize(src, bytes.NewReader(code))
 		if err != nil {
-			file.Close()
+			if e, ok := withSource(err, code).(*Error); ok {
+				errs = append(errs, e)
+				continue
+			}
 			return err
 		}
-		file.Close()
 
 		// analyze
 		cls, err := Analyze(tokens)
 		if err != nil {
-			return err
+			errs = append(errs, withSource(err, code).(ErrorList)...)
+			continue
 		}
+		for _, prev := range classes {
+			if prev.ClassName == cls.ClassName {
+				err := errorf(cls.Pos, "duplicate class '%s', previously declared at %s", cls.ClassName, prev.Pos)
+				errs = append(errs, withSource(err, code).(*Error))
+			}
+		}
+		sources = append(sources, source{path: src, code: code, cls: cls})
+		classes = append(classes, cls)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	prog := NewProgram(classes)
 
+	// compile and check all the classes before writing any file, so an error leaves no output
+	// of the classes before it.
+	type output struct {
+		name string
+		vm   *bytes.Buffer
+		m    *bytes.Buffer
+	}
+	var outputs []output
+	for _, src := range sources {
 		// compile
 		out := bytes.NewBuffer(nil)
-		if err := CompileClass(NewJackVM(out), cls); err != nil {
-			return err
+		vm := NewJackVM(out)
+		if err := CompileClass(vm, src.cls); err != nil {
+			return withSource(err, src.code)
+		}
+		if err := prog.CheckCalls(src.cls).Err(); err != nil {
+			return withSource(err, src.code)
 		}
 
-		// output
-		name := strings.TrimSuffix(filepath.Base(src), ".jack") + ".vm"
-		if err := writeFile(filepath.Join(outDir, name), out); err != nil {
+		// type check
+		if opts.TypeCheck == TypeCheckWarn || opts.TypeCheck == TypeCheckError {
+			if errs := TypeCheck(src.cls, prog); len(errs) > 0 {
+				withSource(errs, src.code)
+				if opts.TypeCheck == TypeCheckError {
+					return errs
+				}
+				for _, e := range errs {
+					e.Warning = true
+				}
+				fmt.Println(errs)
+			}
+		}
+
+		o := output{name: strings.TrimSuffix(filepath.Base(src.path), ".jack") + ".vm", vm: out}
+		sourceMap := vm.SourceMap()
+		if len(opts.Passes) > 0 {
+			var err error
+			if o.vm, sourceMap, err = optimize(o.name, out, sourceMap, opts.Passes); err != nil {
+				return err
+			}
+		}
+		if opts.SourceMap {
+			o.m = bytes.NewBuffer(nil)
+			if err := sourceMap.Write(o.m); err != nil {
+				return err
+			}
+		}
+		outputs = append(outputs, o)
+	}
+
+	// output
+	for _, o := range outputs {
+		if err := writeFile(filepath.Join(outDir, o.name), o.vm); err != nil {
 			fmt.Println(err)
 			return err
 		}
+		if o.m != nil {
+			if err := writeFile(filepath.Join(outDir, o.name+".map"), o.m); err != nil {
+				fmt.Println(err)
+				return err
+			}
+		}
 	}
 
 	// output os VMs
@@ -69,13 +156,14 @@ func collectSourceFiles(inputs []string) ([]string, error) {
 		if err != nil {
 			return nil, fmt.Errorf("os stat error: %v", err)
 		}
+		// the .jack files in the subdirectories belong to other programs, such as the tests of
+		// project 12, and are not collected
 		if info.IsDir() {
-			filepath.Walk(in, func(path string, info fs.FileInfo, err error) error {
-				if strings.HasSuffix(info.Name(), ".jack") {
-					srcs = append(srcs, path)
-				}
-				return err
-			})
+			paths, err := filepath.Glob(filepath.Join(in, "*.jack"))
+			if err != nil {
+				return nil, err
+			}
+			srcs = append(srcs, paths...)
 		}
 		if strings.HasSuffix(info.Name(), ".jack") {
 			srcs = append(srcs, in)
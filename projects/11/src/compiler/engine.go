@@ -2,8 +2,18 @@ package compiler
 
 import "fmt"
 
+// CompileClass writes the VM code of cls. The class is checked first, and nothing is written
+// when it has errors.
 func CompileClass(vm *JackVM, cls *Class) error {
-	newEngine(vm, cls).compile()
+	if err := Check(cls); err != nil {
+		return err
+	}
+
+	e := newEngine(vm, cls)
+	e.compile()
+	if e.err != nil {
+		return e.err
+	}
 	return vm.Err()
 }
 
@@ -12,6 +22,7 @@ type engine struct {
 	class             *Class
 	currentSubroutine SubRoutineType
 	symbols           SymbolTable
+	err               error
 }
 
 func newEngine(vm *JackVM, class *Class) *engine {
@@ -28,6 +39,7 @@ func (e *engine) compile() {
 	for _, dec := range e.class.SubRoutineDecs {
 		numVar := e.defineSubroutineSymbols(e.class, &dec)
 
+		e.vm.SetPos(dec.Pos)
 		e.vm.WriteFunction(e.class.ClassName+"."+dec.SubroutineName, numVar)
 
 		e.currentSubroutine = dec.SubRoutineType
@@ -56,13 +68,13 @@ func (e *engine) defineClassVarSymbols(cls *Class) (numField int64) {
 	for _, dec := range cls.ClassVarDecs {
 		switch dec.ClassVarDecType {
 		case ClassVarDecTypeField:
-			for _, name := range dec.VarNames {
-				e.symbols.Define(name, SymKind(dec.ClassVarDecType), string(dec.VarType), numField)
+			for i, name := range dec.VarNames {
+				e.symbols.Define(name, SymKind(dec.ClassVarDecType), string(dec.VarType), numField, dec.NamePos[i])
 				numField++
 			}
 		case ClassVarDecTypeStatic:
-			for _, name := range dec.VarNames {
-				e.symbols.Define(name, SymKind(dec.ClassVarDecType), string(dec.VarType), numStatic)
+			for i, name := range dec.VarNames {
+				e.symbols.Define(name, SymKind(dec.ClassVarDecType), string(dec.VarType), numStatic, dec.NamePos[i])
 				numStatic++
 			}
 		}
@@ -79,13 +91,13 @@ func (e *engine) defineSubroutineSymbols(cls *Class, dec *SubroutineDec) (numVar
 	}
 
 	for _, param := range dec.ParameterList.Paramters {
-		e.symbols.Define(param.VarName, SymKindArg, string(param.VarType), numParam)
+		e.symbols.Define(param.VarName, SymKindArg, string(param.VarType), numParam, param.Pos)
 		numParam++
 	}
 
 	for _, dec := range dec.SubroutineBody.VarDecs {
-		for _, name := range dec.VarNames {
-			e.symbols.Define(name, SymKindVar, string(dec.VarType), numVar)
+		for i, name := range dec.VarNames {
+			e.symbols.Define(name, SymKindVar, string(dec.VarType), numVar, dec.NamePos[i])
 			numVar++
 		}
 	}
@@ -108,10 +120,16 @@ func (e *engine) compileStatement(s *Statement, label *label) {
 }
 
 func (e *engine) compileLetStatement(s *LetStatement) {
+	e.vm.SetPos(s.Pos)
 	e.compileExpression(&s.VarValue)
 
+	sym := e.lookup(s.VarName, s.VarPos)
+	if sym == nil {
+		return
+	}
+
 	if s.Index != nil {
-		e.vm.WritePush(sym2VM(e.symbols.Get(s.VarName)))
+		e.vm.WritePush(sym2VM(sym))
 		e.compileExpression(s.Index)
 		e.vm.WriteArithmetic(VMCmdADD)
 		e.vm.WritePop(VMSegPOINTER, 1)
@@ -119,13 +137,14 @@ func (e *engine) compileLetStatement(s *LetStatement) {
 		return
 	}
 
-	e.vm.WritePop(sym2VM(e.symbols.Get(s.VarName)))
+	e.vm.WritePop(sym2VM(sym))
 }
 
 func (e *engine) compileIfStatement(s *IfStatement, label *label) {
 	elseL := label.Get()
 	endL := label.Get()
 
+	e.vm.SetPos(s.Pos)
 	e.compileExpression(&s.Condition)
 	e.vm.WriteArithmetic(VMCmdNOT)
 	e.vm.WriteIfGoto(elseL)
@@ -145,6 +164,7 @@ func (e *engine) compileWhileStatement(s *WhileStatement, label *label) {
 	loopL := label.Get()
 	endL := label.Get()
 
+	e.vm.SetPos(s.Pos)
 	e.vm.WriteLabel(loopL)
 	e.compileExpression(&s.Condition)
 	e.vm.WriteArithmetic(VMCmdNOT)
@@ -152,16 +172,19 @@ func (e *engine) compileWhileStatement(s *WhileStatement, label *label) {
 	for _, s := range s.Statements.Statements {
 		e.compileStatement(&s, label)
 	}
+	e.vm.SetPos(s.Pos)
 	e.vm.WriteGoto(loopL)
 	e.vm.WriteLabel(endL)
 }
 
 func (e *engine) compileDoStatement(s *DoStatement) {
+	e.vm.SetPos(s.Pos)
 	e.compileSubroutineCall(&s.SubroutineCall)
 	e.vm.WritePop(VMSegTEMP, 0)
 }
 
 func (e *engine) compileReturnStatement(s *ReturnStatement) {
+	e.vm.SetPos(s.Pos)
 	if s.Expression != nil {
 		e.compileExpression(s.Expression)
 	} else {
@@ -203,10 +226,14 @@ func (e *engine) compileTerm(t *Term) {
 		}
 
 	case TermTypeVarName:
-		e.vm.WritePush(sym2VM(e.symbols.Get(*t.VarName)))
+		if sym := e.lookup(*t.VarName, t.Pos); sym != nil {
+			e.vm.WritePush(sym2VM(sym))
+		}
 
 	case TermTypeVarNameIndex:
-		e.vm.WritePush(sym2VM(e.symbols.Get(*t.VarName)))
+		if sym := e.lookup(*t.VarName, t.Pos); sym != nil {
+			e.vm.WritePush(sym2VM(sym))
+		}
 		e.compileExpression(t.Index)
 		e.vm.WriteArithmetic(VMCmdADD)
 		e.vm.WritePop(VMSegPOINTER, 1)
@@ -254,7 +281,9 @@ func (e *engine) compileSubroutineCall(call *SubroutineCall) {
 	for _, exp := range call.ExpressionList.Expressions {
 		e.compileExpression(&exp)
 	}
+	pos := e.vm.SetPos(call.Pos)
 	e.vm.WriteCall(name, numArgs)
+	e.vm.SetPos(pos)
 }
 
 func (e *engine) compileOp(op *Op) {
@@ -289,6 +318,15 @@ func (e *engine) compileUnaryOp(op *UnaryOp) {
 	}
 }
 
+// lookup returns the symbol of name, and records the error when it is not defined.
+func (e *engine) lookup(name string, pos Pos) *Symbol {
+	sym := e.symbols.Get(name)
+	if sym == nil && e.err == nil {
+		e.err = errorf(pos, "undeclared variable '%s'", name)
+	}
+	return sym
+}
+
 func sym2VM(s *Symbol) (VMSeg, int64) {
 	if s == nil {
 		return VMSeg(""), -1
@@ -0,0 +1,79 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a position in a source file. Line and Col start at 1, and Col counts bytes.
+type Pos struct {
+	File string `json:"-"`
+	Line int
+	Col  int
+}
+
+func (p Pos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// Error is an error at a position of the source. When Source is set, the source line is printed
+// under the message with a caret at the column. Warning marks the errors which do not stop the
+// compilation.
+type Error struct {
+	Pos     Pos
+	Msg     string
+	Source  string
+	Warning bool
+}
+
+func errorf(pos Pos, format string, a ...interface{}) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *Error) Error() string {
+	msg := e.Pos.String() + ": " + e.Msg
+	if e.Warning {
+		msg = e.Pos.String() + ": warning: " + e.Msg
+	}
+	if e.Source == "" || e.Pos.Col < 1 {
+		return msg
+	}
+
+	var caret strings.Builder
+	prefix := e.Source
+	if e.Pos.Col-1 < len(prefix) {
+		prefix = prefix[:e.Pos.Col-1]
+	}
+	for _, r := range prefix {
+		if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+	return msg + "\n" + e.Source + "\n" + caret.String()
+}
+
+// withSource sets the source lines of the errors in err, for printing the snippets.
+func withSource(err error, src []byte) error {
+	lines := strings.Split(string(src), "\n")
+	set := func(e *Error) {
+		if e.Source == "" && e.Pos.Line >= 1 && e.Pos.Line <= len(lines) {
+			e.Source = strings.TrimRight(lines[e.Pos.Line-1], "\r")
+		}
+	}
+
+	switch e := err.(type) {
+	case *Error:
+		set(e)
+	case ErrorList:
+		for _, e := range e {
+			set(e)
+		}
+	}
+	return err
+}
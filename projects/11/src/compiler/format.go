@@ -0,0 +1,337 @@
+package compiler
+
+import (
+	"bytes"
+	"strings"
+)
+
+const formatIndent = "    "
+
+// Format reprints the Jack source of path canonically: one declaration or statement per line,
+// blocks indented by 4 spaces, and a space around binary operators and after commas. The
+// comments are kept where they are, and a blank line between the lines is kept as one.
+func Format(path string, src []byte) ([]byte, error) {
+	tokens, err := Tokenize(path, bytes.NewReader(src))
+	if err != nil {
+		return nil, withSource(err, src)
+	}
+	cls, err := Analyze(tokens)
+	if err != nil {
+		return nil, withSource(err, src)
+	}
+
+	f := formatter{tokens: tokens}
+	f.class(cls)
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.buf.WriteByte('\n')
+	return f.buf.Bytes(), nil
+}
+
+// formatter prints the tokens of the source in the layout of the AST. The AST decides only the
+// spaces and the line breaks, and each token is printed with its comments.
+type formatter struct {
+	buf    bytes.Buffer
+	tokens Tokens
+	next   int
+	indent int
+
+	line    int  // the source line where the last token or comment ends
+	newline bool // the next token starts a new line
+	space   bool // the next token is separated by a space
+	tight   bool // no blank line before the next token
+	err     error
+}
+
+func (f *formatter) nl() { f.newline = true }
+func (f *formatter) sp() { f.space = true }
+
+// token prints the next token, which must be value.
+func (f *formatter) token(value string) {
+	if f.err != nil {
+		return
+	}
+	if f.next >= len(f.tokens) || f.tokens[f.next].Value != value {
+		pos := Pos{}
+		if f.next < len(f.tokens) {
+			pos = f.tokens[f.next].Pos
+		}
+		f.err = errorf(pos, "format: expected '%s'", value)
+		return
+	}
+	f.anyToken()
+}
+
+// anyToken prints the next token as it is.
+func (f *formatter) anyToken() {
+	t := &f.tokens[f.next]
+	f.next++
+
+	f.leading(t)
+	text := t.Value
+	if t.Type == TokenTypeStringConst {
+		text = `"` + text + `"`
+	}
+	f.write(text, t.Line, t.Line)
+	f.tight = text == "{"
+
+	for _, c := range t.Trailing {
+		if c.Line == t.Line {
+			f.sp()
+		} else {
+			f.nl()
+		}
+		f.comment(c)
+	}
+}
+
+// peek reports whether the next token is value.
+func (f *formatter) peek(value string) bool {
+	return f.err == nil && f.next < len(f.tokens) && f.tokens[f.next].Value == value
+}
+
+// leading prints the leading comments of t, each on its own line.
+func (f *formatter) leading(t *Token) {
+	for _, c := range t.Leading {
+		f.nl()
+		f.comment(c)
+		if c.EndLine < t.Line {
+			f.nl()
+		}
+	}
+	t.Leading = nil
+}
+
+func (f *formatter) comment(c Comment) {
+	lines := strings.Split(c.Text, "\n")
+	for i := 1; i < len(lines); i++ {
+		// the lines of a doc comment are aligned to the first one
+		if s := strings.TrimLeft(lines[i], " \t"); strings.HasPrefix(s, "*") {
+			lines[i] = strings.Repeat(formatIndent, f.indent) + " " + s
+		}
+	}
+	f.write(strings.Join(lines, "\n"), c.Line, c.EndLine)
+	f.tight = false
+	if strings.HasPrefix(c.Text, "//") {
+		f.nl()
+	} else {
+		f.sp()
+	}
+}
+
+func (f *formatter) write(text string, line, endLine int) {
+	if f.newline && f.buf.Len() > 0 {
+		f.buf.WriteByte('\n')
+		if line > f.line+1 && !f.tight {
+			f.buf.WriteByte('\n')
+		}
+		f.buf.WriteString(strings.Repeat(formatIndent, f.indent))
+	} else if f.space {
+		f.buf.WriteByte(' ')
+	}
+	f.buf.WriteString(text)
+	f.line = endLine
+	f.newline, f.space = false, false
+}
+
+func (f *formatter) openBlock() {
+	f.sp()
+	f.token("{")
+	f.indent++
+}
+
+// closeBlock prints the comments before '}' in the block, and then '}'.
+func (f *formatter) closeBlock() {
+	if f.err == nil && f.next < len(f.tokens) {
+		f.leading(&f.tokens[f.next])
+	}
+	f.indent--
+	f.tight = true
+	f.nl()
+	f.token("}")
+}
+
+func (f *formatter) class(cls *Class) {
+	f.token("class")
+	f.sp()
+	f.token(cls.ClassName)
+	f.openBlock()
+	for _, dec := range cls.ClassVarDecs {
+		f.nl()
+		f.token(string(dec.ClassVarDecType))
+		f.sp()
+		f.token(string(dec.VarType))
+		f.sp()
+		f.names(dec.VarNames)
+		f.token(";")
+	}
+	for i := range cls.SubRoutineDecs {
+		f.subroutine(&cls.SubRoutineDecs[i])
+	}
+	f.closeBlock()
+}
+
+func (f *formatter) names(names []string) {
+	for i, name := range names {
+		if i > 0 {
+			f.token(",")
+			f.sp()
+		}
+		f.token(name)
+	}
+}
+
+func (f *formatter) subroutine(dec *SubroutineDec) {
+	f.nl()
+	f.token(string(dec.SubRoutineType))
+	f.sp()
+	f.token(string(dec.RetType))
+	f.sp()
+	f.token(dec.SubroutineName)
+	f.token("(")
+	for i, param := range dec.ParameterList.Paramters {
+		if i > 0 {
+			f.token(",")
+			f.sp()
+		}
+		f.token(string(param.VarType))
+		f.sp()
+		f.token(param.VarName)
+	}
+	f.token(")")
+
+	f.openBlock()
+	for _, v := range dec.SubroutineBody.VarDecs {
+		f.nl()
+		f.token("var")
+		f.sp()
+		f.token(string(v.VarType))
+		f.sp()
+		f.names(v.VarNames)
+		f.token(";")
+	}
+	f.statements(&dec.SubroutineBody.Statements)
+	f.closeBlock()
+}
+
+func (f *formatter) statements(s *Statements) {
+	for _, st := range s.Statements {
+		f.nl()
+		switch st.Type {
+		case StatementTypeLet:
+			f.token("let")
+			f.sp()
+			f.token(st.LetStatement.VarName)
+			if st.LetStatement.Index != nil {
+				f.token("[")
+				f.expression(st.LetStatement.Index)
+				f.token("]")
+			}
+			f.sp()
+			f.token("=")
+			f.sp()
+			f.expression(&st.LetStatement.VarValue)
+			f.token(";")
+
+		case StatementTypeIf:
+			f.token("if")
+			f.condition(&st.IfStatement.Condition)
+			f.openBlock()
+			f.statements(&st.IfStatement.IfStatements)
+			f.closeBlock()
+			// an empty else block is not in the AST
+			if f.peek("else") {
+				f.sp()
+				f.token("else")
+				f.openBlock()
+				f.statements(&st.IfStatement.ElseStatements)
+				f.closeBlock()
+			}
+
+		case StatementTypeWhile:
+			f.token("while")
+			f.condition(&st.WhileStatement.Condition)
+			f.openBlock()
+			f.statements(&st.WhileStatement.Statements)
+			f.closeBlock()
+
+		case StatementTypeDo:
+			f.token("do")
+			f.sp()
+			f.subroutineCall(&st.DoStatement.SubroutineCall)
+			f.token(";")
+
+		case StatementTypeReturn:
+			f.token("return")
+			if st.ReturnStatement.Expression != nil {
+				f.sp()
+				f.expression(st.ReturnStatement.Expression)
+			}
+			f.token(";")
+		}
+	}
+}
+
+func (f *formatter) condition(exp *Expression) {
+	f.sp()
+	f.token("(")
+	f.expression(exp)
+	f.token(")")
+}
+
+func (f *formatter) expression(exp *Expression) {
+	f.term(&exp.Term)
+	for i := range exp.Tail {
+		f.sp()
+		f.token(string(exp.Tail[i].Op))
+		f.sp()
+		f.term(&exp.Tail[i].Term)
+	}
+}
+
+func (f *formatter) term(t *Term) {
+	switch t.Type {
+	case TermTypeIntegerConst:
+		if f.err == nil {
+			f.anyToken()
+		}
+	case TermTypeStringConst:
+		f.token(*t.StringConst)
+	case TermTypeKeywordConst:
+		f.token(*t.KeywordConstant)
+	case TermTypeVarName:
+		f.token(*t.VarName)
+	case TermTypeVarNameIndex:
+		f.token(*t.VarName)
+		f.token("[")
+		f.expression(t.Index)
+		f.token("]")
+	case TermTypeSubroutineCall:
+		f.subroutineCall(t.SubroutineCall)
+	case TermTypeExpression:
+		f.token("(")
+		f.expression(t.Expression)
+		f.token(")")
+	case TermTypeUnaryOp:
+		f.token(string(*t.UnaryOp))
+		f.term(t.UnaryOpTerm)
+	}
+}
+
+func (f *formatter) subroutineCall(call *SubroutineCall) {
+	if call.Receiver != nil {
+		f.token(*call.Receiver)
+		f.token(".")
+	}
+	f.token(call.SubroutineName)
+	f.token("(")
+	for i := range call.ExpressionList.Expressions {
+		if i > 0 {
+			f.token(",")
+			f.sp()
+		}
+		f.expression(&call.ExpressionList.Expressions[i])
+	}
+	f.token(")")
+}
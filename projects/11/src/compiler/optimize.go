@@ -0,0 +1,43 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/nfukaaswa/nand2tetris/08/src/vm"
+	"github.com/nfukaaswa/nand2tetris/08/src/vm/ir"
+)
+
+// optimize runs the passes over the VM code of a class, and returns the new code with its source
+// map. The commands keep their lines in the code through the passes, so the source map is mapped
+// to the new lines by them.
+func optimize(path string, code io.Reader, m VMSourceMap, passes []ir.Pass) (*bytes.Buffer, VMSourceMap, error) {
+	file := vm.SourceFile{Path: path}
+	p := vm.NewParser(path, code)
+	for {
+		cmd, err := p.NextCommand()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		file.Commands = append(file.Commands, cmd)
+	}
+	prog := ir.Build([]vm.SourceFile{file})
+	ir.NewPassManager(passes...).Run(prog)
+
+	out := bytes.NewBuffer(nil)
+	if err := prog.Files[0].Write(out); err != nil {
+		return nil, nil, err
+	}
+	var newMap VMSourceMap
+	for i, cmd := range prog.Files[0].Commands() {
+		pos, ok := m.Lookup(cmd.Line)
+		if n := len(newMap); ok && (n == 0 || newMap[n-1].Pos != pos) {
+			newMap = append(newMap, VMSourceMapEntry{Line: i + 1, Pos: pos})
+		}
+	}
+	return out, newMap, nil
+}
@@ -0,0 +1,338 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Program indexes the subroutines of the classes compiled together and of the OS, for checking
+// the calls across the classes.
+type Program struct {
+	classes map[string]*ClassInfo
+}
+
+type ClassInfo struct {
+	Name        string
+	Subroutines map[string]*Signature
+	OS          bool
+	Pos         Pos
+}
+
+type Signature struct {
+	Class      string
+	Name       string
+	Kind       SubRoutineType
+	RetType    Type
+	Params     []Type
+	ParamNames []string
+	Pos        Pos
+}
+
+// NewProgram indexes classes and the OS. A class of the program replaces the OS class of the same name.
+func NewProgram(classes []*Class) *Program {
+	p := &Program{classes: map[string]*ClassInfo{}}
+	for _, cls := range osClasses {
+		p.add(cls, true)
+	}
+	for _, cls := range classes {
+		p.add(cls, false)
+	}
+	// Sys.init calls Main.main of the program, which is missing when the OS is compiled alone
+	if sys := p.classes["Sys"]; sys != nil && !sys.OS && p.classes["Main"] == nil {
+		p.add(mainEntry, true)
+	}
+	return p
+}
+
+var mainEntry = &Class{
+	ClassName: "Main",
+	SubRoutineDecs: []SubroutineDec{
+		{SubRoutineType: SubRoutineTypeFunction, RetType: TypeVoid, SubroutineName: "main"},
+	},
+}
+
+func (p *Program) add(cls *Class, os bool) {
+	info := &ClassInfo{Name: cls.ClassName, Subroutines: map[string]*Signature{}, OS: os, Pos: cls.Pos}
+	for _, dec := range cls.SubRoutineDecs {
+		sig := &Signature{
+			Class:   cls.ClassName,
+			Name:    dec.SubroutineName,
+			Kind:    dec.SubRoutineType,
+			RetType: dec.RetType,
+			Pos:     dec.Pos,
+		}
+		for _, param := range dec.ParameterList.Paramters {
+			sig.Params = append(sig.Params, param.VarType)
+			sig.ParamNames = append(sig.ParamNames, param.VarName)
+		}
+		info.Subroutines[dec.SubroutineName] = sig
+	}
+	p.classes[cls.ClassName] = info
+}
+
+// Class returns the class of name, or nil when it is not in the program nor the OS.
+func (p *Program) Class(name string) *ClassInfo {
+	return p.classes[name]
+}
+
+// Subroutine returns the subroutine class.name, or nil when it is not declared.
+func (p *Program) Subroutine(class, name string) *Signature {
+	info := p.classes[class]
+	if info == nil {
+		return nil
+	}
+	return info.Subroutines[name]
+}
+
+// CheckCalls reports the unknown classes in declarations and calls, the unknown subroutines,
+// the calls whose form does not match the kind of the subroutine, and the arity mismatches.
+func (p *Program) CheckCalls(cls *Class) ErrorList {
+	c := callChecker{prog: p, class: cls, classVars: map[string]Type{}}
+	for _, dec := range cls.ClassVarDecs {
+		for i, name := range dec.VarNames {
+			c.classVars[name] = dec.VarType
+			c.checkType(dec.VarType, dec.NamePos[i])
+		}
+	}
+	for i := range cls.SubRoutineDecs {
+		c.checkSubroutine(&cls.SubRoutineDecs[i])
+	}
+	return c.errs
+}
+
+type callChecker struct {
+	prog      *Program
+	class     *Class
+	classVars map[string]Type
+
+	current *SubroutineDec
+	vars    map[string]Type
+	errs    ErrorList
+}
+
+func (c *callChecker) checkSubroutine(dec *SubroutineDec) {
+	c.current = dec
+	c.vars = map[string]Type{}
+	if dec.RetType != TypeVoid {
+		c.checkType(dec.RetType, dec.Pos)
+	}
+	for _, param := range dec.ParameterList.Paramters {
+		c.vars[param.VarName] = param.VarType
+		c.checkType(param.VarType, param.Pos)
+	}
+	for _, v := range dec.SubroutineBody.VarDecs {
+		for i, name := range v.VarNames {
+			c.vars[name] = v.VarType
+			c.checkType(v.VarType, v.NamePos[i])
+		}
+	}
+	for _, call := range subroutineCalls(&dec.SubroutineBody.Statements) {
+		c.checkCall(call)
+	}
+}
+
+func (c *callChecker) checkType(ty Type, pos Pos) {
+	if !isPrimitive(ty) && c.prog.Class(string(ty)) == nil {
+		c.errorf(pos, "unknown class '%s'", ty)
+	}
+}
+
+func (c *callChecker) checkCall(call *SubroutineCall) {
+	class, method := c.class.ClassName, true
+	if call.Receiver != nil {
+		if ty, ok := c.variable(*call.Receiver); ok {
+			if isPrimitive(ty) {
+				c.errorf(call.Pos, "'%s' of type %s has no subroutine '%s'", *call.Receiver, ty, call.SubroutineName)
+				return
+			}
+			class = string(ty)
+		} else {
+			class, method = *call.Receiver, false
+			if c.prog.Class(class) == nil {
+				c.errorf(call.Pos, "unknown class '%s'", class)
+				return
+			}
+		}
+	}
+	if c.prog.Class(class) == nil {
+		// the type of the variable is reported as an unknown class
+		return
+	}
+
+	sig := c.prog.Subroutine(class, call.SubroutineName)
+	if sig == nil {
+		c.errorf(call.Pos, "unknown subroutine '%s.%s'", class, call.SubroutineName)
+		return
+	}
+	switch {
+	case method && sig.Kind != SubRoutineTypeMethod:
+		c.errorf(call.Pos, "%s '%s.%s' is called as a method", sig.Kind, class, sig.Name)
+	case !method && sig.Kind == SubRoutineTypeMethod:
+		c.errorf(call.Pos, "method '%s.%s' is called as a function", class, sig.Name)
+	}
+	if n := len(call.ExpressionList.Expressions); n != len(sig.Params) {
+		c.errorf(call.Pos, "'%s.%s' expects %d arguments, but got %d", class, sig.Name, len(sig.Params), n)
+	}
+}
+
+func (c *callChecker) variable(name string) (Type, bool) {
+	if ty, ok := c.vars[name]; ok {
+		return ty, true
+	}
+	ty, ok := c.classVars[name]
+	return ty, ok
+}
+
+func (c *callChecker) errorf(pos Pos, format string, a ...interface{}) {
+	c.errs = append(c.errs, errorf(pos, format, a...))
+}
+
+// subroutineCalls returns the subroutine calls in s in the order of the source.
+func subroutineCalls(s *Statements) []*SubroutineCall {
+	var calls []*SubroutineCall
+	var expression func(exp *Expression)
+	var term func(t *Term)
+	term = func(t *Term) {
+		switch t.Type {
+		case TermTypeVarNameIndex:
+			expression(t.Index)
+		case TermTypeSubroutineCall:
+			calls = append(calls, t.SubroutineCall)
+			for i := range t.SubroutineCall.ExpressionList.Expressions {
+				expression(&t.SubroutineCall.ExpressionList.Expressions[i])
+			}
+		case TermTypeExpression:
+			expression(t.Expression)
+		case TermTypeUnaryOp:
+			term(t.UnaryOpTerm)
+		}
+	}
+	expression = func(exp *Expression) {
+		term(&exp.Term)
+		for i := range exp.Tail {
+			term(&exp.Tail[i].Term)
+		}
+	}
+
+	var statements func(s *Statements)
+	statements = func(s *Statements) {
+		for _, st := range s.Statements {
+			switch st.Type {
+			case StatementTypeLet:
+				if st.LetStatement.Index != nil {
+					expression(st.LetStatement.Index)
+				}
+				expression(&st.LetStatement.VarValue)
+			case StatementTypeIf:
+				expression(&st.IfStatement.Condition)
+				statements(&st.IfStatement.IfStatements)
+				statements(&st.IfStatement.ElseStatements)
+			case StatementTypeWhile:
+				expression(&st.WhileStatement.Condition)
+				statements(&st.WhileStatement.Statements)
+			case StatementTypeDo:
+				call := &st.DoStatement.SubroutineCall
+				calls = append(calls, call)
+				for i := range call.ExpressionList.Expressions {
+					expression(&call.ExpressionList.Expressions[i])
+				}
+			case StatementTypeReturn:
+				if st.ReturnStatement.Expression != nil {
+					expression(st.ReturnStatement.Expression)
+				}
+			}
+		}
+	}
+	statements(s)
+	return calls
+}
+
+// osAPI declares the subroutines of the OS in 11/src/compiler/os.
+const osAPI = `
+class Math {
+	function void init() {}
+	function int abs(int x) {}
+	function int multiply(int x, int y) {}
+	function int divide(int x, int y) {}
+	function int min(int x, int y) {}
+	function int max(int x, int y) {}
+	function int sqrt(int x) {}
+}
+class String {
+	constructor String new(int maxLength) {}
+	method void dispose() {}
+	method int length() {}
+	method char charAt(int j) {}
+	method void setCharAt(int j, char c) {}
+	method String appendChar(char c) {}
+	method void eraseLastChar() {}
+	method int intValue() {}
+	method void setInt(int j) {}
+	function char backSpace() {}
+	function char doubleQuote() {}
+	function char newLine() {}
+}
+class Array {
+	function Array new(int size) {}
+	method void dispose() {}
+}
+class Output {
+	function void init() {}
+	function void moveCursor(int i, int j) {}
+	function void printChar(char c) {}
+	function void printString(String s) {}
+	function void printInt(int i) {}
+	function void println() {}
+	function void backSpace() {}
+}
+class Screen {
+	function void init() {}
+	function void clearScreen() {}
+	function void setColor(boolean b) {}
+	function void drawPixel(int x, int y) {}
+	function void drawLine(int x1, int y1, int x2, int y2) {}
+	function void drawRectangle(int x1, int y1, int x2, int y2) {}
+	function void drawCircle(int x, int y, int r) {}
+}
+class Keyboard {
+	function void init() {}
+	function char keyPressed() {}
+	function char readChar() {}
+	function String readLine(String message) {}
+	function int readInt(String message) {}
+}
+class Memory {
+	function void init() {}
+	function int peek(int address) {}
+	function void poke(int address, int value) {}
+	function int alloc(int size) {}
+	function void deAlloc(Array o) {}
+}
+class Sys {
+	function void init() {}
+	function void halt() {}
+	function void error(int errorCode) {}
+	function void wait(int duration) {}
+}
+`
+
+var osClasses = parseOSAPI()
+
+func parseOSAPI() []*Class {
+	var classes []*Class
+	for _, src := range strings.SplitAfter(osAPI, "\n}\n") {
+		if strings.TrimSpace(src) == "" {
+			continue
+		}
+		tokens, err := Tokenize("os", strings.NewReader(src))
+		if err != nil {
+			panic(fmt.Sprintf("invalid OS API: %v", err))
+		}
+		cls, err := Analyze(tokens)
+		if err != nil {
+			panic(fmt.Sprintf("invalid OS API: %v", err))
+		}
+		classes = append(classes, cls)
+	}
+	return classes
+}
@@ -0,0 +1,66 @@
+package compiler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VMSourceMapEntry maps the VM lines from Line up to the next entry to the Jack code at Pos.
+type VMSourceMapEntry struct {
+	Line int
+	Pos  Pos
+}
+
+// VMSourceMap is the entries sorted by the line. It is written as a line per entry, with the VM
+// line, and the file, the line and the column of the Jack code separated by tabs.
+type VMSourceMap []VMSourceMapEntry
+
+// Lookup returns the position of the Jack code compiled to the VM line.
+func (m VMSourceMap) Lookup(line int) (Pos, bool) {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Line > line })
+	if i == 0 {
+		return Pos{}, false
+	}
+	return m[i-1].Pos, true
+}
+
+func (m VMSourceMap) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range m {
+		fmt.Fprintf(bw, "%d\t%s\t%d\t%d\n", e.Line, e.Pos.File, e.Pos.Line, e.Pos.Col)
+	}
+	return bw.Flush()
+}
+
+// ReadVMSourceMap reads the map written by VMSourceMap.Write. path is only used for the errors.
+func ReadVMSourceMap(path string, r io.Reader) (VMSourceMap, error) {
+	var m VMSourceMap
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		pos := Pos{File: path, Line: line, Col: 1}
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 {
+			return nil, errorf(pos, "invalid entry")
+		}
+		var nums [3]int
+		for i, f := range []string{fields[0], fields[2], fields[3]} {
+			n, err := strconv.Atoi(f)
+			if err != nil {
+				return nil, errorf(pos, "invalid number '%s'", f)
+			}
+			nums[i] = n
+		}
+		if len(m) > 0 && m[len(m)-1].Line > nums[0] {
+			return nil, errorf(pos, "line not sorted")
+		}
+		m = append(m, VMSourceMapEntry{Line: nums[0], Pos: Pos{File: fields[1], Line: nums[1], Col: nums[2]}})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
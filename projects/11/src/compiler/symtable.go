@@ -4,6 +4,7 @@ type Symbol struct {
 	Kind  SymKind
 	Type  string
 	Index int64
+	Pos   Pos
 }
 
 type SymKind string
@@ -31,10 +32,11 @@ func (t *SymbolTable) Subroutine() {
 	t.subroutineTable = map[string]Symbol{}
 }
 
-func (t *SymbolTable) Define(name string, kind SymKind, ty string, index int64) {
-	sym := Symbol{Kind: kind, Type: ty, Index: index}
+func (t *SymbolTable) Define(name string, kind SymKind, ty string, index int64, pos Pos) {
+	sym := Symbol{Kind: kind, Type: ty, Index: index, Pos: pos}
 	if t.subroutineTable != nil {
 		t.subroutineTable[name] = sym
+		return
 	}
 	t.classTable[name] = sym
 }
@@ -2,16 +2,29 @@ package compiler
 
 import (
 	"bufio"
-	"fmt"
 	"io"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
 type Token struct {
 	Type  TokenType
 	Value string
-	Line  int
+	Pos
+
+	// Leading holds the comments on the lines between the previous token and the token, and
+	// Trailing holds the comments after the token on its line. The comments at the end of the
+	// file are the trailing ones of the last token.
+	Leading  []Comment `json:",omitempty"`
+	Trailing []Comment `json:",omitempty"`
+}
+
+// Comment is a comment with its delimiters. The lines of a block comment are joined with "\n".
+type Comment struct {
+	Text string
+	Pos
+	EndLine int
 }
 
 type Tokens []Token
@@ -55,28 +68,33 @@ var (
 		'{', '}', '(', ')', '[', ']', '.', ',', ';', '+', '-', '*', '/', '&', '|', ',', '<', '>', '=', '~',
 	}
 
-	spaces = []rune{' ', '\t'}
+	spaces = []rune{' ', '\t', '\r', '\f', '\v'}
 )
 
-func Tokenize(input io.Reader) (Tokens, error) {
-	t := newTokenizer(input)
+// Tokenize splits the source of path into tokens. path is only used for the positions of tokens and errors.
+func Tokenize(path string, input io.Reader) (Tokens, error) {
+	t := newTokenizer(path, input)
 	return t.do()
 }
 
 type tokenizer struct {
 	scanner      *bufio.Scanner
+	file         string
 	line         int
+	tokens       []Token
+	comments     []Comment
 	rangeComment bool
+	comment      Comment
 }
 
-func newTokenizer(input io.Reader) tokenizer {
+func newTokenizer(path string, input io.Reader) tokenizer {
 	return tokenizer{
 		scanner: bufio.NewScanner(input),
+		file:    path,
 	}
 }
 
 func (t *tokenizer) do() ([]Token, error) {
-	var ret []Token
 	for {
 		line, n, err := t.nextLine()
 		if err == io.EOF {
@@ -86,58 +104,78 @@ func (t *tokenizer) do() ([]Token, error) {
 			return nil, err
 		}
 
-		tokens, err := t.tokenize(line, n)
-		if err != nil {
+		if err := t.tokenize(line, n); err != nil {
 			return nil, err
 		}
-		ret = append(ret, tokens...)
 	}
-	return ret, nil
+	if n := len(t.tokens); n > 0 {
+		t.tokens[n-1].Trailing = append(t.tokens[n-1].Trailing, t.comments...)
+	}
+	return t.tokens, nil
 }
 
-func (t *tokenizer) tokenize(code string, line int) ([]Token, error) {
-	var tokens []Token
-
-	for {
-		if len(code) == 0 {
-			break
-		}
+// tokenize splits a line whose comments are blanked out, so that the columns are kept.
+func (t *tokenizer) tokenize(code string, line int) error {
+	for col := 1; len(code) > 0; {
+		pos := Pos{File: t.file, Line: line, Col: col}
 
+		n := 1
 		ch := rune(code[0])
 		switch {
 		case runeInclude(spaces, ch): // space
-			code = code[1:]
 
 		case runeInclude(symbols, ch): // symbol
-			tokens = append(tokens, Token{Type: TokenTypeSymbol, Value: string(ch), Line: line})
-			code = code[1:]
+			t.add(Token{Type: TokenTypeSymbol, Value: string(ch), Pos: pos})
 
 		case ch == '"': // string
 			s := tokenStrRegexp.FindString(code)
 			if s == "" {
-				return nil, fmt.Errorf("string not closed: line %d", line)
+				return errorf(pos, "string not closed")
 			}
-			tokens = append(tokens, Token{Type: TokenTypeStringConst, Value: strings.Trim(s, `"`), Line: line})
-			code = code[len(s):]
+			t.add(Token{Type: TokenTypeStringConst, Value: strings.Trim(s, `"`), Pos: pos})
+			n = len(s)
 
 		case '0' <= ch && ch <= '9': // int
 			s := tokenIntRegexp.FindString(code)
-			tokens = append(tokens, Token{Type: TokenTypeIntegerConst, Value: s, Line: line})
-			code = code[len(s):]
+			t.add(Token{Type: TokenTypeIntegerConst, Value: s, Pos: pos})
+			n = len(s)
 
 		default: // keyword or identifier
 			i := tokenIdentRegexp.FindString(code)
+			if i == "" {
+				return errorf(pos, "unexpected character %q", ch)
+			}
 			if stringInclude(keywords, i) {
-				tokens = append(tokens, Token{Type: TokenTypeKeyword, Value: i, Line: line})
+				t.add(Token{Type: TokenTypeKeyword, Value: i, Pos: pos})
 			} else {
-				tokens = append(tokens, Token{Type: TokenTypeIdentifier, Value: i, Line: line})
+				t.add(Token{Type: TokenTypeIdentifier, Value: i, Pos: pos})
 			}
-
-			code = code[len(i):]
+			n = len(i)
 		}
+
+		code = code[n:]
+		col += n
 	}
+	return nil
+}
 
-	return tokens, nil
+// add appends token, attaching the comments before it as its leading trivia, or as the trailing
+// trivia of the previous token when they are on its line.
+func (t *tokenizer) add(token Token) {
+	i := 0
+	for ; i < len(t.comments); i++ {
+		c := t.comments[i]
+		if c.Line > token.Line || c.Line == token.Line && c.Col > token.Col {
+			break
+		}
+		if n := len(t.tokens); n > 0 && t.tokens[n-1].Line == c.Line {
+			t.tokens[n-1].Trailing = append(t.tokens[n-1].Trailing, c)
+		} else {
+			token.Leading = append(token.Leading, c)
+		}
+	}
+	t.comments = t.comments[i:]
+	t.tokens = append(t.tokens, token)
 }
 
 var (
@@ -151,16 +189,15 @@ func (t *tokenizer) nextLine() (string, int, error) {
 	for {
 		t.line++
 		if !t.scanner.Scan() {
+			if err := t.scanner.Err(); err != nil {
+				return "", t.line, err
+			}
 			if t.rangeComment {
-				return "", t.line, fmt.Errorf("comment not closed: line %d", t.line)
+				return "", t.line, errorf(t.comment.Pos, "comment not closed")
 			}
 			return "", t.line, io.EOF
 		}
 
-		if err := t.scanner.Err(); err != nil {
-			return "", t.line, err
-		}
-
 		line = t.scanner.Text()
 		line = t.trimComment(line)
 		if line == "" {
@@ -171,38 +208,72 @@ func (t *tokenizer) nextLine() (string, int, error) {
 	return line, t.line, nil
 }
 
+// trimComment replaces the comments with spaces keeping them for the tokens, and trims the trailing spaces.
 func (t *tokenizer) trimComment(str string) string {
-
+	i := 0
 	if t.rangeComment {
-		pos := strings.Index(str, "*/")
-		if pos == -1 {
+		end := strings.Index(str, "*/")
+		if end == -1 {
+			t.comment.Text += "\n" + strings.TrimRightFunc(str, unicode.IsSpace)
 			return ""
 		}
-		str = str[pos+2:]
-		t.rangeComment = false
+		t.comment.Text += "\n" + str[:end+2]
+		t.closeComment()
+		str = blank(str, 0, end+2)
+		i = end + 2
 	}
 
-	pos := strings.Index(str, "//")
-	if pos != -1 {
-		str = str[:pos]
+	for i < len(str) {
+		switch {
+		case str[i] == '"': // an unclosed string is reported by tokenize
+			end := strings.IndexByte(str[i+1:], '"')
+			if end == -1 {
+				return strings.TrimRightFunc(str, unicode.IsSpace)
+			}
+			i += end + 2
+
+		case strings.HasPrefix(str[i:], "//"):
+			text := strings.TrimRightFunc(str[i:], unicode.IsSpace)
+			t.comments = append(t.comments, Comment{Text: text, Pos: Pos{File: t.file, Line: t.line, Col: i + 1}, EndLine: t.line})
+			str = str[:i]
+
+		case strings.HasPrefix(str[i:], "/*"):
+			t.rangeComment = true
+			t.comment = Comment{Pos: Pos{File: t.file, Line: t.line, Col: i + 1}}
+			end := strings.Index(str[i+2:], "*/")
+			if end == -1 {
+				t.comment.Text = strings.TrimRightFunc(str[i:], unicode.IsSpace)
+				str = str[:i]
+				break
+			}
+			end += i + 4
+			t.comment.Text = str[i:end]
+			t.closeComment()
+			str = blank(str, i, end)
+			i = end
+
+		default:
+			i++
+		}
 	}
+	return strings.TrimRightFunc(str, unicode.IsSpace)
+}
 
-	for {
-		pos1 := strings.Index(str, "/*")
-		if pos1 == -1 {
-			break
-		}
-		t.rangeComment = true
+func (t *tokenizer) closeComment() {
+	t.comment.EndLine = t.line
+	t.comments = append(t.comments, t.comment)
+	t.rangeComment = false
+}
 
-		pos2 := strings.Index(str, "*/")
-		if pos2 == -1 {
-			str = str[:pos1]
-			break
+// blank replaces the bytes of str[i:j] with spaces, keeping the tabs so that the columns do not move.
+func blank(str string, i, j int) string {
+	b := []byte(str)
+	for k := i; k < j; k++ {
+		if b[k] != '\t' {
+			b[k] = ' '
 		}
-		str = str[:pos1] + str[pos2+2:]
-		t.rangeComment = false
 	}
-	return strings.TrimSpace(str)
+	return string(b)
 }
 
 func (ts Tokens) ToNode() *Node {
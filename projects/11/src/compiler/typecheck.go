@@ -0,0 +1,237 @@
+package compiler
+
+// TypeCheckLevel tells how the type errors are reported by Compile.
+type TypeCheckLevel string
+
+const (
+	TypeCheckOff   TypeCheckLevel = "off"
+	TypeCheckWarn  TypeCheckLevel = "warn"
+	TypeCheckError TypeCheckLevel = "error"
+)
+
+const (
+	typeUnknown Type = ""
+	typeNull    Type = "null"
+	typeArray   Type = "Array"
+	typeString  Type = "String"
+)
+
+// TypeCheck reports the type mismatches in let statements, arguments and return values, indexing
+// of variables which are not Array, and return statements without a value in non-void subroutines.
+// Jack is loosely typed, so int and char are compatible, and so are int and Array. The types of
+// array elements and of the calls to the classes out of prog are unknown, and match any type.
+// When prog is nil, the calls are checked with cls and the OS.
+func TypeCheck(cls *Class, prog *Program) ErrorList {
+	if prog == nil {
+		prog = NewProgram([]*Class{cls})
+	}
+	c := typeChecker{class: cls, prog: prog, classVars: map[string]Type{}}
+	for _, dec := range cls.ClassVarDecs {
+		for _, name := range dec.VarNames {
+			c.classVars[name] = dec.VarType
+		}
+	}
+	for i := range cls.SubRoutineDecs {
+		c.checkSubroutine(&cls.SubRoutineDecs[i])
+	}
+	return c.errs
+}
+
+type typeChecker struct {
+	class     *Class
+	prog      *Program
+	classVars map[string]Type
+
+	current *SubroutineDec
+	vars    map[string]Type
+	errs    ErrorList
+}
+
+func (c *typeChecker) checkSubroutine(dec *SubroutineDec) {
+	c.current = dec
+	c.vars = map[string]Type{}
+	for _, param := range dec.ParameterList.Paramters {
+		c.vars[param.VarName] = param.VarType
+	}
+	for _, v := range dec.SubroutineBody.VarDecs {
+		for _, name := range v.VarNames {
+			c.vars[name] = v.VarType
+		}
+	}
+	c.checkStatements(&dec.SubroutineBody.Statements)
+}
+
+func (c *typeChecker) checkStatements(s *Statements) {
+	for _, st := range s.Statements {
+		switch st.Type {
+		case StatementTypeLet:
+			c.checkLetStatement(st.LetStatement)
+		case StatementTypeIf:
+			c.typeOf(&st.IfStatement.Condition)
+			c.checkStatements(&st.IfStatement.IfStatements)
+			c.checkStatements(&st.IfStatement.ElseStatements)
+		case StatementTypeWhile:
+			c.typeOf(&st.WhileStatement.Condition)
+			c.checkStatements(&st.WhileStatement.Statements)
+		case StatementTypeDo:
+			c.callType(&st.DoStatement.SubroutineCall)
+		case StatementTypeReturn:
+			c.checkReturnStatement(st.ReturnStatement)
+		}
+	}
+}
+
+func (c *typeChecker) checkLetStatement(s *LetStatement) {
+	value := c.typeOf(&s.VarValue)
+	if s.Index != nil {
+		c.checkIndex(s.VarName, s.VarPos, s.Index)
+		return
+	}
+	if ty := c.variable(s.VarName); !assignable(ty, value) {
+		c.errorf(s.VarValue.Term.Pos, "cannot assign %s to '%s' of type %s", value, s.VarName, ty)
+	}
+}
+
+func (c *typeChecker) checkReturnStatement(s *ReturnStatement) {
+	ret, name := c.current.RetType, c.current.SubroutineName
+	if s.Expression == nil {
+		if ret != TypeVoid {
+			c.errorf(s.Pos, "missing return value in subroutine '%s' returning %s", name, ret)
+		}
+		return
+	}
+
+	value := c.typeOf(s.Expression)
+	switch {
+	case ret == TypeVoid:
+		c.errorf(s.Expression.Term.Pos, "void subroutine '%s' returns a value", name)
+	case !assignable(ret, value):
+		c.errorf(s.Expression.Term.Pos, "cannot return %s from subroutine '%s' returning %s", value, name, ret)
+	}
+}
+
+// checkIndex reports the indexing of a variable which is not an Array, or by a non-int index.
+func (c *typeChecker) checkIndex(name string, pos Pos, index *Expression) {
+	if ty := c.variable(name); ty != typeUnknown && ty != typeArray {
+		c.errorf(pos, "'%s' of type %s is indexed, but is not an Array", name, ty)
+	}
+	if ty := c.typeOf(index); !assignable(TypeInt, ty) {
+		c.errorf(index.Term.Pos, "array index must be int, but got %s", ty)
+	}
+}
+
+func (c *typeChecker) typeOf(exp *Expression) Type {
+	ty := c.termType(&exp.Term)
+	for i := range exp.Tail {
+		right := c.termType(&exp.Tail[i].Term)
+		switch exp.Tail[i].Op {
+		case "<", ">", "=":
+			ty = TypeBoolean
+		case "&", "|":
+			// bitwise operators on ints, and logical operators on booleans
+			switch {
+			case ty == typeUnknown || right == typeUnknown:
+				ty = typeUnknown
+			case ty != TypeBoolean || right != TypeBoolean:
+				ty = TypeInt
+			}
+		default:
+			ty = TypeInt
+		}
+	}
+	return ty
+}
+
+func (c *typeChecker) termType(t *Term) Type {
+	switch t.Type {
+	case TermTypeIntegerConst:
+		return TypeInt
+	case TermTypeStringConst:
+		return typeString
+	case TermTypeKeywordConst:
+		switch *t.KeywordConstant {
+		case "true", "false":
+			return TypeBoolean
+		case "null":
+			return typeNull
+		case "this":
+			return Type(c.class.ClassName)
+		}
+	case TermTypeVarName:
+		return c.variable(*t.VarName)
+	case TermTypeVarNameIndex:
+		c.checkIndex(*t.VarName, t.Pos, t.Index)
+		return typeUnknown
+	case TermTypeSubroutineCall:
+		return c.callType(t.SubroutineCall)
+	case TermTypeExpression:
+		return c.typeOf(t.Expression)
+	case TermTypeUnaryOp:
+		ty := c.termType(t.UnaryOpTerm)
+		if *t.UnaryOp == "~" && (ty == TypeBoolean || ty == typeUnknown) {
+			return ty
+		}
+		return TypeInt
+	}
+	return typeUnknown
+}
+
+// callType checks the arguments of a call, and returns the type of its value.
+func (c *typeChecker) callType(call *SubroutineCall) Type {
+	args := make([]Type, len(call.ExpressionList.Expressions))
+	for i := range call.ExpressionList.Expressions {
+		args[i] = c.typeOf(&call.ExpressionList.Expressions[i])
+	}
+
+	class := c.class.ClassName
+	if call.Receiver != nil {
+		class = *call.Receiver
+		if ty := c.variable(class); ty != typeUnknown {
+			class = string(ty)
+		}
+	}
+	sig := c.prog.Subroutine(class, call.SubroutineName)
+	if sig == nil {
+		return typeUnknown
+	}
+
+	for i, param := range sig.Params {
+		if i < len(args) && !assignable(param, args[i]) {
+			c.errorf(call.ExpressionList.Expressions[i].Term.Pos, "argument %d of '%s.%s' must be %s, but got %s",
+				i+1, sig.Class, sig.Name, param, args[i])
+		}
+	}
+	return sig.RetType
+}
+
+func (c *typeChecker) variable(name string) Type {
+	if ty, ok := c.vars[name]; ok {
+		return ty
+	}
+	return c.classVars[name]
+}
+
+// assignable tells whether a value of type from can be stored in a variable of type to.
+func assignable(to, from Type) bool {
+	if to == typeUnknown || from == typeUnknown || to == from {
+		return true
+	}
+	switch to {
+	case TypeInt, TypeChar:
+		return from == TypeInt || from == TypeChar || from == typeArray || from == typeNull
+	case TypeBoolean:
+		return false
+	case typeArray:
+		return from == TypeInt || from == typeNull || !isPrimitive(from)
+	default:
+		return from == typeNull || from == typeArray
+	}
+}
+
+func isPrimitive(ty Type) bool {
+	return ty == TypeInt || ty == TypeChar || ty == TypeBoolean
+}
+
+func (c *typeChecker) errorf(pos Pos, format string, a ...interface{}) {
+	c.errs = append(c.errs, errorf(pos, format, a...))
+}
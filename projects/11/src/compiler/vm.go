@@ -35,6 +35,11 @@ const (
 type JackVM struct {
 	w   io.Writer
 	err error
+
+	// line is the number of the written lines, and sourceMap maps them to the positions set by SetPos.
+	line      int
+	pos       Pos
+	sourceMap VMSourceMap
 }
 
 func NewJackVM(w io.Writer) *JackVM {
@@ -45,6 +50,19 @@ func (vm *JackVM) Err() error {
 	return vm.err
 }
 
+// SetPos sets the position of the Jack code which the following commands are compiled from, and
+// returns the previous one.
+func (vm *JackVM) SetPos(pos Pos) Pos {
+	prev := vm.pos
+	vm.pos = pos
+	return prev
+}
+
+// SourceMap returns the map from the lines of the written commands to the positions of the Jack code.
+func (vm *JackVM) SourceMap() VMSourceMap {
+	return vm.sourceMap
+}
+
 func (vm *JackVM) WritePush(seg VMSeg, idx int64) {
 	vm.write(vm.w, "push %s %d\n", seg, idx)
 }
@@ -85,5 +103,9 @@ func (vm *JackVM) write(w io.Writer, format string, a ...interface{}) {
 	if vm.err != nil {
 		return
 	}
+	vm.line++
+	if n := len(vm.sourceMap); vm.pos.Line > 0 && (n == 0 || vm.sourceMap[n-1].Pos != vm.pos) {
+		vm.sourceMap = append(vm.sourceMap, VMSourceMapEntry{Line: vm.line, Pos: vm.pos})
+	}
 	_, vm.err = fmt.Fprintf(w, format, a...)
 }
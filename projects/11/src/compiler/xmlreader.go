@@ -0,0 +1,542 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReadTokensXML reads the tokens from the XML of the course (*T.xml), which MarshalXML writes for
+// Tokens. The positions of the tokens are the ones of their elements in the XML of path.
+func ReadTokensXML(path string, r io.Reader) (Tokens, error) {
+	root, err := readXMLElements(path, r)
+	if err != nil {
+		return nil, err
+	}
+	if root.name != "tokens" {
+		return nil, errorf(root.pos, "expected <tokens> but found <%s>", root.name)
+	}
+	c := xmlCursor{parent: root}
+	var tokens Tokens
+	for c.peek() != nil {
+		token := c.terminal("token")
+		if c.err != nil {
+			return nil, c.err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, nil
+}
+
+// ReadClassXML reads the class from the XML of the course (*.xml), which MarshalXML writes for Class.
+// The class is built from the structure of the XML, and not by analyzing its terminals again, so a
+// tree written by another analyzer can be compared with the one of Analyze. The positions in the
+// class are the ones of the elements in the XML of path.
+func ReadClassXML(path string, r io.Reader) (*Class, error) {
+	root, err := readXMLElements(path, r)
+	if err != nil {
+		return nil, err
+	}
+	if root.name != "class" {
+		return nil, errorf(root.pos, "expected <class> but found <%s>", root.name)
+	}
+
+	c := &xmlCursor{parent: root}
+	cls := &Class{Node: root.node()}
+	c.terminal(TokenTypeKeyword, "class")
+	if name := c.terminal(TokenTypeIdentifier); name != nil {
+		cls.ClassName, cls.Pos = name.Value, name.Pos
+	}
+	c.terminal(TokenTypeSymbol, "{")
+	for c.is("classVarDec") {
+		cls.ClassVarDecs = append(cls.ClassVarDecs, readClassVarDec(c, c.element("classVarDec")))
+	}
+	for c.is("subroutineDec") {
+		cls.SubRoutineDecs = append(cls.SubRoutineDecs, readSubroutineDec(c, c.element("subroutineDec")))
+	}
+	c.terminal(TokenTypeSymbol, "}")
+	c.end()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return cls, nil
+}
+
+// xmlElement is an element of the XML. The value is set for a terminal, which has no children.
+type xmlElement struct {
+	name     string
+	value    string
+	terminal bool
+	pos      Pos
+	children []*xmlElement
+}
+
+func (e *xmlElement) node() Node {
+	node := Node{Name: e.name, Value: e.value}
+	if !e.terminal {
+		node.Children = []Node{}
+	}
+	for _, c := range e.children {
+		node.Children = append(node.Children, c.node())
+	}
+	return node
+}
+
+var terminalNames = []string{
+	string(TokenTypeKeyword),
+	string(TokenTypeSymbol),
+	string(TokenTypeIntegerConst),
+	string(TokenTypeStringConst),
+	string(TokenTypeIdentifier),
+}
+
+func readXMLElements(path string, r io.Reader) (*xmlElement, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lineStarts := []int{0}
+	for i, b := range src {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	position := func(offset int64) Pos {
+		line := sort.Search(len(lineStarts), func(i int) bool { return int64(lineStarts[i]) > offset })
+		if line == 0 {
+			return Pos{File: path, Line: 1, Col: 1}
+		}
+		return Pos{File: path, Line: line, Col: int(offset) - lineStarts[line-1] + 1}
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(src))
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			msg := err.Error()
+			if e, ok := err.(*xml.SyntaxError); ok {
+				msg = e.Msg
+			}
+			return nil, errorf(position(d.InputOffset()), "invalid XML: %s", msg)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			e := &xmlElement{name: t.Name.Local, pos: position(offset), terminal: stringInclude(terminalNames, t.Name.Local)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				if parent.terminal {
+					return nil, errorf(e.pos, "unexpected <%s> in <%s>", e.name, parent.name)
+				}
+				parent.children = append(parent.children, e)
+			} else if root == nil {
+				root = e
+			} else {
+				return nil, errorf(e.pos, "unexpected <%s> after </%s>", e.name, root.name)
+			}
+			stack = append(stack, e)
+
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			if e.terminal {
+				// MarshalXML puts a space around the value.
+				e.value = strings.TrimPrefix(strings.TrimSuffix(e.value, " "), " ")
+			}
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			if len(stack) > 0 && stack[len(stack)-1].terminal {
+				stack[len(stack)-1].value += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errorf(position(0), "no XML element")
+	}
+	return root, nil
+}
+
+// xmlCursor reads the children of an element in order. The first error is kept in err, and the
+// reads after it return nil.
+type xmlCursor struct {
+	parent *xmlElement
+	next   int
+	err    *Error
+}
+
+func (c *xmlCursor) peek() *xmlElement {
+	if c.err != nil || c.next >= len(c.parent.children) {
+		return nil
+	}
+	return c.parent.children[c.next]
+}
+
+// is reports whether the next child is named one of names.
+func (c *xmlCursor) is(names ...string) bool {
+	e := c.peek()
+	return e != nil && stringInclude(names, e.name)
+}
+
+// isSymbol reports whether the next child is the symbol value.
+func (c *xmlCursor) isSymbol(value string) bool {
+	e := c.peek()
+	return e != nil && e.name == string(TokenTypeSymbol) && e.value == value
+}
+
+func (c *xmlCursor) fail(expected string) {
+	if c.err != nil {
+		return
+	}
+	if e := c.peek(); e != nil {
+		found := "<" + e.name + ">"
+		if e.terminal {
+			found += " '" + e.value + "'"
+		}
+		c.err = errorf(e.pos, "expected %s but found %s", expected, found)
+		return
+	}
+	c.err = errorf(c.parent.pos, "expected %s at the end of <%s>", expected, c.parent.name)
+}
+
+// element returns the next child, which must be the element name.
+func (c *xmlCursor) element(name string) *xmlCursor {
+	e := c.peek()
+	if e == nil || e.name != name || e.terminal {
+		c.fail("<" + name + ">")
+		return &xmlCursor{parent: &xmlElement{name: name}, err: c.err}
+	}
+	c.next++
+	return &xmlCursor{parent: e}
+}
+
+// terminal returns the token of the next child, which must be of ty and one of values if they are
+// given. ty "token" accepts any type of terminal.
+func (c *xmlCursor) terminal(ty TokenType, values ...string) *Token {
+	e := c.peek()
+	if e == nil || !e.terminal || ty != "token" && e.name != string(ty) || len(values) > 0 && !stringInclude(values, e.value) {
+		expected := "<" + string(ty) + ">"
+		if len(values) > 0 {
+			expected += " '" + strings.Join(values, "' or '") + "'"
+		}
+		c.fail(expected)
+		return nil
+	}
+	c.next++
+	return &Token{Type: TokenType(e.name), Value: e.value, Pos: e.pos}
+}
+
+// end checks that there are no more children.
+func (c *xmlCursor) end() {
+	if c.peek() != nil {
+		c.fail("</" + c.parent.name + ">")
+	}
+}
+
+// done ends c, and passes its error to the parent cursor.
+func (c *xmlCursor) done(parent *xmlCursor) {
+	c.end()
+	if parent.err == nil {
+		parent.err = c.err
+	}
+}
+
+func (c *xmlCursor) value(t *Token) string {
+	if t == nil {
+		return ""
+	}
+	return t.Value
+}
+
+func (c *xmlCursor) pos(t *Token) Pos {
+	if t == nil {
+		return Pos{}
+	}
+	return t.Pos
+}
+
+func readClassVarDec(parent, c *xmlCursor) ClassVarDec {
+	dec := ClassVarDec{Node: c.parent.node()}
+	kind := c.terminal(TokenTypeKeyword, "static", "field")
+	dec.ClassVarDecType, dec.Pos = ClassVarDecType(c.value(kind)), c.pos(kind)
+	dec.VarType = readType(c)
+	dec.VarNames, dec.NamePos = readNames(c)
+	c.terminal(TokenTypeSymbol, ";")
+	c.done(parent)
+	return dec
+}
+
+func readType(c *xmlCursor) Type {
+	if c.is(string(TokenTypeKeyword)) {
+		return Type(c.value(c.terminal(TokenTypeKeyword, "int", "char", "boolean", "void")))
+	}
+	return Type(c.value(c.terminal(TokenTypeIdentifier)))
+}
+
+// readNames reads the names separated by ','.
+func readNames(c *xmlCursor) ([]string, []Pos) {
+	var names []string
+	var pos []Pos
+	for {
+		name := c.terminal(TokenTypeIdentifier)
+		names, pos = append(names, c.value(name)), append(pos, c.pos(name))
+		if !c.isSymbol(",") {
+			return names, pos
+		}
+		c.terminal(TokenTypeSymbol, ",")
+	}
+}
+
+func readSubroutineDec(parent, c *xmlCursor) SubroutineDec {
+	dec := SubroutineDec{Node: c.parent.node()}
+	dec.SubRoutineType = SubRoutineType(c.value(c.terminal(TokenTypeKeyword, "constructor", "function", "method")))
+	dec.RetType = readType(c)
+	name := c.terminal(TokenTypeIdentifier)
+	dec.SubroutineName, dec.Pos = c.value(name), c.pos(name)
+	c.terminal(TokenTypeSymbol, "(")
+
+	params := c.element("parameterList")
+	dec.ParameterList.Node = params.parent.node()
+	for params.peek() != nil {
+		if len(dec.ParameterList.Paramters) > 0 {
+			params.terminal(TokenTypeSymbol, ",")
+		}
+		param := Parameter{VarType: readType(params)}
+		name := params.terminal(TokenTypeIdentifier)
+		param.VarName, param.Pos = params.value(name), params.pos(name)
+		dec.ParameterList.Paramters = append(dec.ParameterList.Paramters, param)
+	}
+	params.done(c)
+	c.terminal(TokenTypeSymbol, ")")
+
+	body := c.element("subroutineBody")
+	dec.SubroutineBody.Node = body.parent.node()
+	body.terminal(TokenTypeSymbol, "{")
+	for body.is("varDec") {
+		dec.SubroutineBody.VarDecs = append(dec.SubroutineBody.VarDecs, readVarDec(body, body.element("varDec")))
+	}
+	dec.SubroutineBody.Statements = readStatements(body, body.element("statements"))
+	body.terminal(TokenTypeSymbol, "}")
+	body.done(c)
+	c.done(parent)
+	return dec
+}
+
+func readVarDec(parent, c *xmlCursor) VarDec {
+	dec := VarDec{Node: c.parent.node()}
+	dec.Pos = c.pos(c.terminal(TokenTypeKeyword, "var"))
+	dec.VarType = readType(c)
+	dec.VarNames, dec.NamePos = readNames(c)
+	c.terminal(TokenTypeSymbol, ";")
+	c.done(parent)
+	return dec
+}
+
+func readStatements(parent, c *xmlCursor) Statements {
+	statements := Statements{Node: c.parent.node()}
+	for c.peek() != nil {
+		var st Statement
+		switch {
+		case c.is("letStatement"):
+			st = Statement{Type: StatementTypeLet, LetStatement: readLetStatement(c, c.element("letStatement"))}
+		case c.is("ifStatement"):
+			st = Statement{Type: StatementTypeIf, IfStatement: readIfStatement(c, c.element("ifStatement"))}
+		case c.is("whileStatement"):
+			st = Statement{Type: StatementTypeWhile, WhileStatement: readWhileStatement(c, c.element("whileStatement"))}
+		case c.is("doStatement"):
+			st = Statement{Type: StatementTypeDo, DoStatement: readDoStatement(c, c.element("doStatement"))}
+		case c.is("returnStatement"):
+			st = Statement{Type: StatementTypeReturn, ReturnStatement: readReturnStatement(c, c.element("returnStatement"))}
+		default:
+			c.fail("statement")
+		}
+		if c.err != nil {
+			break
+		}
+		statements.Statements = append(statements.Statements, st)
+	}
+	c.done(parent)
+	return statements
+}
+
+func readLetStatement(parent, c *xmlCursor) *LetStatement {
+	st := &LetStatement{Node: c.parent.node()}
+	st.Pos = c.pos(c.terminal(TokenTypeKeyword, "let"))
+	name := c.terminal(TokenTypeIdentifier)
+	st.VarName, st.VarPos = c.value(name), c.pos(name)
+	if c.isSymbol("[") {
+		c.terminal(TokenTypeSymbol, "[")
+		st.Index = readExpression(c, c.element("expression"))
+		c.terminal(TokenTypeSymbol, "]")
+	}
+	c.terminal(TokenTypeSymbol, "=")
+	st.VarValue = *readExpression(c, c.element("expression"))
+	c.terminal(TokenTypeSymbol, ";")
+	c.done(parent)
+	return st
+}
+
+func readIfStatement(parent, c *xmlCursor) *IfStatement {
+	st := &IfStatement{Node: c.parent.node()}
+	st.Pos = c.pos(c.terminal(TokenTypeKeyword, "if"))
+	c.terminal(TokenTypeSymbol, "(")
+	st.Condition = *readExpression(c, c.element("expression"))
+	c.terminal(TokenTypeSymbol, ")")
+	c.terminal(TokenTypeSymbol, "{")
+	st.IfStatements = readStatements(c, c.element("statements"))
+	c.terminal(TokenTypeSymbol, "}")
+	if c.is(string(TokenTypeKeyword)) {
+		c.terminal(TokenTypeKeyword, "else")
+		c.terminal(TokenTypeSymbol, "{")
+		st.ElseStatements = readStatements(c, c.element("statements"))
+		c.terminal(TokenTypeSymbol, "}")
+	}
+	c.done(parent)
+	return st
+}
+
+func readWhileStatement(parent, c *xmlCursor) *WhileStatement {
+	st := &WhileStatement{Node: c.parent.node()}
+	st.Pos = c.pos(c.terminal(TokenTypeKeyword, "while"))
+	c.terminal(TokenTypeSymbol, "(")
+	st.Condition = *readExpression(c, c.element("expression"))
+	c.terminal(TokenTypeSymbol, ")")
+	c.terminal(TokenTypeSymbol, "{")
+	st.Statements = readStatements(c, c.element("statements"))
+	c.terminal(TokenTypeSymbol, "}")
+	c.done(parent)
+	return st
+}
+
+func readDoStatement(parent, c *xmlCursor) *DoStatement {
+	st := &DoStatement{Node: c.parent.node()}
+	st.Pos = c.pos(c.terminal(TokenTypeKeyword, "do"))
+	st.SubroutineCall = *readSubroutineCall(c)
+	c.terminal(TokenTypeSymbol, ";")
+	c.done(parent)
+	return st
+}
+
+func readReturnStatement(parent, c *xmlCursor) *ReturnStatement {
+	st := &ReturnStatement{Node: c.parent.node()}
+	st.Pos = c.pos(c.terminal(TokenTypeKeyword, "return"))
+	if c.is("expression") {
+		st.Expression = readExpression(c, c.element("expression"))
+	}
+	c.terminal(TokenTypeSymbol, ";")
+	c.done(parent)
+	return st
+}
+
+func readExpression(parent, c *xmlCursor) *Expression {
+	exp := &Expression{Node: c.parent.node()}
+	exp.Term = *readTerm(c, c.element("term"))
+	for c.peek() != nil && c.err == nil {
+		op := c.terminal(TokenTypeSymbol, "+", "-", "*", "/", "&", "|", "<", ">", "=")
+		tail := ExpressionTail{Op: Op(c.value(op))}
+		tail.Term = *readTerm(c, c.element("term"))
+		exp.Tail = append(exp.Tail, tail)
+	}
+	c.done(parent)
+	return exp
+}
+
+func readTerm(parent, c *xmlCursor) *Term {
+	t := &Term{Node: c.parent.node()}
+	if e := c.peek(); e != nil {
+		t.Pos = e.pos
+	}
+
+	switch {
+	case c.is(string(TokenTypeIntegerConst)):
+		token := c.terminal(TokenTypeIntegerConst)
+		i, err := strconv.ParseInt(token.Value, 10, 64)
+		if (err != nil || i > 32767) && c.err == nil {
+			c.err = errorf(token.Pos, "integer constant %s is out of range 0..32767", token.Value)
+		}
+		t.Type, t.IntegerConst = TermTypeIntegerConst, &i
+
+	case c.is(string(TokenTypeStringConst)):
+		token := c.terminal(TokenTypeStringConst)
+		t.Type, t.StringConst = TermTypeStringConst, &token.Value
+
+	case c.is(string(TokenTypeKeyword)):
+		token := c.terminal(TokenTypeKeyword, "true", "false", "null", "this")
+		value := c.value(token)
+		t.Type, t.KeywordConstant = TermTypeKeywordConst, &value
+
+	case c.is(string(TokenTypeIdentifier)):
+		// the kind of the term is known from the symbol after the identifier.
+		if next := c.next + 1; next < len(c.parent.children) {
+			if e := c.parent.children[next]; e.name == string(TokenTypeSymbol) && (e.value == "(" || e.value == ".") {
+				t.Type, t.SubroutineCall = TermTypeSubroutineCall, readSubroutineCall(c)
+				break
+			}
+		}
+		name := c.value(c.terminal(TokenTypeIdentifier))
+		t.Type, t.VarName = TermTypeVarName, &name
+		if c.isSymbol("[") {
+			c.terminal(TokenTypeSymbol, "[")
+			t.Type, t.Index = TermTypeVarNameIndex, readExpression(c, c.element("expression"))
+			c.terminal(TokenTypeSymbol, "]")
+		}
+
+	case c.isSymbol("("):
+		c.terminal(TokenTypeSymbol, "(")
+		t.Type, t.Expression = TermTypeExpression, readExpression(c, c.element("expression"))
+		c.terminal(TokenTypeSymbol, ")")
+
+	default:
+		token := c.terminal(TokenTypeSymbol, "-", "~")
+		if token == nil {
+			// stop here, or the term of the failed cursor is read again forever
+			break
+		}
+		op := UnaryOp(token.Value)
+		t.Type, t.UnaryOp, t.UnaryOpTerm = TermTypeUnaryOp, &op, readTerm(c, c.element("term"))
+	}
+	c.done(parent)
+	return t
+}
+
+// readSubroutineCall reads the call, whose elements are in the parent of c without its own layer.
+func readSubroutineCall(c *xmlCursor) *SubroutineCall {
+	start := c.next
+	call := &SubroutineCall{}
+	name := c.terminal(TokenTypeIdentifier)
+	call.SubroutineName, call.Pos = c.value(name), c.pos(name)
+	if c.isSymbol(".") {
+		c.terminal(TokenTypeSymbol, ".")
+		receiver := call.SubroutineName
+		call.Receiver = &receiver
+		call.SubroutineName = c.value(c.terminal(TokenTypeIdentifier))
+	}
+	c.terminal(TokenTypeSymbol, "(")
+
+	list := c.element("expressionList")
+	call.ExpressionList.Node = list.parent.node()
+	for list.peek() != nil && list.err == nil {
+		if len(call.ExpressionList.Expressions) > 0 {
+			list.terminal(TokenTypeSymbol, ",")
+		}
+		call.ExpressionList.Expressions = append(call.ExpressionList.Expressions, *readExpression(list, list.element("expression")))
+	}
+	list.done(c)
+	c.terminal(TokenTypeSymbol, ")")
+
+	call.Node = Node{SkipLayer: true}
+	if c.err == nil {
+		for _, e := range c.parent.children[start:c.next] {
+			call.Node.Children = append(call.Node.Children, e.node())
+		}
+	}
+	return call
+}
@@ -0,0 +1,182 @@
+package lsp
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/nfukaaswa/nand2tetris/11/src/compiler"
+)
+
+// document is a .jack file opened by the client, or read from the disk for the other classes.
+// When the text does not tokenize, the last tokens and class are kept for the navigation.
+type document struct {
+	uri    string
+	path   string
+	lines  []string
+	tokens compiler.Tokens
+	cls    *compiler.Class
+	errs   compiler.ErrorList
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, path: uriToPath(uri)}
+	d.update(text)
+	return d
+}
+
+func (d *document) update(text string) {
+	d.lines = strings.Split(text, "\n")
+	d.errs = nil
+
+	tokens, err := compiler.Tokenize(d.path, strings.NewReader(text))
+	if err != nil {
+		d.errs = errorList(err, d.path)
+		return
+	}
+	d.tokens = tokens
+
+	cls, err := compiler.Analyze(tokens)
+	if err != nil {
+		d.errs = errorList(err, d.path)
+	}
+	if cls != nil {
+		d.cls = cls
+	}
+}
+
+func errorList(err error, path string) compiler.ErrorList {
+	switch e := err.(type) {
+	case compiler.ErrorList:
+		return e
+	case *compiler.Error:
+		return compiler.ErrorList{e}
+	default:
+		return compiler.ErrorList{{Pos: compiler.Pos{File: path, Line: 1, Col: 1}, Msg: err.Error()}}
+	}
+}
+
+// position converts pos to the position of LSP, whose character counts UTF-16 code units.
+func (d *document) position(pos compiler.Pos) Position {
+	line := pos.Line - 1
+	if line < 0 || line >= len(d.lines) {
+		return Position{Line: line, Character: pos.Col - 1}
+	}
+	text := d.lines[line]
+	col := pos.Col - 1
+	if col > len(text) {
+		col = len(text)
+	}
+	return Position{Line: line, Character: len(utf16.Encode([]rune(text[:col])))}
+}
+
+// pos converts the position of LSP to pos.
+func (d *document) pos(p Position) compiler.Pos {
+	pos := compiler.Pos{File: d.path, Line: p.Line + 1, Col: p.Character + 1}
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return pos
+	}
+	text := d.lines[p.Line]
+	units := 0
+	for i, r := range text {
+		if units >= p.Character {
+			pos.Col = i + 1
+			return pos
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	pos.Col = len(text) + 1
+	return pos
+}
+
+// span returns the range of the word at pos, or of the character when it is not in a word.
+func (d *document) span(pos compiler.Pos) Range {
+	end := pos
+	if line := pos.Line - 1; line >= 0 && line < len(d.lines) {
+		text := d.lines[line]
+		i := pos.Col - 1
+		for i < len(text) && isIdentByte(text[i]) {
+			i++
+		}
+		if i == pos.Col-1 && i < len(text) {
+			_, n := utf8.DecodeRuneInString(text[i:])
+			i += n
+		}
+		end.Col = i + 1
+	}
+	return Range{Start: d.position(pos), End: d.position(end)}
+}
+
+// tokenAt returns the index of the token at pos, or -1.
+func (d *document) tokenAt(pos compiler.Pos) int {
+	for i, t := range d.tokens {
+		n := len(t.Value)
+		if t.Type == compiler.TokenTypeStringConst {
+			n += 2
+		}
+		if t.Line == pos.Line && t.Col <= pos.Col && pos.Col < t.Col+n {
+			return i
+		}
+	}
+	return -1
+}
+
+// subroutineAt returns the subroutine declared last before pos.
+func (d *document) subroutineAt(pos compiler.Pos) *compiler.SubroutineDec {
+	if d.cls == nil {
+		return nil
+	}
+	var dec *compiler.SubroutineDec
+	for i := range d.cls.SubRoutineDecs {
+		p := d.cls.SubRoutineDecs[i].Pos
+		if p.Line < pos.Line || p.Line == pos.Line && p.Col <= pos.Col {
+			dec = &d.cls.SubRoutineDecs[i]
+		}
+	}
+	return dec
+}
+
+// symbols returns the symbol table of the variables visible at pos.
+func (d *document) symbols(pos compiler.Pos) compiler.SymbolTable {
+	t := compiler.NewSymbolTable()
+	if d.cls == nil {
+		return t
+	}
+	for _, dec := range d.cls.ClassVarDecs {
+		for i, name := range dec.VarNames {
+			t.Define(name, compiler.SymKind(dec.ClassVarDecType), string(dec.VarType), int64(i), dec.NamePos[i])
+		}
+	}
+
+	dec := d.subroutineAt(pos)
+	if dec == nil {
+		return t
+	}
+	t.Subroutine()
+	for i, param := range dec.ParameterList.Paramters {
+		t.Define(param.VarName, compiler.SymKindArg, string(param.VarType), int64(i), param.Pos)
+	}
+	for _, v := range dec.SubroutineBody.VarDecs {
+		for i, name := range v.VarNames {
+			t.Define(name, compiler.SymKindVar, string(v.VarType), int64(i), v.NamePos[i])
+		}
+	}
+	return t
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return u.Path
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
@@ -0,0 +1,590 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nfukaaswa/nand2tetris/11/src/compiler"
+)
+
+// Server is a language server of Jack, which talks JSON-RPC over in and out. The classes in the
+// directory of an open document are indexed together with it, for checking and resolving the
+// calls across the classes.
+type Server struct {
+	in       *textproto.Reader
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+
+	// disk holds the .jack files parsed from the disk by the directory, until a file in the
+	// directory is saved or changed. The changes are notified by the client when it can watch
+	// the files, which the server registers after initialized.
+	disk       map[string][]*document
+	watchFiles bool
+	nextID     int
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   textproto.NewReader(bufio.NewReader(in)),
+		out:  out,
+		docs: map[string]*document{},
+		disk: map[string][]*document{},
+	}
+}
+
+// Serve handles the messages until the exit notification or the end of the input.
+func (s *Server) Serve() error {
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		// the responses to the requests of the server need no handling
+		if msg.Method == "" {
+			continue
+		}
+
+		result, rerr := s.handle(&msg)
+		if msg.ID == nil {
+			continue
+		}
+		if err := s.reply(msg.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+// read reads the content of a message, which follows the Content-Length header.
+func (s *Server) read() ([]byte, error) {
+	header, err := s.in.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("invalid header: %v", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in.R, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (s *Server) write(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) error {
+	if rerr != nil {
+		return s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: *rerr})
+	}
+	return s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) handle(msg *message) (interface{}, *responseError) {
+	if s.shutdown && msg.ID != nil {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shut down"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		var params initializeParams
+		if len(msg.Params) > 0 {
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				return nil, invalidParams(err)
+			}
+		}
+		s.watchFiles = params.Capabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:       textDocumentSyncOptions{OpenClose: true, Change: textDocumentSyncFull, Save: &saveOptions{}},
+				DefinitionProvider:     true,
+				HoverProvider:          true,
+				CompletionProvider:     completionOptions{TriggerCharacters: []string{"."}},
+				DocumentSymbolProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "jack-lsp"},
+		}, nil
+
+	case "initialized":
+		if !s.watchFiles {
+			return nil, nil
+		}
+		s.nextID++
+		if err := s.write(request{JSONRPC: "2.0", ID: s.nextID, Method: "client/registerCapability", Params: registrationParams{
+			Registrations: []registration{{
+				ID:              "watch-jack-files",
+				Method:          "workspace/didChangeWatchedFiles",
+				RegisterOptions: didChangeWatchedFilesRegistrationOptions{Watchers: []fileSystemWatcher{{GlobPattern: "**/*.jack"}}},
+			}},
+		}}); err != nil {
+			return nil, &responseError{Message: err.Error()}
+		}
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.docs[params.TextDocument.URI] = newDocument(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, s.publishDiagnostics()
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		d, ok := s.docs[params.TextDocument.URI]
+		if !ok || len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		d.update(params.ContentChanges[len(params.ContentChanges)-1].Text)
+		return nil, s.publishDiagnostics()
+
+	case "textDocument/didSave":
+		var params didSaveParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.invalidate(uriToPath(params.TextDocument.URI))
+		return nil, nil
+
+	case "workspace/didChangeWatchedFiles":
+		var params didChangeWatchedFilesParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		for _, change := range params.Changes {
+			s.invalidate(uriToPath(change.URI))
+		}
+		return nil, s.publishDiagnostics()
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		if err := s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		}); err != nil {
+			return nil, &responseError{Message: err.Error()}
+		}
+		return nil, s.publishDiagnostics()
+
+	case "textDocument/definition":
+		d, pos, rerr := s.positionParams(msg.Params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return s.definition(d, pos), nil
+
+	case "textDocument/hover":
+		d, pos, rerr := s.positionParams(msg.Params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return s.hover(d, pos), nil
+
+	case "textDocument/completion":
+		d, pos, rerr := s.positionParams(msg.Params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return s.completion(d, pos), nil
+
+	case "textDocument/documentSymbol":
+		var params documentSymbolParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		d, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, &responseError{Code: codeInvalidParams, Message: "document is not open: " + params.TextDocument.URI}
+		}
+		return documentSymbols(d), nil
+
+	default:
+		return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+func (s *Server) positionParams(raw json.RawMessage) (*document, compiler.Pos, *responseError) {
+	var params textDocumentPositionParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, compiler.Pos{}, invalidParams(err)
+	}
+	d, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, compiler.Pos{}, &responseError{Code: codeInvalidParams, Message: "document is not open: " + params.TextDocument.URI}
+	}
+	return d, d.pos(params.Position), nil
+}
+
+// publishDiagnostics publishes the diagnostics of all the open documents, since a change of
+// a class can break the calls in the others.
+func (s *Server) publishDiagnostics() *responseError {
+	uris := make([]string, 0, len(s.docs))
+	for uri := range s.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	programs := map[string]*compiler.Program{}
+	for _, uri := range uris {
+		d := s.docs[uri]
+		dir := filepath.Dir(d.path)
+		if _, ok := programs[dir]; !ok {
+			programs[dir] = s.program(dir)
+		}
+		if err := s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         uri,
+			Diagnostics: s.diagnostics(d, programs[dir]),
+		}); err != nil {
+			return &responseError{Message: err.Error()}
+		}
+	}
+	return nil
+}
+
+// diagnostics returns the syntax errors of d. Without them, it returns the semantic errors and the
+// type errors as warnings, checked with prog of the directory of d.
+func (s *Server) diagnostics(d *document, prog *compiler.Program) []Diagnostic {
+	errs := d.errs
+	var warnings compiler.ErrorList
+	if len(errs) == 0 && d.cls != nil {
+		if err := compiler.Check(d.cls); err != nil {
+			errs = append(errs, errorList(err, d.path)...)
+		}
+		errs = append(errs, prog.CheckCalls(d.cls)...)
+		warnings = compiler.TypeCheck(d.cls, prog)
+	}
+
+	diags := []Diagnostic{}
+	add := func(errs compiler.ErrorList, severity int) {
+		for _, e := range errs {
+			diags = append(diags, Diagnostic{Range: d.span(e.Pos), Severity: severity, Source: "jack", Message: e.Msg})
+		}
+	}
+	add(errs, severityError)
+	add(warnings, severityWarning)
+	return diags
+}
+
+// program indexes the classes in dir: the open documents and the other files on the disk.
+// The files on the disk are parsed once until they are invalidated.
+func (s *Server) program(dir string) *compiler.Program {
+	var classes []*compiler.Class
+	open := map[string]bool{}
+	for _, d := range s.docs {
+		if filepath.Dir(d.path) == dir && d.cls != nil {
+			classes = append(classes, d.cls)
+			open[d.path] = true
+		}
+	}
+
+	for _, d := range s.diskDocuments(dir) {
+		if !open[d.path] && d.cls != nil {
+			classes = append(classes, d.cls)
+		}
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].ClassName < classes[j].ClassName })
+	return compiler.NewProgram(classes)
+}
+
+// diskDocuments returns the .jack files in dir read from the disk.
+func (s *Server) diskDocuments(dir string) []*document {
+	if docs, ok := s.disk[dir]; ok {
+		return docs
+	}
+	var docs []*document
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jack"))
+	for _, file := range files {
+		if d := readDocument(file); d != nil {
+			docs = append(docs, d)
+		}
+	}
+	s.disk[dir] = docs
+	return docs
+}
+
+// invalidate drops the files read from the directory of path, which has been saved or changed.
+func (s *Server) invalidate(path string) {
+	delete(s.disk, filepath.Dir(path))
+}
+
+func readDocument(path string) *document {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return newDocument(pathToURI(path), string(text))
+}
+
+// location returns the location of pos, which is in an open document or a file on the disk.
+// The declarations of the OS have no location.
+func (s *Server) location(pos compiler.Pos) *Location {
+	if pos.File == "" || !filepath.IsAbs(pos.File) {
+		return nil
+	}
+	var d *document
+	for _, doc := range s.docs {
+		if doc.path == pos.File {
+			d = doc
+		}
+	}
+	for _, doc := range s.diskDocuments(filepath.Dir(pos.File)) {
+		if d == nil && doc.path == pos.File {
+			d = doc
+		}
+	}
+	if d == nil {
+		return nil
+	}
+	return &Location{URI: d.uri, Range: d.span(pos)}
+}
+
+// target is what an identifier refers to: a variable, a subroutine or a class.
+type target struct {
+	sym   *compiler.Symbol
+	name  string
+	sig   *compiler.Signature
+	class *compiler.ClassInfo
+}
+
+// resolve returns the target of the identifier at pos, and its token.
+func (s *Server) resolve(d *document, pos compiler.Pos) (*target, *compiler.Token) {
+	i := d.tokenAt(pos)
+	if i < 0 || d.tokens[i].Type != compiler.TokenTypeIdentifier || d.cls == nil {
+		return nil, nil
+	}
+	token := &d.tokens[i]
+	symbols := d.symbols(pos)
+	prog := s.program(filepath.Dir(d.path))
+
+	isSymbol := func(j int, value string) bool {
+		return j >= 0 && j < len(d.tokens) && d.tokens[j].Type == compiler.TokenTypeSymbol && d.tokens[j].Value == value
+	}
+	switch {
+	case isSymbol(i-1, ".") && i >= 2:
+		class := d.tokens[i-2].Value
+		if sym := symbols.Get(class); sym != nil {
+			class = sym.Type
+		}
+		if sig := prog.Subroutine(class, token.Value); sig != nil {
+			return &target{sig: sig}, token
+		}
+	case isSymbol(i+1, "("):
+		if sig := prog.Subroutine(d.cls.ClassName, token.Value); sig != nil {
+			return &target{sig: sig}, token
+		}
+	default:
+		if sym := symbols.Get(token.Value); sym != nil {
+			return &target{sym: sym, name: token.Value}, token
+		}
+		if class := prog.Class(token.Value); class != nil {
+			return &target{class: class}, token
+		}
+	}
+	return nil, token
+}
+
+func (s *Server) definition(d *document, pos compiler.Pos) *Location {
+	t, _ := s.resolve(d, pos)
+	switch {
+	case t == nil:
+		return nil
+	case t.sym != nil:
+		return s.location(t.sym.Pos)
+	case t.sig != nil:
+		return s.location(t.sig.Pos)
+	default:
+		return s.location(t.class.Pos)
+	}
+}
+
+func (s *Server) hover(d *document, pos compiler.Pos) *Hover {
+	t, token := s.resolve(d, pos)
+	if t == nil {
+		return nil
+	}
+
+	var decl string
+	switch {
+	case t.sym != nil:
+		decl = fmt.Sprintf("%s %s %s", t.sym.Kind, t.sym.Type, t.name)
+	case t.sig != nil:
+		decl = signature(t.sig)
+	default:
+		decl = "class " + t.class.Name
+		if t.class.OS {
+			decl += " // OS"
+		}
+	}
+	r := d.span(token.Pos)
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```jack\n" + decl + "\n```"},
+		Range:    &r,
+	}
+}
+
+func signature(sig *compiler.Signature) string {
+	params := make([]string, len(sig.Params))
+	for i, ty := range sig.Params {
+		params[i] = string(ty) + " " + sig.ParamNames[i]
+	}
+	return fmt.Sprintf("%s %s %s.%s(%s)", sig.Kind, sig.RetType, sig.Class, sig.Name, strings.Join(params, ", "))
+}
+
+// completion returns the subroutines of the receiver before '.' at pos: the methods for a
+// variable, and the functions and constructors for a class name.
+func (s *Server) completion(d *document, pos compiler.Pos) []CompletionItem {
+	items := []CompletionItem{}
+	line := pos.Line - 1
+	if line < 0 || line >= len(d.lines) {
+		return items
+	}
+	text := d.lines[line]
+	if col := pos.Col - 1; col < len(text) {
+		text = text[:col]
+	}
+
+	i := len(text)
+	for i > 0 && isIdentByte(text[i-1]) {
+		i--
+	}
+	if i == 0 || text[i-1] != '.' {
+		return items
+	}
+	j := i - 1
+	for j > 0 && isIdentByte(text[j-1]) {
+		j--
+	}
+	receiver := text[j : i-1]
+	if receiver == "" {
+		return items
+	}
+
+	class, methods := receiver, false
+	symbols := d.symbols(pos)
+	if sym := symbols.Get(receiver); sym != nil {
+		class, methods = sym.Type, true
+	}
+	info := s.program(filepath.Dir(d.path)).Class(class)
+	if info == nil {
+		return items
+	}
+
+	for _, sig := range info.Subroutines {
+		if (sig.Kind == compiler.SubRoutineTypeMethod) != methods {
+			continue
+		}
+		kind := completionKindFunction
+		switch sig.Kind {
+		case compiler.SubRoutineTypeMethod:
+			kind = completionKindMethod
+		case compiler.SubRoutineTypeConstructor:
+			kind = completionKindConstructor
+		}
+		items = append(items, CompletionItem{Label: sig.Name, Kind: kind, Detail: signature(sig)})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// documentSymbols returns the class with its variables and subroutines as the children.
+func documentSymbols(d *document) []DocumentSymbol {
+	if d.cls == nil || len(d.tokens) == 0 {
+		return []DocumentSymbol{}
+	}
+
+	var children []DocumentSymbol
+	for _, dec := range d.cls.ClassVarDecs {
+		kind := symbolKindField
+		if dec.ClassVarDecType == compiler.ClassVarDecTypeStatic {
+			kind = symbolKindVariable
+		}
+		for i, name := range dec.VarNames {
+			r := d.span(dec.NamePos[i])
+			children = append(children, DocumentSymbol{
+				Name:           name,
+				Detail:         fmt.Sprintf("%s %s", dec.ClassVarDecType, dec.VarType),
+				Kind:           kind,
+				Range:          r,
+				SelectionRange: r,
+			})
+		}
+	}
+	for _, dec := range d.cls.SubRoutineDecs {
+		kind := symbolKindFunction
+		switch dec.SubRoutineType {
+		case compiler.SubRoutineTypeMethod:
+			kind = symbolKindMethod
+		case compiler.SubRoutineTypeConstructor:
+			kind = symbolKindConstructor
+		}
+		r := d.span(dec.Pos)
+		children = append(children, DocumentSymbol{
+			Name:           dec.SubroutineName,
+			Detail:         fmt.Sprintf("%s %s", dec.SubRoutineType, dec.RetType),
+			Kind:           kind,
+			Range:          r,
+			SelectionRange: r,
+		})
+	}
+
+	last := d.tokens[len(d.tokens)-1]
+	return []DocumentSymbol{{
+		Name:           d.cls.ClassName,
+		Kind:           symbolKindClass,
+		Range:          Range{Start: d.position(d.tokens[0].Pos), End: d.span(last.Pos).End},
+		SelectionRange: d.span(d.cls.Pos),
+		Children:       children,
+	}}
+}
@@ -0,0 +1,381 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const pointSource = `class Point {
+	field int x, y;
+
+	constructor Point new(int ax, int ay) {
+		let x = ax;
+		let y = ay;
+		return this;
+	}
+
+	method int getX() {
+		return x;
+	}
+
+	function int origin() {
+		return 0;
+	}
+}
+`
+
+const mainSource = `class Main {
+	function void main() {
+		var Point p;
+		var int n;
+		let p = Point.new(1, 2);
+		let n = p.getX();
+		do Output.printInt(n);
+		return;
+	}
+}
+`
+
+// client is a scripted client of the server.
+type client struct {
+	t      *testing.T
+	in     io.Writer
+	out    *textproto.Reader
+	nextID int
+}
+
+func startServer(t *testing.T) (*client, chan error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := NewServer(inR, outW).Serve()
+		outW.Close()
+		done <- err
+	}()
+	return &client{t: t, in: inW, out: textproto.NewReader(bufio.NewReader(outR))}, done
+}
+
+func (c *client) send(v interface{}) {
+	c.t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := io.WriteString(c.in, "Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+string(body)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) receive() map[string]json.RawMessage {
+	c.t.Helper()
+	header, err := c.out.ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(header.Get("Content-Length"))
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.out.R, body); err != nil {
+		c.t.Fatal(err)
+	}
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// request sends a request and decodes its result into result.
+func (c *client) request(method string, params interface{}, result interface{}) {
+	c.t.Helper()
+	c.nextID++
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	msg := c.receive()
+	if e, ok := msg["error"]; ok {
+		c.t.Fatalf("%s: %s", method, e)
+	}
+	if err := json.Unmarshal(msg["result"], result); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+}
+
+// diagnostics receives the diagnostics published for n documents.
+func (c *client) diagnostics(n int) map[string][]Diagnostic {
+	c.t.Helper()
+	diags := map[string][]Diagnostic{}
+	for i := 0; i < n; i++ {
+		msg := c.receive()
+		var params publishDiagnosticsParams
+		if err := json.Unmarshal(msg["params"], &params); err != nil {
+			c.t.Fatal(err)
+		}
+		diags[params.URI] = params.Diagnostics
+	}
+	return diags
+}
+
+func at(uri string, line, char int) interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     Position{Line: line, Character: char},
+	}
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	pointPath := filepath.Join(dir, "Point.jack")
+	if err := os.WriteFile(pointPath, []byte(pointSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pointURI := pathToURI(pointPath)
+	mainURI := pathToURI(filepath.Join(dir, "Main.jack"))
+
+	c, done := startServer(t)
+
+	var init initializeResult
+	c.request("initialize", map[string]interface{}{}, &init)
+	if !init.Capabilities.DefinitionProvider || init.Capabilities.CompletionProvider.TriggerCharacters[0] != "." {
+		t.Errorf("capabilities: %+v", init.Capabilities)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	// diagnostics on open and change
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": textDocumentItem{URI: mainURI, LanguageID: "jack", Version: 1, Text: mainSource},
+	})
+	if diags := c.diagnostics(1)[mainURI]; len(diags) != 0 {
+		t.Errorf("diagnostics: %+v", diags)
+	}
+
+	changed := strings.Replace(mainSource, "p.getX()", "p.getY()", 1)
+	changed = strings.Replace(changed, "let n", "let m", 1)
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   textDocumentIdentifier{URI: mainURI},
+		"contentChanges": []map[string]string{{"text": changed}},
+	})
+	diags := c.diagnostics(1)[mainURI]
+	want := []string{
+		"6:7: assignment to undeclared variable 'm'",
+		"6:11: unknown subroutine 'Point.getY'",
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("diagnostics: %+v", diags)
+	}
+	for i, d := range diags {
+		got := strconv.Itoa(d.Range.Start.Line+1) + ":" + strconv.Itoa(d.Range.Start.Character+1) + ": " + d.Message
+		if got != want[i] || d.Severity != severityError {
+			t.Errorf("diagnostic %d: got %q, want %q", i, got, want[i])
+		}
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   textDocumentIdentifier{URI: mainURI},
+		"contentChanges": []map[string]string{{"text": strings.Replace(mainSource, "p.getX()", "p", 1)}},
+	})
+	if diags := c.diagnostics(1)[mainURI]; len(diags) != 1 || diags[0].Severity != severityWarning {
+		t.Errorf("type error diagnostics: %+v", diags)
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   textDocumentIdentifier{URI: mainURI},
+		"contentChanges": []map[string]string{{"text": mainSource}},
+	})
+	c.diagnostics(1)
+
+	// definition
+	definitions := []struct {
+		line, char int
+		want       *Location
+	}{
+		// p in "let n = p.getX();"
+		{5, 10, &Location{URI: mainURI, Range: Range{Position{2, 12}, Position{2, 13}}}},
+		// getX in "let n = p.getX();"
+		{5, 13, &Location{URI: pointURI, Range: Range{Position{9, 12}, Position{9, 16}}}},
+		// Point in "var Point p;"
+		{2, 7, &Location{URI: pointURI, Range: Range{Position{0, 6}, Position{0, 11}}}},
+		// new in "let p = Point.new(1, 2);"
+		{4, 17, &Location{URI: pointURI, Range: Range{Position{3, 19}, Position{3, 22}}}},
+		// printInt of the OS
+		{6, 13, nil},
+	}
+	for _, test := range definitions {
+		var got *Location
+		c.request("textDocument/definition", at(mainURI, test.line, test.char), &got)
+		if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+			t.Errorf("definition at %d:%d: got %+v, want %+v", test.line, test.char, got, test.want)
+		}
+	}
+
+	// definition of a field, after opening the other class
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": textDocumentItem{URI: pointURI, LanguageID: "jack", Version: 1, Text: pointSource},
+	})
+	c.diagnostics(2)
+	var field *Location
+	c.request("textDocument/definition", at(pointURI, 10, 9), &field)
+	if field == nil || *field != (Location{URI: pointURI, Range: Range{Position{1, 11}, Position{1, 12}}}) {
+		t.Errorf("definition of field: %+v", field)
+	}
+
+	// hover
+	hovers := []struct {
+		uri        string
+		line, char int
+		want       string
+	}{
+		{mainURI, 5, 10, "var Point p"},
+		{mainURI, 5, 13, "method int Point.getX()"},
+		{mainURI, 4, 17, "constructor Point Point.new(int ax, int ay)"},
+		{mainURI, 2, 7, "class Point"},
+		{pointURI, 10, 9, "field int x"},
+	}
+	for _, test := range hovers {
+		var got *Hover
+		c.request("textDocument/hover", at(test.uri, test.line, test.char), &got)
+		if got == nil || got.Contents.Value != "```jack\n"+test.want+"\n```" {
+			t.Errorf("hover at %d:%d: got %+v, want %q", test.line, test.char, got, test.want)
+		}
+	}
+
+	// completion after '.'
+	completions := []struct {
+		line, char int
+		want       []string
+	}{
+		{5, 12, []string{"getX"}},
+		{4, 16, []string{"new", "origin"}},
+		{6, 12, []string{"backSpace", "init", "moveCursor", "printChar", "printInt", "printString", "println"}},
+		{5, 8, nil},
+	}
+	for _, test := range completions {
+		var items []CompletionItem
+		c.request("textDocument/completion", at(mainURI, test.line, test.char), &items)
+		var got []string
+		for _, item := range items {
+			got = append(got, item.Label)
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("completion at %d:%d: got %v, want %v", test.line, test.char, got, test.want)
+		}
+	}
+
+	// document symbols
+	var symbols []DocumentSymbol
+	c.request("textDocument/documentSymbol", map[string]interface{}{
+		"textDocument": textDocumentIdentifier{URI: pointURI},
+	}, &symbols)
+	if len(symbols) != 1 || symbols[0].Name != "Point" || symbols[0].Kind != symbolKindClass {
+		t.Fatalf("document symbols: %+v", symbols)
+	}
+	var names []string
+	for _, s := range symbols[0].Children {
+		names = append(names, s.Name+":"+strconv.Itoa(s.Kind))
+	}
+	if got, want := strings.Join(names, " "), "x:8 y:8 new:9 getX:6 origin:12"; got != want {
+		t.Errorf("document symbol children: got %q, want %q", got, want)
+	}
+
+	// unknown request
+	c.nextID++
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": "textDocument/unknown"})
+	if _, ok := c.receive()["error"]; !ok {
+		t.Error("unknown request should fail")
+	}
+
+	var null interface{}
+	c.request("shutdown", nil, &null)
+	c.notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestServerDiskCache checks that the classes on the disk are parsed once, until a file of the
+// directory is saved or changed.
+func TestServerDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	pointPath := filepath.Join(dir, "Point.jack")
+	if err := os.WriteFile(pointPath, []byte(pointSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mainURI := pathToURI(filepath.Join(dir, "Main.jack"))
+
+	c, done := startServer(t)
+
+	// the server asks the client to watch the .jack files, and ignores the response
+	var init initializeResult
+	c.request("initialize", map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"workspace": map[string]interface{}{"didChangeWatchedFiles": map[string]bool{"dynamicRegistration": true}},
+		},
+	}, &init)
+	c.notify("initialized", map[string]interface{}{})
+	msg := c.receive()
+	var reg registrationParams
+	if err := json.Unmarshal(msg["params"], &reg); err != nil {
+		t.Fatal(err)
+	}
+	if string(msg["method"]) != `"client/registerCapability"` || len(reg.Registrations) != 1 ||
+		reg.Registrations[0].Method != "workspace/didChangeWatchedFiles" ||
+		!strings.Contains(string(msg["params"]), `"globPattern":"**/*.jack"`) {
+		t.Errorf("unexpected registration: %s", msg["params"])
+	}
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": msg["id"], "result": nil})
+
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": textDocumentItem{URI: mainURI, LanguageID: "jack", Version: 1, Text: mainSource},
+	})
+	if diags := c.diagnostics(1)[mainURI]; len(diags) != 0 {
+		t.Errorf("diagnostics: %+v", diags)
+	}
+
+	// the change on the disk is not seen until it is notified
+	removed := strings.Replace(pointSource, "getX", "getZ", 1)
+	if err := os.WriteFile(pointPath, []byte(removed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	change := func() []Diagnostic {
+		c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   textDocumentIdentifier{URI: mainURI},
+			"contentChanges": []map[string]string{{"text": mainSource}},
+		})
+		return c.diagnostics(1)[mainURI]
+	}
+	if diags := change(); len(diags) != 0 {
+		t.Errorf("diagnostics with the cached class: %+v", diags)
+	}
+
+	c.notify("workspace/didChangeWatchedFiles", map[string]interface{}{
+		"changes": []map[string]interface{}{{"uri": pathToURI(pointPath), "type": 2}},
+	})
+	if diags := c.diagnostics(1)[mainURI]; len(diags) != 1 || diags[0].Message != "unknown subroutine 'Point.getX'" {
+		t.Errorf("diagnostics after the change of the file: %+v", diags)
+	}
+
+	if err := os.WriteFile(pointPath, []byte(pointSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.notify("textDocument/didSave", map[string]interface{}{
+		"textDocument": textDocumentIdentifier{URI: pathToURI(pointPath)},
+	})
+	if diags := change(); len(diags) != 0 {
+		t.Errorf("diagnostics after saving the file: %+v", diags)
+	}
+
+	c.notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,14 +2,19 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/jessevdk/go-flags"
+	"github.com/nfukaaswa/nand2tetris/08/src/vm/ir"
 	"github.com/nfukaaswa/nand2tetris/11/src/compiler"
 )
 
 type opts struct {
-	Inputs []string `short:"i" long:"in" required:"true" description:"input file or directory path"`
-	Output string   `short:"o" long:"out" required:"true" description:"output directory path"`
+	Inputs    []string `short:"i" long:"in" required:"true" description:"input file or directory path"`
+	Output    string   `short:"o" long:"out" required:"true" description:"output directory path"`
+	TypeCheck string   `long:"typecheck" choice:"off" choice:"warn" choice:"error" default:"off" description:"report type errors as warnings or errors"`
+	SourceMap bool     `long:"source-map" description:"write the map from VM lines to Jack lines to <class>.vm.map"`
+	Passes    []string `long:"pass" choice:"fold" choice:"unreachable" description:"run the pass over the VM code of each class, in the order given"`
 }
 
 func main() {
@@ -19,8 +24,22 @@ func main() {
 		return
 	}
 
-	if err := compiler.Compile(opts.Inputs, opts.Output); err != nil {
+	var passes []ir.Pass
+	for _, name := range opts.Passes {
+		p, err := ir.PassByName(name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		passes = append(passes, p)
+	}
+
+	if err := compiler.Compile(opts.Inputs, opts.Output, compiler.CompileOptions{
+		TypeCheck: compiler.TypeCheckLevel(opts.TypeCheck),
+		SourceMap: opts.SourceMap,
+		Passes:    passes,
+	}); err != nil {
 		fmt.Println(err)
-		return
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nfukaaswa/nand2tetris/08/src/vm/ir"
+	"github.com/nfukaaswa/nand2tetris/08/src/vmemu"
+	"github.com/nfukaaswa/nand2tetris/11/src/compiler"
+)
+
+// The sample programs are compiled and run on the VM emulator with the OS natives. The keyboard
+// is scripted by replacing Keyboard.keyPressed, so the runs do not depend on the timing.
+func TestPrograms(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []keyPress
+		setup  func(m *vmemu.Machine)
+		output string
+		check  func(t *testing.T, m *vmemu.Machine)
+		screen uint32
+	}{
+		{
+			name:   "Seven",
+			output: "7",
+			screen: 0x36282cd7,
+		},
+		{
+			name:  "ConvertToBin",
+			setup: func(m *vmemu.Machine) { m.RAM[8000] = 0xa5c3 },
+			check: func(t *testing.T, m *vmemu.Machine) {
+				for i := 0; i < 16; i++ {
+					if want := uint16(0xa5c3>>i) & 1; m.RAM[8001+i] != want {
+						t.Errorf("RAM[%d] = %d, want %d", 8001+i, m.RAM[8001+i], want)
+					}
+				}
+			},
+			screen: 0xab54d286,
+		},
+		{
+			name: "Average",
+			keys: typeKeys("3\n10\n20\n36\n"),
+			// Keyboard.readChar shows the cursor, and erases it with a backspace.
+			output: "How many numbers? \b3\b\nEnter a number: \b1\b0\b\nEnter a number: \b2\b0\b\nEnter a number: \b3\b6\b\nThe average is 22",
+			screen: 0x66638bc3,
+		},
+		{
+			name: "ComplexArrays",
+			output: "Test 1: expected result: 5; actual result: 5\n" +
+				"Test 2: expected result: 40; actual result: 40\n" +
+				"Test 3: expected result: 0; actual result: 0\n" +
+				"Test 4: expected result: 77; actual result: 77\n" +
+				"Test 5: expected result: 110; actual result: 110\n",
+			screen: 0x831af1ae,
+		},
+		{
+			name: "Square",
+			// moves right (132), grows (x), moves down (133), and quits (q)
+			keys:   []keyPress{{132, 40}, {0, 1}, {88, 10}, {0, 1}, {133, 30}, {0, 1}, {81, 1}},
+			screen: 0xc6f95295,
+		},
+		{
+			name: "Pong",
+			// moves the bat left (130), and misses the ball
+			keys:   []keyPress{{130, 20}, {0, 1}},
+			output: "Score: 0Game Over",
+			screen: 0x04e3d443,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			m := runProgram(t, filepath.Join("..", test.name), compiler.CompileOptions{}, test.keys, test.setup, &out)
+
+			if test.output != "" && out.String() != test.output {
+				t.Errorf("output:\ngot:  %q\nwant: %q", out.String(), test.output)
+			}
+			if test.check != nil {
+				test.check(t, m)
+			}
+			if sum := screenChecksum(m); sum != test.screen {
+				t.Errorf("screen checksum: got %#08x, want %#08x", sum, test.screen)
+			}
+		})
+	}
+}
+
+// TestProgramsWithPasses checks that the programs compiled with the passes over the VM code run
+// the same. ConvertToBin has the code after the returns of both branches of if.
+func TestProgramsWithPasses(t *testing.T) {
+	opts := compiler.CompileOptions{Passes: []ir.Pass{ir.ConstantFolding{}, ir.UnreachableCode{}}}
+	for _, name := range []string{"ConvertToBin", "ComplexArrays"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			setup := func(m *vmemu.Machine) { m.RAM[8000] = 0xa5c3 }
+			var want, got bytes.Buffer
+			before := runProgram(t, filepath.Join("..", name), compiler.CompileOptions{}, nil, setup, &want)
+			after := runProgram(t, filepath.Join("..", name), opts, nil, setup, &got)
+
+			if got.String() != want.String() {
+				t.Errorf("output:\ngot:  %q\nwant: %q", got.String(), want.String())
+			}
+			for i := 8000; i <= 8016; i++ {
+				if after.RAM[i] != before.RAM[i] {
+					t.Errorf("RAM[%d]: got %d, want %d", i, after.RAM[i], before.RAM[i])
+				}
+			}
+		})
+	}
+}
+
+// runProgram compiles the program in dir with opts, and runs it until Sys.halt.
+func runProgram(t *testing.T, dir string, opts compiler.CompileOptions, keys []keyPress, setup func(m *vmemu.Machine), out *bytes.Buffer) *vmemu.Machine {
+	t.Helper()
+
+	vms := t.TempDir()
+	if err := compiler.Compile([]string{dir}, vms, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	natives := vmemu.OSNatives(out)
+	natives["Keyboard.keyPressed"] = (&keyboard{keys: keys}).keyPressed
+	m := vmemu.New(vmemu.Options{Natives: natives})
+	if err := m.LoadFiles([]string{vms}); err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(m)
+	}
+	if err := m.Run(200000000); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Halted {
+		t.Fatalf("program does not halt in %d steps, in %s", m.Steps, m.Function())
+	}
+	return m
+}
+
+// keyPress holds key for the number of the calls of Keyboard.keyPressed. The key 0 releases the keys.
+type keyPress struct {
+	key   uint16
+	calls int
+}
+
+// keyboard returns the keys of the script from Keyboard.keyPressed, and no key after the script.
+type keyboard struct {
+	keys  []keyPress
+	calls int
+}
+
+func (k *keyboard) keyPressed(m *vmemu.Machine, args []uint16) (uint16, error) {
+	for len(k.keys) > 0 && k.calls >= k.keys[0].calls {
+		k.keys, k.calls = k.keys[1:], 0
+	}
+	if len(k.keys) == 0 {
+		return 0, nil
+	}
+	k.calls++
+	return k.keys[0].key, nil
+}
+
+// typeKeys returns the script typing s. Keyboard.readChar reads a key in two calls, and waits for the release.
+func typeKeys(s string) []keyPress {
+	var keys []keyPress
+	for _, c := range strings.ReplaceAll(s, "\n", string(rune(128))) {
+		keys = append(keys, keyPress{uint16(c), 2}, keyPress{0, 1})
+	}
+	return keys
+}
+
+func screenChecksum(m *vmemu.Machine) uint32 {
+	buf := make([]byte, 2*vmemu.ScreenSize)
+	for i, w := range m.RAM[vmemu.ScreenBase : vmemu.ScreenBase+vmemu.ScreenSize] {
+		binary.LittleEndian.PutUint16(buf[2*i:], w)
+	}
+	return crc32.ChecksumIEEE(buf)
+}